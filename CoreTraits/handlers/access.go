@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/access"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Guards for private rooms and streams, rebuilt by Configure
+var (
+	accessThrottle = newThrottle(cfg.Access)
+	inviter        = access.NewInviter(cfg.Access.InviteSecret, cfg.Access.InviteTTL.Std())
+)
+
+// newThrottle creates the failed-attempt throttle from the access settings
+func newThrottle(c config.AccessConfig) *access.Throttle {
+	return access.NewThrottle(c.MaxAttempts, c.MaxSessionAttempts, c.AttemptWindow.Std(), c.Lockout.Std())
+}
+
+// RequireRoomAccess turns away banned users and checks the access code or
+// invite token for private rooms. The room owner is always let in. Must run
+// after RequireToken.
+func RequireRoomAccess(c *fiber.Ctx) error {
+	room, exists := roomManager.Get(c.Params("uuid"))
+	if !exists {
+		return c.Next()
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	if room.isBanned(info.UserID) {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "You have been banned from this room",
+		})
+	}
+	
+	// Breakouts admit the users assigned to them and those running the breakouts
+	if room.Parent != nil {
+		if !room.mayEnterBreakout(info) {
+			return c.Status(403).JSON(fiber.Map{
+				"success": false,
+				"message": "You are not assigned to this breakout room",
+			})
+		}
+		return c.Next()
+	}
+	
+	config := room.RTC.GetConfig()
+	if !config.IsPrivate {
+		return c.Next()
+	}
+	
+	if info.UserID == room.GetMetadata().OwnerID {
+		return c.Next()
+	}
+	
+	return checkAccess(c, room.ID, config.AccessCode)
+}
+
+// RequireStreamAccess checks the access code or invite token for private
+// streams. The stream owner is always let in. Must run after RequireToken.
+func RequireStreamAccess(c *fiber.Ctx) error {
+	stream, exists := streamManager.Get(c.Params("ssuid"))
+	if !exists {
+		return c.Next()
+	}
+	
+	settings := stream.GetSettings()
+	if !settings.IsPrivate {
+		return c.Next()
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	if info.UserID == stream.UserID {
+		return c.Next()
+	}
+	
+	return checkAccess(c, stream.ID, settings.AccessCode)
+}
+
+// checkAccess admits the request with a valid invite token or access code,
+// counting wrong codes against the client IP and the session. A right code
+// is let in even while the session is locked out by other clients' guesses.
+func checkAccess(c *fiber.Ctx, sessionID, code string) error {
+	// Invites are signed, so they cannot be guessed and skip the throttle
+	if invite := c.Query("invite"); invite != "" && inviter.Valid(sessionID, invite) {
+		return c.Next()
+	}
+	
+	if wait, locked := accessThrottle.Locked(c.IP(), sessionID); locked {
+		return rejectLocked(c, wait)
+	}
+	
+	given := c.Get("X-Access-Code")
+	if given == "" {
+		given = c.Query("access_code")
+	}
+	if given == "" {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "Access code or invite required",
+		})
+	}
+	
+	if !access.MatchCode(code, given) {
+		if wait, locked := accessThrottle.Fail(c.IP(), sessionID); locked {
+			return rejectLocked(c, wait)
+		}
+	
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid access code",
+		})
+	}
+	
+	accessThrottle.Succeed(c.IP(), sessionID)
+	return c.Next()
+}
+
+// rejectLocked refuses a client that failed too many access attempts
+func rejectLocked(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(429).JSON(fiber.Map{
+		"success":        false,
+		"message":        "Too many failed attempts, try again later",
+		"retry_after_ms": wait.Milliseconds(),
+	})
+}
+
+// privateAccess creates the access code for a new session. It returns the
+// requested code, or a generated one when none was given.
+func privateAccess(requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	
+	return access.NewCode()
+}
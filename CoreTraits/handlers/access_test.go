@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/access"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestCheckAccessLetsRightCodeThroughSessionLockout(t *testing.T) {
+	previous := accessThrottle
+	t.Cleanup(func() { accessThrottle = previous })
+	accessThrottle = access.NewThrottle(100, 2, time.Minute, time.Hour)
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return checkAccess(c, "room", "RIGHTCODE")
+	}, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	try := func(code string) int {
+		req := httptest.NewRequest("GET", "/?access_code="+code, nil)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// Every request comes from the same address here, so other clients'
+	// guesses are simulated on the throttle directly
+	accessThrottle.Fail("10.0.0.1", "room")
+	accessThrottle.Fail("10.0.0.2", "room")
+
+	if status := try("RIGHTCODE"); status != fiber.StatusOK {
+		t.Fatalf("right code during session lockout = %d, want 200", status)
+	}
+	if status := try("WRONGCODE"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("wrong code during session lockout = %d, want 429", status)
+	}
+	if status := try("RIGHTCODE"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("right code after failing during lockout = %d, want 429", status)
+	}
+}
+
+func TestRequireRoomAccess(t *testing.T) {
+	room := newRoom("private-room", RoomMetadata{OwnerID: "owner"}, webrtc.RoomConfig{IsPrivate: true, AccessCode: "RIGHTCODE"}, nil)
+	t.Cleanup(func() { room.close("test") })
+
+	app := fiber.New()
+	app.Get("/room/:uuid", func(c *fiber.Ctx) error {
+		c.Locals(identityKey, &chat.ClientInfo{UserID: c.Query("u")})
+		return c.Next()
+	}, RequireRoomAccess, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"owner without code", "u=owner", fiber.StatusOK},
+		{"student without code", "u=student", fiber.StatusForbidden},
+		{"student with code", "u=student&access_code=RIGHTCODE", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/room/private-room?"+tt.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
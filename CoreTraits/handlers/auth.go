@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/auth"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+// Locals key holding the authenticated user for the request
+const identityKey = "identity"
+
+// Token authenticator, set at startup by SetAuthenticator
+var authenticator auth.Authenticator
+
+// SetAuthenticator sets how websocket handshakes are authenticated. Call before serving.
+func SetAuthenticator(a auth.Authenticator) {
+	authenticator = a
+}
+
+// RequireToken authenticates the request before the websocket upgrade. The
+// token is read from the Authorization header, or from the access_token query
+// parameter for browsers that cannot set headers on websocket requests.
+func RequireToken(c *fiber.Ctx) error {
+	if authenticator == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication is not configured",
+		})
+	}
+
+	token := bearerToken(c)
+	info, err := authenticator.Authenticate(c.UserContext(), token)
+	if err != nil && !errors.Is(err, auth.ErrMissingToken) && !errors.Is(err, auth.ErrInvalidToken) {
+		// The token could not be checked, so it is not the client's fault
+		log.Printf("Failed to authenticate token: %v", err)
+		return c.Status(503).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication service unavailable",
+		})
+	}
+	if err != nil {
+		message := "Invalid token"
+		if errors.Is(err, auth.ErrMissingToken) {
+			message = "Missing bearer token"
+		}
+
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="aries"`)
+		return c.Status(401).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	c.Locals(identityKey, info)
+	return c.Next()
+}
+
+// RequireStreamOwner rejects streamer connections from anyone but the stream's owner.
+// Must run after RequireToken.
+func RequireStreamOwner(c *fiber.Ctx) error {
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+
+	stream, exists := streamManager.Get(c.Params("ssuid"))
+	if exists && stream.UserID != info.UserID {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "Only the stream owner can broadcast",
+		})
+	}
+
+	return c.Next()
+}
+
+// bearerToken extracts the token from the request
+func bearerToken(c *fiber.Ctx) string {
+	if header := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	return c.Query("access_token")
+}
+
+// identity returns the user authenticated by RequireToken
+func identity(c *websocket.Conn) *chat.ClientInfo {
+	info, _ := c.Locals(identityKey).(*chat.ClientInfo)
+	return info
+}
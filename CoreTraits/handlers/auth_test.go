@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/auth"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+// authenticatorFunc adapts a function to auth.Authenticator
+type authenticatorFunc func(token string) (*chat.ClientInfo, error)
+
+func (f authenticatorFunc) Authenticate(_ context.Context, token string) (*chat.ClientInfo, error) {
+	return f(token)
+}
+
+func TestRequireTokenStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"accepted", nil, fiber.StatusOK},
+		{"missing", auth.ErrMissingToken, fiber.StatusUnauthorized},
+		{"invalid", auth.ErrInvalidToken, fiber.StatusUnauthorized},
+		{"unavailable", errors.New("sanctum endpoint returned 502 Bad Gateway"), fiber.StatusServiceUnavailable},
+	}
+
+	previous := authenticator
+	t.Cleanup(func() { authenticator = previous })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetAuthenticator(authenticatorFunc(func(string) (*chat.ClientInfo, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &chat.ClientInfo{UserID: "user"}, nil
+			}))
+
+			app := fiber.New()
+			app.Get("/", RequireToken, func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
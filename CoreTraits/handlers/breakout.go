@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// Signal types for running breakout rooms, sent by moderators in the parent
+// room or any of its breakouts
+const (
+	SignalBreakoutStart     = "breakout_start"
+	SignalBreakoutAssign    = "breakout_assign"
+	SignalBreakoutBroadcast = "breakout_broadcast"
+	SignalBreakoutJoin      = "breakout_join"
+	SignalBreakoutEnd       = "breakout_end"
+)
+
+// Breakout limits and the default warning before participants are moved
+const (
+	maxBreakouts             = 50
+	defaultBreakoutCountdown = 10 * time.Second
+)
+
+// BreakoutStartData is the payload of a breakout_start frame. Assignments map
+// user IDs to breakout indexes; with random set, everyone else in the room is
+// spread over the breakouts.
+type BreakoutStartData struct {
+	Count            int            `json:"count"`
+	Names            []string       `json:"names,omitempty"`
+	Assignments      map[string]int `json:"assignments,omitempty"`
+	Random           bool           `json:"random,omitempty"`
+	DurationSeconds  int            `json:"duration_seconds,omitempty"`
+	CountdownSeconds *int           `json:"countdown_seconds,omitempty"`
+}
+
+// BreakoutAssignData is the payload of a breakout_assign frame
+type BreakoutAssignData struct {
+	UserID           string `json:"user_id"`
+	RoomID           string `json:"room_id"`
+	CountdownSeconds *int   `json:"countdown_seconds,omitempty"`
+}
+
+// BreakoutBroadcastData is the payload of a breakout_broadcast frame
+type BreakoutBroadcastData struct {
+	Message string `json:"message"`
+}
+
+// BreakoutJoinData is the payload of a breakout_join frame. The parent room
+// ID takes the moderator back to the main room.
+type BreakoutJoinData struct {
+	RoomID string `json:"room_id"`
+}
+
+// BreakoutEndData is the payload of a breakout_end frame
+type BreakoutEndData struct {
+	CountdownSeconds *int `json:"countdown_seconds,omitempty"`
+}
+
+// BreakoutInfo describes an open breakout room
+type BreakoutInfo struct {
+	RoomID  string   `json:"room_id"`
+	Name    string   `json:"name"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// BreakoutsData is the payload of breakouts_started and breakouts_updated events
+type BreakoutsData struct {
+	ParentID  string         `json:"parent_id"`
+	Breakouts []BreakoutInfo `json:"breakouts"`
+	EndsAt    *time.Time     `json:"ends_at,omitempty"`
+	ChangedBy string         `json:"changed_by"`
+}
+
+// BreakoutsEndedData is the payload of a breakouts_ended event
+type BreakoutsEndedData struct {
+	ParentID string `json:"parent_id"`
+	EndedBy  string `json:"ended_by"`
+}
+
+// BreakoutMoveData is the payload of breakout_assigned and breakout_move
+// events. Clients reconnect to RoomID when they receive breakout_move.
+type BreakoutMoveData struct {
+	RoomID           string    `json:"room_id"`
+	Name             string    `json:"name"`
+	ParentID         string    `json:"parent_id"`
+	CountdownSeconds int       `json:"countdown_seconds"`
+	MoveAt           time.Time `json:"move_at"`
+}
+
+// BreakoutMessageData is the payload of a breakout_message event
+type BreakoutMessageData struct {
+	Message string          `json:"message"`
+	From    ModerationActor `json:"from"`
+	SentAt  time.Time       `json:"sent_at"`
+}
+
+// BreakoutsEndingData is the payload of breakouts_ending and breakout_return events
+type BreakoutsEndingData struct {
+	ParentID         string    `json:"parent_id"`
+	CountdownSeconds int       `json:"countdown_seconds"`
+	ReturnAt         time.Time `json:"return_at"`
+	EndedBy          string    `json:"ended_by"`
+}
+
+// handleBreakout runs a breakout command, which needs the manage_breakouts
+// capability
+func (r *Room) handleBreakout(c *chat.Client, signal *webrtc.SignalMessage) {
+	if !r.require(c, signal.Type, chat.CapManageBreakouts) {
+		return
+	}
+	
+	// Commands from inside a breakout act on its parent
+	parent := r
+	if r.Parent != nil {
+		parent = r.Parent
+	}
+	
+	switch signal.Type {
+	case SignalBreakoutStart:
+		parent.handleBreakoutStart(r, c, signal)
+	case SignalBreakoutAssign:
+		parent.handleBreakoutAssign(r, c, signal)
+	case SignalBreakoutBroadcast:
+		parent.handleBreakoutBroadcast(r, c, signal)
+	case SignalBreakoutJoin:
+		parent.handleBreakoutJoin(r, c, signal)
+	case SignalBreakoutEnd:
+		var request BreakoutEndData
+		if len(signal.Data) > 0 {
+			if err := json.Unmarshal(signal.Data, &request); err != nil {
+				r.sendError(c, signal.Type, ErrCodeInvalidMessage, "breakout_end takes countdown_seconds")
+				return
+			}
+		}
+	
+		if err := parent.endBreakouts(countdown(request.CountdownSeconds), c.Info.ID); err != nil {
+			r.sendError(c, signal.Type, ErrCodeSignalFailed, err.Error())
+		}
+	}
+}
+
+// handleBreakoutStart opens breakout rooms and sends the assigned
+// participants to them. from is the room the command was sent in.
+func (r *Room) handleBreakoutStart(from *Room, c *chat.Client, signal *webrtc.SignalMessage) {
+	var request BreakoutStartData
+	if err := json.Unmarshal(signal.Data, &request); err != nil {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, "breakout_start needs count")
+		return
+	}
+	if request.Count < 1 || request.Count > maxBreakouts {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, fmt.Sprintf("count must be between 1 and %d", maxBreakouts))
+		return
+	}
+	if len(request.Names) > request.Count {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, "More names than breakout rooms")
+		return
+	}
+	if request.DurationSeconds < 0 {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, "duration_seconds cannot be negative")
+		return
+	}
+	for userID, index := range request.Assignments {
+		if index < 0 || index >= request.Count {
+			from.sendError(c, signal.Type, ErrCodeInvalidMessage, fmt.Sprintf("Breakout %d for user %s does not exist", index, userID))
+			return
+		}
+	}
+	
+	// Breakouts inherit the parent's owner, course and chat setting and have no lobby
+	config := r.RTC.GetConfig()
+	meta := r.GetMetadata()
+	children := make([]*Room, request.Count)
+	rtcChildren := make([]*webrtc.Room, request.Count)
+	for i := range children {
+		name := fmt.Sprintf("Breakout %d", i+1)
+		if i < len(request.Names) && request.Names[i] != "" {
+			name = request.Names[i]
+		}
+	
+		children[i] = newRoom(uuid.New().String(), RoomMetadata{
+			Name:     name,
+			OwnerID:  meta.OwnerID,
+			CourseID: meta.CourseID,
+		}, webrtc.RoomConfig{
+			EnableChat: config.EnableChat,
+		}, r)
+		rtcChildren[i] = children[i].RTC
+	}
+	
+	duration := time.Duration(request.DurationSeconds) * time.Second
+	if err := r.RTC.StartBreakouts(rtcChildren, duration); err != nil {
+		for _, child := range children {
+			child.close(c.Info.ID)
+		}
+		from.sendError(c, signal.Type, ErrCodeSignalFailed, err.Error())
+		return
+	}
+	
+	r.mutex.Lock()
+	r.breakouts = children
+	r.breakoutsEnding = false
+	r.mutex.Unlock()
+	
+	for userID, index := range request.Assignments {
+		if err := r.RTC.AssignBreakout(userID, children[index].ID); err != nil {
+			from.sendError(c, signal.Type, ErrCodeSignalFailed, fmt.Sprintf("%s: %v", userID, err))
+		}
+	}
+	if request.Random {
+		if _, err := r.RTC.AssignBreakoutsRandomly(r.unassignedUsers()); err != nil {
+			from.sendError(c, signal.Type, ErrCodeSignalFailed, err.Error())
+		}
+	}
+	
+	r.broadcastEvent("breakouts_started", r.breakoutsData(c.Info.ID))
+	
+	wait := countdown(request.CountdownSeconds)
+	for userID := range r.RTC.GetAssignments() {
+		r.sendToBreakout(userID, wait)
+	}
+}
+
+// handleBreakoutAssign moves one user to a breakout while breakouts are open
+func (r *Room) handleBreakoutAssign(from *Room, c *chat.Client, signal *webrtc.SignalMessage) {
+	var request BreakoutAssignData
+	if err := json.Unmarshal(signal.Data, &request); err != nil || request.UserID == "" || request.RoomID == "" {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, "breakout_assign needs user_id and room_id")
+		return
+	}
+	
+	if err := r.RTC.AssignBreakout(request.UserID, request.RoomID); err != nil {
+		from.sendError(c, signal.Type, ErrCodeSignalFailed, err.Error())
+		return
+	}
+	
+	r.broadcastEvent("breakouts_updated", r.breakoutsData(c.Info.ID))
+	r.sendToBreakout(request.UserID, countdown(request.CountdownSeconds))
+}
+
+// handleBreakoutBroadcast sends a moderator message to the parent room and every breakout
+func (r *Room) handleBreakoutBroadcast(from *Room, c *chat.Client, signal *webrtc.SignalMessage) {
+	var request BreakoutBroadcastData
+	if err := json.Unmarshal(signal.Data, &request); err != nil || request.Message == "" {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, "breakout_broadcast needs message")
+		return
+	}
+	
+	from.mutex.RLock()
+	sender, exists := from.Peers[c.Info.ID]
+	from.mutex.RUnlock()
+	
+	if !exists {
+		return
+	}
+	
+	message := BreakoutMessageData{
+		Message: request.Message,
+		From: ModerationActor{
+			PeerID:   sender.ID,
+			UserID:   sender.UserID,
+			Username: sender.Username,
+		},
+		SentAt: time.Now(),
+	}
+	
+	r.broadcastEvent("breakout_message", message)
+	for _, child := range r.openBreakouts() {
+		child.broadcastEvent("breakout_message", message)
+	}
+}
+
+// handleBreakoutJoin sends a moderator to a breakout, or back to the parent, at once
+func (r *Room) handleBreakoutJoin(from *Room, c *chat.Client, signal *webrtc.SignalMessage) {
+	var request BreakoutJoinData
+	if err := json.Unmarshal(signal.Data, &request); err != nil || request.RoomID == "" {
+		from.sendError(c, signal.Type, ErrCodeInvalidMessage, "breakout_join needs room_id")
+		return
+	}
+	
+	target := r.findBreakout(request.RoomID)
+	if target == nil {
+		from.sendError(c, signal.Type, ErrCodeSignalFailed, webrtc.ErrUnknownBreakout.Error())
+		return
+	}
+	
+	r.rememberRole(c.Info.UserID, from)
+	from.sendEvent(c, "breakout_move", BreakoutMoveData{
+		RoomID:   target.ID,
+		Name:     target.RTC.Name,
+		ParentID: r.ID,
+		MoveAt:   time.Now(),
+	})
+}
+
+// sendToBreakout warns a user's clients in the parent and the breakouts that
+// they are moving, then tells them to move once the countdown is over
+func (r *Room) sendToBreakout(userID string, wait time.Duration) {
+	rtcChild, assigned := r.RTC.BreakoutFor(userID)
+	if !assigned {
+		return
+	}
+	
+	r.rememberRole(userID, r)
+	
+	move := BreakoutMoveData{
+		RoomID:           rtcChild.ID,
+		Name:             rtcChild.Name,
+		ParentID:         r.ID,
+		CountdownSeconds: int(wait.Seconds()),
+		MoveAt:           time.Now().Add(wait),
+	}
+	
+	r.sendToUser(userID, "breakout_assigned", move)
+	time.AfterFunc(wait, func() {
+		// A later assignment or the end of the breakouts supersedes this move
+		if current, ok := r.RTC.BreakoutFor(userID); !ok || current.ID != move.RoomID {
+			return
+		}
+	
+		move.CountdownSeconds = 0
+		r.sendToUser(userID, "breakout_move", move)
+	})
+}
+
+// sendToUser sends an event to every client of a user in the parent room and
+// its breakouts, except the breakout the user is already in
+func (r *Room) sendToUser(userID, event string, data interface{}) {
+	rooms := append([]*Room{r}, r.openBreakouts()...)
+	
+	target := ""
+	if move, ok := data.(BreakoutMoveData); ok {
+		target = move.RoomID
+	}
+	
+	for _, room := range rooms {
+		if room.ID == target {
+			continue
+		}
+	
+		room.mutex.RLock()
+		for _, peer := range room.Peers {
+			if peer.UserID == userID {
+				room.sendEvent(peer.Client, event, data)
+			}
+		}
+		room.mutex.RUnlock()
+	}
+}
+
+// endBreakouts warns everyone in the breakouts, then sends them back to the
+// parent room and closes the breakouts once the countdown is over
+func (r *Room) endBreakouts(wait time.Duration, endedBy string) error {
+	r.mutex.Lock()
+	if len(r.breakouts) == 0 {
+		r.mutex.Unlock()
+		return webrtc.ErrNoBreakouts
+	}
+	if r.breakoutsEnding {
+		r.mutex.Unlock()
+		return fmt.Errorf("breakout rooms are already ending")
+	}
+	r.breakoutsEnding = true
+	children := r.breakouts
+	r.mutex.Unlock()
+	
+	ending := BreakoutsEndingData{
+		ParentID:         r.ID,
+		CountdownSeconds: int(wait.Seconds()),
+		ReturnAt:         time.Now().Add(wait),
+		EndedBy:          endedBy,
+	}
+	for _, child := range children {
+		child.broadcastEvent("breakouts_ending", ending)
+	}
+	
+	time.AfterFunc(wait, func() {
+		ending.CountdownSeconds = 0
+		for _, child := range children {
+			child.broadcastEvent("breakout_return", ending)
+		}
+	
+		r.closeBreakouts(endedBy)
+		r.broadcastEvent("breakouts_ended", BreakoutsEndedData{
+			ParentID: r.ID,
+			EndedBy:  endedBy,
+		})
+	})
+	
+	return nil
+}
+
+// closeBreakouts closes every breakout of the room at once
+func (r *Room) closeBreakouts(closedBy string) {
+	r.mutex.Lock()
+	children := r.breakouts
+	r.breakouts = nil
+	r.breakoutsEnding = false
+	r.mutex.Unlock()
+	
+	if len(children) == 0 {
+		return
+	}
+	
+	r.RTC.EndBreakouts()
+	for _, child := range children {
+		child.close(closedBy)
+	}
+}
+
+// openBreakouts returns the open breakouts of the room
+func (r *Room) openBreakouts() []*Room {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return append([]*Room(nil), r.breakouts...)
+}
+
+// findBreakout returns the room itself or one of its open breakouts by ID
+func (r *Room) findBreakout(roomID string) *Room {
+	if roomID == r.ID {
+		return r
+	}
+	
+	for _, child := range r.openBreakouts() {
+		if child.ID == roomID {
+			return child
+		}
+	}
+	return nil
+}
+
+// breakoutsData describes the open breakouts and who is assigned to each
+func (r *Room) breakoutsData(changedBy string) BreakoutsData {
+	assignments := r.RTC.GetAssignments()
+	
+	data := BreakoutsData{
+		ParentID:  r.ID,
+		Breakouts: []BreakoutInfo{},
+		ChangedBy: changedBy,
+	}
+	for _, child := range r.openBreakouts() {
+		info := BreakoutInfo{RoomID: child.ID, Name: child.RTC.Name, UserIDs: []string{}}
+		for userID, breakoutID := range assignments {
+			if breakoutID == child.ID {
+				info.UserIDs = append(info.UserIDs, userID)
+			}
+		}
+		data.Breakouts = append(data.Breakouts, info)
+	}
+	
+	if endsAt := r.RTC.GetBreakoutsEndAt(); !endsAt.IsZero() {
+		data.EndsAt = &endsAt
+	}
+	
+	return data
+}
+
+// unassignedUsers lists the users in the room who are not assigned to a
+// breakout and do not run the breakouts
+func (r *Room) unassignedUsers() []string {
+	assignments := r.RTC.GetAssignments()
+	
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, peer := range r.Peers {
+		if peer.Role.Can(chat.CapManageBreakouts) || seen[peer.UserID] {
+			continue
+		}
+		if _, assigned := assignments[peer.UserID]; assigned {
+			continue
+		}
+	
+		seen[peer.UserID] = true
+		userIDs = append(userIDs, peer.UserID)
+	}
+	return userIDs
+}
+
+// rememberRole records the role a user has in room, the parent or one of its
+// breakouts, so the user keeps it when moving between them
+func (r *Room) rememberRole(userID string, room *Room) {
+	room.mutex.RLock()
+	var role chat.Role
+	for _, peer := range room.Peers {
+		if peer.UserID == userID {
+			role = peer.Role
+			break
+		}
+	}
+	room.mutex.RUnlock()
+	
+	if role == "" {
+		return
+	}
+	
+	r.mutex.Lock()
+	r.breakoutRoles[userID] = role
+	r.mutex.Unlock()
+}
+
+// breakoutRole returns the role a user joining one of the room's breakouts
+// had in the room, or fallback when unknown
+func (r *Room) breakoutRole(userID string, fallback chat.Role) chat.Role {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	for _, peer := range r.Peers {
+		if peer.UserID == userID {
+			return peer.Role
+		}
+	}
+	if role, known := r.breakoutRoles[userID]; known {
+		return role
+	}
+	return fallback
+}
+
+// mayEnterBreakout reports whether a user may join the breakout: users
+// assigned to it and those who run the breakouts
+func (r *Room) mayEnterBreakout(user *chat.ClientInfo) bool {
+	parent := r.Parent
+	if parent.isBanned(user.UserID) {
+		return false
+	}
+	
+	if child, assigned := parent.RTC.BreakoutFor(user.UserID); assigned && child.ID == r.ID {
+		return true
+	}
+	
+	return parent.breakoutRole(user.UserID, parent.roleFor(user)).Can(chat.CapManageBreakouts)
+}
+
+// countdown converts an optional countdown in seconds, falling back to the default
+func countdown(seconds *int) time.Duration {
+	if seconds == nil || *seconds < 0 {
+		return defaultBreakoutCountdown
+	}
+	return time.Duration(*seconds) * time.Second
+}
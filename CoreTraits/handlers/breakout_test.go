@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestBreakoutsEndWhenTimeIsUp(t *testing.T) {
+	base := testServer(t)
+
+	room := newRoom("breakout-room", RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{}, nil)
+	t.Cleanup(func() {
+		room.close("test")
+		roomManager.Remove(room.ID)
+	})
+
+	alice := dialTest(t, base+"/room/breakout-room/websocket?u=alice")
+	readEvent(t, alice, "room_joined", nil)
+	bob := dialTest(t, base+"/room/breakout-room/websocket?u=bob")
+	readEvent(t, bob, "room_joined", nil)
+
+	send(t, alice, `{"type":"breakout_start","data":{"count":2,"assignments":{"bob":1},"duration_seconds":2,"countdown_seconds":0}}`)
+	var started BreakoutsData
+	readEvent(t, alice, "breakouts_started", &started)
+	if len(started.Breakouts) != 2 || started.EndsAt == nil {
+		t.Fatalf("breakouts_started = %+v, want two timed breakouts", started)
+	}
+
+	var move BreakoutMoveData
+	readEvent(t, bob, "breakout_move", &move)
+	if move.RoomID != started.Breakouts[1].RoomID || move.ParentID != room.ID {
+		t.Fatalf("bob was moved to %s, want the second breakout", move.RoomID)
+	}
+
+	breakout := dialTest(t, base+"/room/"+move.RoomID+"/websocket?u=bob")
+	readEvent(t, breakout, "room_joined", nil)
+
+	// The timer fires at the announced end, not a countdown later
+	var ending BreakoutsEndingData
+	readEvent(t, breakout, "breakout_return", &ending)
+	if ending.EndedBy != "timer" || ending.ParentID != room.ID {
+		t.Errorf("breakout_return = %+v, want a return to the parent ended by the timer", ending)
+	}
+	if late := time.Since(*started.EndsAt); late > time.Second {
+		t.Errorf("breakouts returned %v after they were due", late)
+	}
+
+	var ended BreakoutsEndedData
+	readEvent(t, alice, "breakouts_ended", &ended)
+	if ended.EndedBy != "timer" {
+		t.Errorf("breakouts_ended by %s, want the timer", ended.EndedBy)
+	}
+	readClosed(t, breakout)
+
+	if _, open := roomManager.Get(move.RoomID); open {
+		t.Error("the breakout room is still registered")
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/access"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Active configuration, replaced at startup by Configure
+var cfg = config.Default()
+
+// Configure sets the configuration used by all handlers. Call before serving.
+func Configure(c *config.Config) {
+	cfg = c
+	
+	accessThrottle = newThrottle(c.Access)
+	inviter = access.NewInviter(c.Access.InviteSecret, c.Access.InviteTTL.Std())
+}
+
+// ConfigView returns the effective configuration with secrets redacted.
+// Requires the admin token as a bearer token; disabled when no token is configured.
+func ConfigView(c *fiber.Ctx) error {
+	if cfg.Admin.Token == "" {
+		return c.Status(403).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Admin endpoints are disabled",
+		})
+	}
+	
+	header := c.Get(fiber.HeaderAuthorization)
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Admin.Token)) != 1 {
+		return c.Status(401).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid admin token",
+		})
+	}
+	
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"config": cfg.Redacted(),
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// Events lists the events sent to room and stream websocket clients, and the
+// events handlers announce over peer data channels
+var Events = []events.Spec{
+	events.Event("room_joined", "Sent to a new peer with its peer ID and what its role allows", RoomJoinedData{}),
+	events.Event("peer_joined", "A peer joined the room", PeerJoinedData{}),
+	events.Event("peer_left", "A peer left the room", PeerLeftData{}),
+	events.Event("peer_reconnecting", "A peer's connection dropped; it keeps its place until it resumes or its grace runs out", PeerReconnectingData{}),
+	events.Event("peer_resumed", "A reconnecting peer resumed on a new connection", PeerResumedData{}),
+	events.Event("viewer_joined", "A viewer joined the room or stream", ViewerEventData{}),
+	events.Event("viewer_left", "A viewer left the stream", ViewerEventData{}),
+	events.Event("error", "Sent to a client that could not join before it is disconnected", JoinErrorData{}),
+	events.Event("peer_media_changed", "A peer's audio, video or screen share changed", MediaStateData{}),
+	events.Event("role_changed", "A peer's role changed", RoleChangedData{}),
+	events.Event("room_settings_updated", "The room's chat, participant limit or lobby setting changed", RoomSettingsUpdatedData{}),
+	events.Event("room_updated", "The room's name, tags or course changed", RoomUpdatedData{}),
+	events.Event("room_closed", "The room was closed and clients are about to be disconnected", RoomClosedData{}),
+	events.Event("room_expiring", "The room's lifetime is about to run out", RoomExpiringData{}),
+	events.Event("room_expired", "The room expired and is being closed", RoomExpiredData{}),
+	events.Event("session_starting_soon", "A scheduled room or stream starts soon", SessionStartingSoonData{}),
+	events.Event("lobby_status", "Sent to a joiner waiting in the lobby", LobbyStatusData{}),
+	events.Event("lobby_join_request", "Sent to moderators when a joiner starts waiting in the lobby", LobbyRequestData{}),
+	events.Event("lobby_updated", "Sent to moderators when the lobby changes", LobbyUpdatedData{}),
+	events.Event("peer_moderated", "A moderator acted on a peer", PeerModeratedData{}),
+	events.Event("hand_raised", "A peer raised their hand", HandEventData{}),
+	events.Event("hand_lowered", "A peer's hand was lowered", HandEventData{}),
+	events.Event("speaker_called", "A moderator called on a peer with a raised hand", HandEventData{}),
+	events.Event("breakouts_started", "Breakout rooms were opened", BreakoutsData{}),
+	events.Event("breakouts_updated", "Breakout assignments changed", BreakoutsData{}),
+	events.Event("breakout_message", "A moderator messaged every breakout room", BreakoutMessageData{}),
+	events.Event("breakout_assigned", "Sent to a user assigned to a breakout room before they are moved to it", BreakoutMoveData{}),
+	events.Event("breakout_move", "Sent to a user moved to another breakout room", BreakoutMoveData{}),
+	events.Event("breakouts_ending", "Breakout rooms are about to close", BreakoutsEndingData{}),
+	events.Event("breakout_return", "Breakout rooms closed and peers should return to the parent room", BreakoutsEndingData{}),
+	events.Event("breakouts_ended", "Every breakout room was closed", BreakoutsEndedData{}),
+	events.Event("streamer_connected", "The streamer connected to the stream", StreamerConnectedData{}),
+	events.Event("streamer_message", "A JSON frame the streamer sent to the stream's viewers", StreamerMessageData{}),
+	events.Event("stream_started", "The stream went live", StreamStatusData{}),
+	events.Event("stream_paused", "The stream was paused", StreamStatusData{}),
+	events.Event("stream_resumed", "The paused stream went live again", StreamStatusData{}),
+	events.Event("stream_ended", "The stream ended", StreamStatusData{}),
+	events.Event("settings_updated", "The stream's settings changed", StreamSettingsUpdatedData{}),
+	events.Event("server_shutting_down", "The server is restarting and clients should reconnect later", ShutdownData{}),
+	webrtc.RoomEventSpec("room_expiring", "The room's lifetime is about to run out", RoomExpiringData{}),
+	webrtc.RoomEventSpec("room_expired", "The room expired and is being closed", RoomExpiredData{}),
+	webrtc.RoomEventSpec("session_starting_soon", "The scheduled room starts soon", SessionStartingSoonData{}),
+	webrtc.RoomEventSpec("server_shutting_down", "The server is restarting and clients should reconnect later", ShutdownData{}),
+}
+
+// eventCatalogue holds every event the server sends
+var eventCatalogue = events.NewCatalogue(Events, chat.Events, webrtc.Events)
+
+// EventSchemas lists every event the server sends with its JSON Schema
+func EventSchemas(c *fiber.Ctx) error {
+	list := make([]fiber.Map, 0)
+	for _, id := range eventCatalogue.Names() {
+		spec, _ := eventCatalogue.Get(id)
+		list = append(list, fiber.Map{
+			"id":          id,
+			"name":        spec.Name,
+			"channel":     spec.Channel,
+			"description": spec.Description,
+			"schema":      spec.Schema(),
+		})
+	}
+	
+	return c.JSON(fiber.Map{
+		"success": true,
+		"events":  list,
+	})
+}
+
+// EventSchema returns the JSON Schema of one event, for generating decoders
+func EventSchema(c *fiber.Ctx) error {
+	spec, exists := eventCatalogue.Get(c.Params("name"))
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"message": "Event not found",
+		})
+	}
+	
+	return c.JSON(spec.Schema(), "application/schema+json")
+}
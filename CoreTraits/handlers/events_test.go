@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// eventSenders are the functions taking an event name, with the channel the
+// event is sent over
+var eventSenders = map[string]string{
+	"broadcastEvent":     "",
+	"sendEvent":          "",
+	"sendToUser":         "",
+	"publishViewerEvent": "",
+	"Encode":             "",
+	"Announce":           events.ChannelRoomData,
+}
+
+// sentEvents returns the IDs of the events named by string literals in the
+// package's calls to event senders, and those assigned to variables named
+// event, with where each is sent from
+func sentEvents(t *testing.T) map[string]string {
+	t.Helper()
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	sent := make(map[string]string)
+	record := func(channel string, lit ast.Expr) {
+		basic, ok := lit.(*ast.BasicLit)
+		if !ok || basic.Kind != token.STRING {
+			return
+		}
+		name, err := strconv.Unquote(basic.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := events.Spec{Channel: channel, Name: name}.ID()
+		sent[id] = fset.Position(basic.Pos()).String()
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ast.Inspect(parsed, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				selector, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				channel, ok := eventSenders[selector.Sel.Name]
+				if !ok {
+					return true
+				}
+				for _, arg := range n.Args {
+					if basic, ok := arg.(*ast.BasicLit); ok && basic.Kind == token.STRING {
+						record(channel, arg)
+						break
+					}
+				}
+			case *ast.AssignStmt:
+				for i, lhs := range n.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok && ident.Name == "event" && i < len(n.Rhs) {
+						record("", n.Rhs[i])
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	return sent
+}
+
+func TestSentEventsAreCatalogued(t *testing.T) {
+	sent := sentEvents(t)
+
+	// Guard against the scan silently finding nothing
+	for _, id := range []string{"breakout_assigned", "stream_started", "room_data.room_expiring", "error"} {
+		if _, ok := sent[id]; !ok {
+			t.Errorf("scan did not find %s being sent", id)
+		}
+	}
+
+	for id, position := range sent {
+		if _, ok := eventCatalogue.Get(id); !ok {
+			t.Errorf("%s: event %s is sent but missing from the catalogue", position, id)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// Signal types for the raise-hand queue
+const (
+	SignalRaiseHand = "raise_hand"
+	SignalLowerHand = "lower_hand"
+	SignalCallNext  = "call_next"
+)
+
+// RaisedHand is a peer waiting for a turn to speak
+type RaisedHand struct {
+	PeerID   string    `json:"peer_id"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	RaisedAt time.Time `json:"raised_at"`
+}
+
+// LowerHandData is the payload of a lower_hand frame. Without peer_id the
+// sender lowers its own hand.
+type LowerHandData struct {
+	PeerID string `json:"peer_id,omitempty"`
+}
+
+// CallNextData is the payload of a call_next frame
+type CallNextData struct {
+	Unmute bool `json:"unmute,omitempty"`
+}
+
+// HandEventData is the payload of hand_raised, hand_lowered and
+// speaker_called events, carrying the queue after the change
+type HandEventData struct {
+	PeerID   string       `json:"peer_id"`
+	UserID   string       `json:"user_id"`
+	Username string       `json:"username"`
+	By       string       `json:"by,omitempty"`
+	Unmuted  bool         `json:"unmuted,omitempty"`
+	Queue    []RaisedHand `json:"queue"`
+}
+
+// handleRaiseHand puts the sender at the back of the queue
+func (r *Room) handleRaiseHand(c *chat.Client, signal *webrtc.SignalMessage) {
+	r.mutex.Lock()
+	peer, exists := r.Peers[c.Info.ID]
+	if !exists || r.handIndex(c.Info.ID) >= 0 {
+		r.mutex.Unlock()
+		return
+	}
+	
+	r.hands = append(r.hands, RaisedHand{
+		PeerID:   peer.ID,
+		UserID:   peer.UserID,
+		Username: peer.Username,
+		RaisedAt: time.Now(),
+	})
+	queue := r.handQueue()
+	r.mutex.Unlock()
+	
+	r.broadcastEvent("hand_raised", HandEventData{
+		PeerID:   peer.ID,
+		UserID:   peer.UserID,
+		Username: peer.Username,
+		Queue:    queue,
+	})
+}
+
+// handleLowerHand takes a hand out of the queue. Lowering someone else's hand
+// needs the manage_hands capability.
+func (r *Room) handleLowerHand(c *chat.Client, signal *webrtc.SignalMessage) {
+	var request LowerHandData
+	if len(signal.Data) > 0 {
+		if err := json.Unmarshal(signal.Data, &request); err != nil {
+			r.sendError(c, signal.Type, ErrCodeInvalidMessage, "lower_hand takes peer_id")
+			return
+		}
+	}
+	
+	peerID := request.PeerID
+	if peerID == "" {
+		peerID = c.Info.ID
+	}
+	if peerID != c.Info.ID && !r.require(c, signal.Type, chat.CapManageHands) {
+		return
+	}
+	
+	if !r.lowerHand(peerID, c.Info.ID) && peerID != c.Info.ID {
+		r.sendError(c, signal.Type, ErrCodePeerNotFound, "Peer has no raised hand")
+	}
+}
+
+// lowerHand removes a peer's hand from the queue and announces it. It
+// reports whether the hand was raised.
+func (r *Room) lowerHand(peerID, by string) bool {
+	r.mutex.Lock()
+	index := r.handIndex(peerID)
+	if index < 0 {
+		r.mutex.Unlock()
+		return false
+	}
+	
+	hand := r.hands[index]
+	r.hands = append(r.hands[:index], r.hands[index+1:]...)
+	queue := r.handQueue()
+	r.mutex.Unlock()
+	
+	r.broadcastEvent("hand_lowered", HandEventData{
+		PeerID:   hand.PeerID,
+		UserID:   hand.UserID,
+		Username: hand.Username,
+		By:       by,
+		Queue:    queue,
+	})
+	
+	return true
+}
+
+// handleCallNext gives the floor to the first peer in the queue, optionally
+// letting its audio through again
+func (r *Room) handleCallNext(c *chat.Client, signal *webrtc.SignalMessage) {
+	if !r.require(c, signal.Type, chat.CapManageHands) {
+		return
+	}
+	
+	var request CallNextData
+	if len(signal.Data) > 0 {
+		if err := json.Unmarshal(signal.Data, &request); err != nil {
+			r.sendError(c, signal.Type, ErrCodeInvalidMessage, "call_next takes unmute")
+			return
+		}
+	}
+	
+	r.mutex.Lock()
+	if len(r.hands) == 0 {
+		r.mutex.Unlock()
+		r.sendError(c, signal.Type, ErrCodePeerNotFound, "No hands are raised")
+		return
+	}
+	
+	hand := r.hands[0]
+	r.hands = r.hands[1:]
+	queue := r.handQueue()
+	
+	// Only roles that may publish audio can be unmuted
+	unmute := false
+	speaker, exists := r.Peers[hand.PeerID]
+	if request.Unmute && exists && speaker.Role.Can(chat.CapPublishAudio) {
+		delete(speaker.forcedOff, webrtc.MediaAudio)
+		speaker.Settings.Audio = true
+		unmute = true
+	}
+	r.mutex.Unlock()
+	
+	if unmute {
+		if err := r.RTC.SetPeerMedia(hand.PeerID, webrtc.MediaAudio, true); err != nil {
+			unmute = false
+		}
+	}
+	
+	r.broadcastEvent("speaker_called", HandEventData{
+		PeerID:   hand.PeerID,
+		UserID:   hand.UserID,
+		Username: hand.Username,
+		By:       c.Info.ID,
+		Unmuted:  unmute,
+		Queue:    queue,
+	})
+}
+
+// handIndex returns the queue position of a peer's hand, counting from 0, or
+// -1 when it is not raised. The caller must hold the lock.
+func (r *Room) handIndex(peerID string) int {
+	for i, hand := range r.hands {
+		if hand.PeerID == peerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// handQueue returns a copy of the raised hands in order. The caller must hold the lock.
+func (r *Room) handQueue() []RaisedHand {
+	return append([]RaisedHand{}, r.hands...)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestRaiseHandQueue(t *testing.T) {
+	base := testServer(t)
+
+	room := newRoom("hands-room", RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{}, nil)
+	t.Cleanup(func() {
+		room.close("test")
+		roomManager.Remove(room.ID)
+	})
+
+	alice := dialTest(t, base+"/room/hands-room/websocket?u=alice")
+	readEvent(t, alice, "room_joined", nil)
+	var bobJoined, carolJoined RoomJoinedData
+	bob := dialTest(t, base+"/room/hands-room/websocket?u=bob")
+	readEvent(t, bob, "room_joined", &bobJoined)
+	carol := dialTest(t, base+"/room/hands-room/websocket?u=carol")
+	readEvent(t, carol, "room_joined", &carolJoined)
+
+	var hand HandEventData
+	send(t, bob, `{"type":"raise_hand"}`)
+	readEvent(t, alice, "hand_raised", &hand)
+	send(t, carol, `{"type":"raise_hand"}`)
+	readEvent(t, alice, "hand_raised", &hand)
+	if len(hand.Queue) != 2 || hand.Queue[0].PeerID != bobJoined.PeerID || hand.Queue[1].PeerID != carolJoined.PeerID {
+		t.Fatalf("queue = %+v, want bob then carol", hand.Queue)
+	}
+
+	// Participants may not run the queue or lower other hands
+	send(t, bob, `{"type":"call_next"}`)
+	readEvent(t, bob, "error", nil)
+	send(t, bob, `{"type":"lower_hand","data":{"peer_id":"`+carolJoined.PeerID+`"}}`)
+	readEvent(t, bob, "error", nil)
+
+	send(t, alice, `{"type":"call_next"}`)
+	readEvent(t, bob, "speaker_called", &hand)
+	if hand.PeerID != bobJoined.PeerID || len(hand.Queue) != 1 || hand.Queue[0].PeerID != carolJoined.PeerID {
+		t.Errorf("speaker_called = %+v, want bob called with carol still waiting", hand)
+	}
+
+	send(t, carol, `{"type":"lower_hand"}`)
+	readEvent(t, alice, "hand_lowered", &hand)
+	if hand.PeerID != carolJoined.PeerID || hand.By != carolJoined.PeerID || len(hand.Queue) != 0 {
+		t.Errorf("hand_lowered = %+v, want carol's own hand lowered and the queue empty", hand)
+	}
+
+	send(t, alice, `{"type":"call_next"}`)
+	readEvent(t, alice, "error", nil)
+}
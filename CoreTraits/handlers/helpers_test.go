@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+// testServer serves the room and stream websockets on a loopback port and
+// returns its ws:// base URL. Instead of checking a token, it takes the
+// user from the u query parameter and the token's role from r.
+func testServer(t *testing.T) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		// Query values point into the request, which Fiber reuses
+		user := strings.Clone(c.Query("u"))
+		role := chat.Role(strings.Clone(c.Query("r")))
+		c.Locals(identityKey, &chat.ClientInfo{UserID: user, Username: user, Role: role})
+		return c.Next()
+	})
+	app.Get("/room/:uuid/websocket", websocket.New(RoomWebsocket))
+	app.Get("/room/:uuid/viewer/websocket", websocket.New(RoomViewerWebsocket))
+	app.Get("/stream/:ssuid/websocket", websocket.New(StreamWebsocket))
+	app.Get("/stream/:ssuid/chat/websocket", websocket.New(StreamChatWebsocket))
+	app.Get("/stream/:ssuid/viewer/websocket", websocket.New(StreamViewerWebsocket))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { ln.Close() })
+
+	return "ws://" + ln.Addr().String()
+}
+
+// waitHandlers waits for every websocket handler to return, so settings
+// they read can be changed without racing them
+func waitHandlers(t *testing.T) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		connections.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("websocket handlers are still running")
+	}
+}
+
+// dialTest opens a websocket that is closed when the test ends
+func dialTest(t *testing.T, url string) *fws.Conn {
+	t.Helper()
+
+	conn, _, err := fws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial(%s) = %v", url, err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		delete(unread, conn)
+	})
+
+	return conn
+}
+
+// send writes a frame to a websocket
+func send(t *testing.T, conn *fws.Conn, frame string) {
+	t.Helper()
+
+	if err := conn.WriteMessage(fws.TextMessage, []byte(frame)); err != nil {
+		t.Fatalf("WriteMessage(%s) = %v", frame, err)
+	}
+}
+
+// testFrame is an event or signaling frame as clients receive it
+type testFrame struct {
+	Event string          `json:"event"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// readEvent reads frames until an event or signal named name arrives and
+// decodes its data into data, if given. It fails the test if none arrives
+// within a few seconds.
+func readEvent(t *testing.T, conn *fws.Conn, name string, data interface{}) {
+	t.Helper()
+
+	var frame testFrame
+	if err := json.Unmarshal(readFrame(t, conn, name), &frame); err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(frame.Data, data); err != nil {
+			t.Fatalf("decoding %s: %v", name, err)
+		}
+	}
+}
+
+// unread holds the frames of a batched message after the one a test read
+var unread = make(map[*fws.Conn][][]byte)
+
+// readFrame reads frames until an event or signal named name arrives and
+// returns it as sent. It fails the test if none arrives within a few seconds.
+func readFrame(t *testing.T, conn *fws.Conn, name string) []byte {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if len(unread[conn]) == 0 {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("waiting for %s: %v", name, err)
+			}
+
+			// The write pump batches queued frames into one message
+			unread[conn] = bytes.Split(message, []byte("\n"))
+		}
+
+		line := unread[conn][0]
+		unread[conn] = unread[conn][1:]
+
+		var frame testFrame
+		if json.Unmarshal(line, &frame) == nil && (frame.Event == name || frame.Type == name) {
+			return line
+		}
+	}
+}
+
+// readClosed reads frames until the server closes the websocket, failing
+// the test if it is still open after a few seconds
+func readClosed(t *testing.T, conn *fws.Conn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("websocket is still open")
+		}
+		return
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Reasons a room is closed by the janitor
+const (
+	ExpiryLifetime = "lifetime"
+	ExpirySchedule = "schedule"
+	ExpiryIdle     = "idle"
+)
+
+// RoomExpiringData is the payload of a room_expiring event
+type RoomExpiringData struct {
+	RoomID           string    `json:"room_id"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RemainingSeconds int       `json:"remaining_seconds"`
+}
+
+// RoomExpiredData is the payload of a room_expired event
+type RoomExpiredData struct {
+	RoomID    string    `json:"room_id"`
+	Reason    string    `json:"reason"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// RunJanitor closes expired and abandoned rooms and ended streams every
+// janitor interval until ctx is done
+func RunJanitor(ctx context.Context) {
+	ticker := time.NewTicker(cfg.Janitor.Interval.Std())
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweep(now)
+		}
+	}
+}
+
+// sweep checks every room and stream once
+func sweep(now time.Time) {
+	for _, room := range roomManager.List() {
+		room.sweep(now)
+	}
+	
+	for _, stream := range streamManager.List() {
+		stream.sweep(now)
+	}
+}
+
+// sweep reminds the room's clients before a scheduled start, warns them
+// before its lifetime or schedule runs out and closes it once expired or
+// empty for longer than the idle timeout. Breakouts are closed with their
+// parent.
+func (r *Room) sweep(now time.Time) {
+	if r.Parent != nil {
+		return
+	}
+	
+	schedule := r.RTC.GetConfig().Schedule
+	
+	if r.RTC.IsExpired() {
+		reason := ExpiryLifetime
+		if !schedule.EndsAt.IsZero() {
+			reason = ExpirySchedule
+		}
+		r.expire(reason, now)
+		return
+	}
+	
+	expiresAt := r.RTC.GetExpiresAt()
+	warning := cfg.Janitor.ExpiryWarning.Std()
+	
+	r.mutex.Lock()
+	warn := !expiresAt.IsZero() && warning > 0 && !r.expiryWarned && expiresAt.Sub(now) <= warning
+	if warn {
+		r.expiryWarned = true
+	}
+	
+	remind := !r.startReminded && startsSoon(schedule, now)
+	if remind {
+		r.startReminded = true
+	}
+	
+	// Rooms whose users are all in breakouts are not idle, nor are
+	// scheduled rooms before they start
+	empty := len(r.Peers) == 0 && len(r.Viewers) == 0 && len(r.lobby) == 0 && len(r.breakouts) == 0 &&
+		!now.Before(schedule.StartsAt)
+	switch {
+	case !empty:
+		r.emptySince = time.Time{}
+	case r.emptySince.IsZero():
+		r.emptySince = now
+	}
+	idle := empty && cfg.Janitor.IdleTimeout > 0 && now.Sub(r.emptySince) >= cfg.Janitor.IdleTimeout.Std()
+	r.mutex.Unlock()
+	
+	if remind {
+		r.remindStart(schedule, now)
+	}
+	
+	if warn {
+		expiring := RoomExpiringData{
+			RoomID:           r.ID,
+			ExpiresAt:        expiresAt,
+			RemainingSeconds: int(expiresAt.Sub(now).Seconds()),
+		}
+		r.broadcastEvent("room_expiring", expiring)
+		r.RTC.Announce("room_expiring", expiring)
+	}
+	
+	if idle {
+		r.expire(ExpiryIdle, now)
+	}
+}
+
+// expire announces why the room is ending and closes it
+func (r *Room) expire(reason string, now time.Time) {
+	log.Printf("Closing room %s: %s", r.ID, reason)
+	
+	expired := RoomExpiredData{
+		RoomID:    r.ID,
+		Reason:    reason,
+		ExpiredAt: now,
+	}
+	r.broadcastEvent("room_expired", expired)
+	r.RTC.Announce("room_expired", expired)
+	
+	r.close("janitor")
+}
+
+// sweep reminds a scheduled stream's clients before it starts, ends it at
+// its scheduled end and removes a stream that ended longer ago than the
+// retention period, disconnecting anyone still attached and stopping its hubs
+func (s *Stream) sweep(now time.Time) {
+	status := s.GetStatus()
+	
+	if status == StreamScheduled && startsSoon(s.Schedule, now) && s.markStartReminded() {
+		s.broadcastEvent("session_starting_soon", startingSoonData(s.ID, SessionStream, s.Schedule, now))
+	}
+	
+	if status != StreamEnded && !s.Schedule.EndsAt.IsZero() && !now.Before(s.Schedule.EndsAt) {
+		log.Printf("Ending stream %s: %s", s.ID, ExpirySchedule)
+		s.changeStatus(StreamEnded, "janitor")
+		return
+	}
+	
+	if status != StreamEnded || now.Sub(s.GetStatistics().StreamEndTime) < cfg.Janitor.StreamRetention.Std() {
+		return
+	}
+	
+	log.Printf("Removing ended stream %s", s.ID)
+	
+	streamManager.Remove(s.ID)
+	s.ViewerHub.Stop()
+	s.ChatHub.Stop()
+}
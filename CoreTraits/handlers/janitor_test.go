@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestSweepWarnsAndExpiresRooms(t *testing.T) {
+	base := testServer(t)
+
+	room := newRoom("expiring-room", RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{Lifetime: 500 * time.Millisecond}, nil)
+	t.Cleanup(func() { roomManager.Remove(room.ID) })
+	alice := dialTest(t, base+"/room/expiring-room/websocket?u=alice")
+	readEvent(t, alice, "room_joined", nil)
+
+	// The warning goes out once the expiry is within the configured window
+	expiresAt := room.RTC.GetExpiresAt()
+	sweep(expiresAt.Add(-cfg.Janitor.ExpiryWarning.Std() - time.Second))
+	sweep(expiresAt.Add(-time.Second))
+	var expiring RoomExpiringData
+	readEvent(t, alice, "room_expiring", &expiring)
+	if !expiring.ExpiresAt.Equal(expiresAt) || expiring.RemainingSeconds != 1 {
+		t.Errorf("room_expiring = %+v, want the expiry a second away", expiring)
+	}
+
+	time.Sleep(time.Until(expiresAt))
+	sweep(time.Now())
+	var expired RoomExpiredData
+	readEvent(t, alice, "room_expired", &expired)
+	if expired.Reason != ExpiryLifetime {
+		t.Errorf("room expired for %s, want its lifetime", expired.Reason)
+	}
+	readClosed(t, alice)
+	if _, open := roomManager.Get(room.ID); open {
+		t.Error("the expired room is still registered")
+	}
+}
+
+func TestSweepClosesIdleRooms(t *testing.T) {
+	base := testServer(t)
+
+	room := newRoom("idle-room", RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{}, nil)
+	t.Cleanup(func() { roomManager.Remove(room.ID) })
+	alice := dialTest(t, base+"/room/idle-room/websocket?u=alice")
+	readEvent(t, alice, "room_joined", nil)
+
+	// Occupied rooms are never idle
+	now := time.Now()
+	idle := cfg.Janitor.IdleTimeout.Std()
+	sweep(now)
+	sweep(now.Add(2 * idle))
+	if _, open := roomManager.Get(room.ID); !open {
+		t.Fatal("an occupied room was closed")
+	}
+
+	// Leaving deliberately skips the resume grace
+	send(t, alice, `{"type":"leave"}`)
+	waitEmpty := time.Now().Add(5 * time.Second)
+	for room.RTC.GetPeerCount() > 0 && time.Now().Before(waitEmpty) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The idle timeout counts from the first sweep that finds the room empty
+	now = time.Now()
+	sweep(now)
+	sweep(now.Add(idle - time.Second))
+	if _, open := roomManager.Get(room.ID); !open {
+		t.Fatal("the room was closed before the idle timeout")
+	}
+	sweep(now.Add(idle))
+	if _, open := roomManager.Get(room.ID); open {
+		t.Error("the idle room is still registered")
+	}
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// Signal types for deciding on joiners waiting in the lobby
+const (
+	SignalLobbyAdmit = "lobby_admit"
+	SignalLobbyDeny  = "lobby_deny"
+)
+
+// Statuses reported to joiners waiting in the lobby
+const (
+	LobbyWaiting  = "waiting"
+	LobbyAdmitted = "admitted"
+	LobbyDenied   = "denied"
+)
+
+// lobbyEntry is a client waiting in the lobby. Denied entries stay until
+// their connection closes so leave knows how to clean up.
+type lobbyEntry struct {
+	Client   *chat.Client
+	Username string
+	Role     chat.Role
+	denied   bool
+}
+
+// LobbyDecisionData is the payload of lobby_admit and lobby_deny frames.
+// All applies the decision to everyone waiting.
+type LobbyDecisionData struct {
+	PeerIDs []string `json:"peer_ids,omitempty"`
+	All     bool     `json:"all,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+// LobbyRequestData describes a joiner waiting in the lobby, sent to
+// moderators as a lobby_join_request event and in lobby_updated events
+type LobbyRequestData struct {
+	webrtc.PendingPeer
+	Role     chat.Role `json:"role"`
+	Position int       `json:"position"`
+}
+
+// LobbyUpdatedData is the payload of a lobby_updated event
+type LobbyUpdatedData struct {
+	Pending []LobbyRequestData `json:"pending"`
+}
+
+// LobbyStatusData is the payload of a lobby_status event sent to a waiting
+// joiner. OpensAt is set while the joiner waits for a scheduled room to open.
+type LobbyStatusData struct {
+	Status   string     `json:"status"`
+	Position int        `json:"position,omitempty"`
+	Waiting  int        `json:"waiting"`
+	Reason   string     `json:"reason,omitempty"`
+	OpensAt  *time.Time `json:"opens_at,omitempty"`
+}
+
+// addPeer creates the client's WebRTC peer, or parks the client in the lobby
+// when the room has one and the role does not run it. Scheduled rooms turn
+// away or park joiners until they open, except moderators, who may come in
+// early. It reports whether the client is waiting.
+func (r *Room) addPeer(client *chat.Client, username string, role chat.Role) (*webrtc.Peer, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	if r.RTC.IsExpired() {
+		return nil, false, errors.New("the room has ended")
+	}
+	
+	now := time.Now()
+	schedule := r.RTC.GetConfig().Schedule
+	if !role.Can(chat.CapAdmitPeers) && schedule.IsEarly(now) {
+		if err := earlyJoinError(SessionRoom, schedule, now); err != nil {
+			return nil, false, err
+		}
+		if err := r.RTC.ParkPeer(client.Info.ID, client.Info.UserID, username); err != nil {
+			return nil, false, err
+		}
+		r.lobby[client.Info.ID] = &lobbyEntry{
+			Client:   client,
+			Username: username,
+			Role:     role,
+		}
+		return nil, true, nil
+	}
+	
+	rtcPeer, err := r.RTC.AddPeer(client.Info.ID, client.Info.UserID, username)
+	if !errors.Is(err, webrtc.ErrPeerPending) {
+		return rtcPeer, false, err
+	}
+	
+	// Moderators run the lobby, so they never wait in it
+	if role.Can(chat.CapAdmitPeers) {
+		rtcPeer, err = r.RTC.AdmitPeer(client.Info.ID)
+		return rtcPeer, false, err
+	}
+	
+	r.lobby[client.Info.ID] = &lobbyEntry{
+		Client:   client,
+		Username: username,
+		Role:     role,
+	}
+	
+	return nil, true, nil
+}
+
+// admitViewer reports why a user may not watch the room, or nil when they
+// may. Viewers cannot wait in the lobby, so scheduled rooms turn them away
+// until they open, and while the lobby is on only users already admitted as
+// peers may watch. Those who run the lobby may always watch.
+func (r *Room) admitViewer(user *chat.ClientInfo) error {
+	if r.RTC.IsExpired() {
+		return errors.New("the room has ended")
+	}
+	
+	role := r.roleFor(user)
+	if role.Can(chat.CapAdmitPeers) {
+		return nil
+	}
+	
+	config := r.RTC.GetConfig()
+	if err := notOpenError(SessionRoom, config.Schedule, time.Now()); err != nil {
+		return err
+	}
+	if !config.EnableLobby {
+		return nil
+	}
+	
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	for _, peer := range r.Peers {
+		if peer.UserID == user.UserID {
+			return nil
+		}
+	}
+	
+	return errors.New("the room has a lobby; join as a participant and wait to be admitted")
+}
+
+// handleLobbyDecision admits or denies joiners waiting in the lobby
+func (r *Room) handleLobbyDecision(c *chat.Client, signal *webrtc.SignalMessage) {
+	if !r.require(c, signal.Type, chat.CapAdmitPeers) {
+		return
+	}
+	
+	var request LobbyDecisionData
+	if err := json.Unmarshal(signal.Data, &request); err != nil || (len(request.PeerIDs) == 0 && !request.All) {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, signal.Type+" needs peer_ids or all")
+		return
+	}
+	
+	peerIDs := request.PeerIDs
+	if request.All {
+		peerIDs = r.waitingIDs()
+	}
+	
+	for _, peerID := range peerIDs {
+		var err error
+		if signal.Type == SignalLobbyAdmit {
+			err = r.admit(peerID)
+		} else {
+			err = r.deny(peerID, request.Reason)
+		}
+	
+		if err != nil {
+			code := ErrCodeSignalFailed
+			if err == errTargetNotFound {
+				code = ErrCodePeerNotFound
+			}
+			r.sendError(c, signal.Type, code, fmt.Sprintf("%s: %v", peerID, err))
+		}
+	}
+	
+	r.notifyLobby("")
+}
+
+// waitingIDs returns the peer IDs waiting in the lobby, in arrival order
+func (r *Room) waitingIDs() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	requests := r.lobbyRequests()
+	peerIDs := make([]string, 0, len(requests))
+	for _, request := range requests {
+		peerIDs = append(peerIDs, request.ID)
+	}
+	return peerIDs
+}
+
+// admit lets a waiting client into the room as a peer and announces it
+func (r *Room) admit(peerID string) error {
+	r.mutex.Lock()
+	
+	entry, waiting := r.lobby[peerID]
+	if !waiting || entry.denied {
+		r.mutex.Unlock()
+		return errTargetNotFound
+	}
+	
+	rtcPeer, err := r.RTC.AdmitPeer(peerID)
+	if err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+	
+	delete(r.lobby, peerID)
+	peer := r.newPeer(entry.Client, rtcPeer, entry.Username, entry.Role)
+	r.Peers[peerID] = peer
+	
+	// The hub owns the send channel from here on
+	r.sendEvent(entry.Client, "lobby_status", LobbyStatusData{Status: LobbyAdmitted})
+	r.Hub.Join(entry.Client)
+	r.mutex.Unlock()
+	
+	r.announcePeer(peer)
+	
+	return nil
+}
+
+// deny turns a waiting client away and disconnects it once told
+func (r *Room) deny(peerID, reason string) error {
+	r.mutex.Lock()
+	
+	entry, waiting := r.lobby[peerID]
+	if !waiting || entry.denied {
+		r.mutex.Unlock()
+		return errTargetNotFound
+	}
+	
+	if err := r.RTC.DenyPeer(peerID); err != nil {
+		log.Printf("Failed to remove peer %s from the lobby of room %s: %v", peerID, r.ID, err)
+	}
+	entry.denied = true
+	r.sendEvent(entry.Client, "lobby_status", LobbyStatusData{Status: LobbyDenied, Reason: reason})
+	r.mutex.Unlock()
+	
+	time.AfterFunc(shutdownFlushDelay, func() {
+		entry.Client.Close()
+	})
+	
+	return nil
+}
+
+// admitAll lets everyone waiting in, used when the lobby is switched off
+func (r *Room) admitAll() {
+	for _, peerID := range r.waitingIDs() {
+		if err := r.admit(peerID); err != nil {
+			log.Printf("Failed to admit peer %s to room %s: %v", peerID, r.ID, err)
+		}
+	}
+	
+	r.notifyLobby("")
+}
+
+// leaveLobby removes a client that disconnected while waiting or after being
+// denied, closing its send channel. It reports whether the client was in the lobby.
+func (r *Room) leaveLobby(c *chat.Client) bool {
+	r.mutex.Lock()
+	
+	entry, waiting := r.lobby[c.Info.ID]
+	if !waiting {
+		r.mutex.Unlock()
+		return false
+	}
+	
+	delete(r.lobby, c.Info.ID)
+	if !entry.denied {
+		if err := r.RTC.DenyPeer(c.Info.ID); err != nil {
+			log.Printf("Failed to remove peer %s from the lobby of room %s: %v", c.Info.ID, r.ID, err)
+		}
+	}
+	c.CloseSend()
+	r.mutex.Unlock()
+	
+	if !entry.denied {
+		r.notifyLobby("")
+	}
+	
+	return true
+}
+
+// isWaiting reports whether a client is in the lobby
+func (r *Room) isWaiting(c *chat.Client) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	_, waiting := r.lobby[c.Info.ID]
+	return waiting
+}
+
+// handleWaitingSignal answers a frame from a client in the lobby, which may
+// only leave. It reports whether the client asked to leave.
+func (r *Room) handleWaitingSignal(c *chat.Client, signal *webrtc.SignalMessage) bool {
+	if signal.Type == SignalLeave {
+		return true
+	}
+	
+	r.sendError(c, signal.Type, ErrCodeForbidden, "You are waiting to be admitted")
+	return false
+}
+
+// notifyLobby sends every waiting client its position and every moderator
+// the pending list. A non-empty joinedID also raises a lobby_join_request
+// for that joiner.
+func (r *Room) notifyLobby(joinedID string) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	requests := r.lobbyRequests()
+	
+	var opensAt *time.Time
+	if schedule := r.RTC.GetConfig().Schedule; schedule.IsEarly(time.Now()) {
+		at := schedule.OpensAt()
+		opensAt = &at
+	}
+	
+	for _, request := range requests {
+		r.sendEvent(r.lobby[request.ID].Client, "lobby_status", LobbyStatusData{
+			Status:   LobbyWaiting,
+			Position: request.Position,
+			Waiting:  len(requests),
+			OpensAt:  opensAt,
+		})
+	}
+	
+	for _, peer := range r.Peers {
+		if !peer.Role.Can(chat.CapAdmitPeers) {
+			continue
+		}
+	
+		for _, request := range requests {
+			if request.ID == joinedID {
+				r.sendEvent(peer.Client, "lobby_join_request", request)
+			}
+		}
+		r.sendEvent(peer.Client, "lobby_updated", LobbyUpdatedData{Pending: requests})
+	}
+}
+
+// lobbyRequests lists the clients waiting in the lobby in arrival order.
+// The caller must hold the lock.
+func (r *Room) lobbyRequests() []LobbyRequestData {
+	requests := []LobbyRequestData{}
+	for _, pending := range r.RTC.GetPendingPeers() {
+		entry, waiting := r.lobby[pending.ID]
+		if !waiting || entry.denied {
+			continue
+		}
+	
+		requests = append(requests, LobbyRequestData{
+			PendingPeer: pending,
+			Role:        entry.Role,
+			Position:    len(requests) + 1,
+		})
+	}
+	return requests
+}
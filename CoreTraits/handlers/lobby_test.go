@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestLobbyAdmitAndDeny(t *testing.T) {
+	base := testServer(t)
+
+	room := newRoom("lobby-room", RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{EnableLobby: true}, nil)
+	t.Cleanup(func() {
+		room.close("test")
+		roomManager.Remove(room.ID)
+	})
+
+	// The owner runs the lobby, so they go straight in
+	alice := dialTest(t, base+"/room/lobby-room/websocket?u=alice")
+	var joined RoomJoinedData
+	readEvent(t, alice, "room_joined", &joined)
+	if joined.Role != chat.RoleModerator {
+		t.Fatalf("owner joined as %s, want moderator", joined.Role)
+	}
+
+	bob := dialTest(t, base+"/room/lobby-room/websocket?u=bob")
+	var status LobbyStatusData
+	readEvent(t, bob, "lobby_status", &status)
+	if status.Status != LobbyWaiting || status.Position != 1 {
+		t.Errorf("bob's lobby_status = %+v, want waiting first in line", status)
+	}
+
+	var request LobbyRequestData
+	readEvent(t, alice, "lobby_join_request", &request)
+	if request.UserID != "bob" {
+		t.Fatalf("lobby_join_request for %s, want bob", request.UserID)
+	}
+
+	// Waiting joiners cannot signal the room
+	send(t, bob, `{"type":"chat","data":{"message":"let me in"}}`)
+	readEvent(t, bob, "error", nil)
+
+	send(t, alice, `{"type":"lobby_admit","data":{"peer_ids":["`+request.ID+`"]}}`)
+	readEvent(t, bob, "room_joined", &joined)
+	if joined.PeerID != request.ID {
+		t.Errorf("bob joined as %s, want the peer ID bob waited under", joined.PeerID)
+	}
+	readEvent(t, alice, "peer_joined", nil)
+
+	carol := dialTest(t, base+"/room/lobby-room/websocket?u=carol")
+	readEvent(t, alice, "lobby_join_request", &request)
+
+	send(t, alice, `{"type":"lobby_deny","data":{"peer_ids":["`+request.ID+`"],"reason":"class is full"}}`)
+	for {
+		readEvent(t, carol, "lobby_status", &status)
+		if status.Status != LobbyWaiting {
+			break
+		}
+	}
+	if status.Status != LobbyDenied || status.Reason != "class is full" {
+		t.Errorf("carol's lobby_status = %+v, want denied with the reason", status)
+	}
+	readClosed(t, carol)
+
+	// Deciding on someone no longer waiting is reported to the moderator
+	send(t, alice, `{"type":"lobby_admit","data":{"peer_ids":["`+request.ID+`"]}}`)
+	readEvent(t, alice, "error", nil)
+
+	if got := room.RTC.GetPeerCount(); got != 2 {
+		t.Errorf("room has %d peers, want alice and bob", got)
+	}
+}
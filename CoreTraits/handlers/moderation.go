@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// Moderator commands, accepted as signal types on the room websocket and as
+// the :action of POST /room/:uuid/peers/:peer/:action
+const (
+	ActionKick            = "kick"
+	ActionBan             = "ban"
+	ActionForceMuteAudio  = "force_mute_audio"
+	ActionForceStopVideo  = "force_stop_video"
+	ActionStopScreenshare = "stop_screenshare"
+	
+	// Let a peer switch media a moderator turned off back on
+	ActionAllowAudio       = "allow_audio"
+	ActionAllowVideo       = "allow_video"
+	ActionAllowScreenshare = "allow_screenshare"
+)
+
+// Capability each moderator command requires
+var moderationCapabilities = map[string]chat.Capability{
+	ActionKick:             chat.CapRemovePeers,
+	ActionBan:              chat.CapRemovePeers,
+	ActionForceMuteAudio:   chat.CapMuteOthers,
+	ActionForceStopVideo:   chat.CapMuteOthers,
+	ActionStopScreenshare:  chat.CapMuteOthers,
+	ActionAllowAudio:       chat.CapMuteOthers,
+	ActionAllowVideo:       chat.CapMuteOthers,
+	ActionAllowScreenshare: chat.CapMuteOthers,
+}
+
+// Media each muting command switches off
+var moderationMedia = map[string]webrtc.MediaKind{
+	ActionForceMuteAudio:  webrtc.MediaAudio,
+	ActionForceStopVideo:  webrtc.MediaVideo,
+	ActionStopScreenshare: webrtc.MediaScreen,
+}
+
+// Media each allowing command lets the peer switch on again
+var moderationAllows = map[string]webrtc.MediaKind{
+	ActionAllowAudio:       webrtc.MediaAudio,
+	ActionAllowVideo:       webrtc.MediaVideo,
+	ActionAllowScreenshare: webrtc.MediaScreen,
+}
+
+// Errors returned by moderate
+var (
+	errUnknownAction   = errors.New("unknown moderation action")
+	errNotAllowed      = errors.New("your role does not allow this action")
+	errTargetNotFound  = errors.New("peer is not in this room")
+	errTargetProtected = errors.New("moderators cannot be moderated, change their role first")
+	errTargetSelf      = errors.New("you cannot moderate yourself")
+)
+
+// ModerationData is the payload of a moderator command frame
+type ModerationData struct {
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ModerationActor identifies who took a moderator action
+type ModerationActor struct {
+	PeerID   string `json:"peer_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// PeerModeratedData is the payload of a peer_moderated event
+type PeerModeratedData struct {
+	PeerID string          `json:"peer_id"`
+	UserID string          `json:"user_id"`
+	Action string          `json:"action"`
+	Reason string          `json:"reason,omitempty"`
+	Actor  ModerationActor `json:"actor"`
+}
+
+// handleModeration runs a moderator command sent over the room websocket
+func (r *Room) handleModeration(c *chat.Client, signal *webrtc.SignalMessage) {
+	var request ModerationData
+	if err := json.Unmarshal(signal.Data, &request); err != nil || request.PeerID == "" {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, signal.Type+" needs peer_id")
+		return
+	}
+	
+	r.mutex.RLock()
+	actor, exists := r.Peers[c.Info.ID]
+	r.mutex.RUnlock()
+	
+	if !exists {
+		return
+	}
+	
+	if err := r.moderate(actor, signal.Type, request.PeerID, request.Reason); err != nil {
+		code := ErrCodeForbidden
+		switch err {
+		case errTargetNotFound:
+			code = ErrCodePeerNotFound
+		case errUnknownAction:
+			code = ErrCodeUnknownType
+		}
+		r.sendError(c, signal.Type, code, err.Error())
+	}
+}
+
+// ModeratePeer runs a moderator command over REST. The caller must be in the
+// room as a peer whose role allows the action.
+func ModeratePeer(c *fiber.Ctx) error {
+	room, exists := roomManager.Get(c.Params("uuid"))
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"message": "Room not found",
+		})
+	}
+	
+	var request ModerationData
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request body",
+			})
+		}
+	}
+	
+	action := c.Params("action")
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	
+	actor := room.peerForUser(info.UserID, moderationCapabilities[action])
+	if actor == nil {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "You must be in the room with a role that allows this action",
+		})
+	}
+	
+	if err := room.moderate(actor, action, c.Params("peer"), request.Reason); err != nil {
+		status := 403
+		switch err {
+		case errTargetNotFound:
+			status = 404
+		case errUnknownAction:
+			status = 400
+		}
+	
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
+	
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Peer moderated",
+		"action":  action,
+		"peer_id": c.Params("peer"),
+	})
+}
+
+// peerForUser returns the user's peer in the room that has the capability, if any
+func (r *Room) peerForUser(userID string, capability chat.Capability) *Peer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	for _, peer := range r.Peers {
+		if peer.UserID == userID && peer.Role.Can(capability) {
+			return peer
+		}
+	}
+	
+	return nil
+}
+
+// moderate applies a moderator command from actor to the peer or viewer
+// targetID and announces it to the room
+func (r *Room) moderate(actor *Peer, action, targetID, reason string) error {
+	capability, known := moderationCapabilities[action]
+	if !known {
+		return errUnknownAction
+	}
+	
+	r.mutex.Lock()
+	
+	if !actor.Role.Can(capability) {
+		r.mutex.Unlock()
+		return errNotAllowed
+	}
+	if targetID == actor.ID {
+		r.mutex.Unlock()
+		return errTargetSelf
+	}
+	
+	// Viewers can be removed but have no media to mute
+	var targetUserID string
+	target, isPeer := r.Peers[targetID]
+	viewer, isViewer := r.Viewers[targetID]
+	
+	switch {
+	case isPeer:
+		if target.Role == chat.RoleModerator {
+			r.mutex.Unlock()
+			return errTargetProtected
+		}
+		targetUserID = target.UserID
+	case isViewer && (action == ActionKick || action == ActionBan):
+		targetUserID = viewer.Info.UserID
+	default:
+		r.mutex.Unlock()
+		return errTargetNotFound
+	}
+	
+	// Banned users cannot rejoin for the rest of the room's life
+	if action == ActionBan {
+		r.banned[targetUserID] = true
+	}
+	
+	// Switch the media off at the SFU and record it on the peer, which may
+	// not switch it back on until a moderator allows it
+	if kind, mutes := moderationMedia[action]; mutes {
+		target.forceOff(kind)
+		switch kind {
+		case webrtc.MediaAudio:
+			target.Settings.Audio = false
+		case webrtc.MediaVideo:
+			target.Settings.Video = false
+		case webrtc.MediaScreen:
+			target.Settings.ScreenShare = false
+		}
+	}
+	
+	if kind, allows := moderationAllows[action]; allows {
+		delete(target.forcedOff, kind)
+	}
+	
+	// Kicks close only the target connection, bans every connection of the user
+	var conns []*chat.Client
+	switch action {
+	case ActionKick:
+		if isPeer {
+			conns = append(conns, target.Client)
+		} else {
+			conns = append(conns, viewer)
+		}
+	case ActionBan:
+		for _, peer := range r.Peers {
+			if peer.UserID == targetUserID {
+				conns = append(conns, peer.Client)
+			}
+		}
+		for _, v := range r.Viewers {
+			if v.Info.UserID == targetUserID {
+				conns = append(conns, v)
+			}
+		}
+	}
+	
+	r.mutex.Unlock()
+	
+	if kind, mutes := moderationMedia[action]; mutes {
+		if err := r.RTC.SetPeerMedia(targetID, kind, false); err != nil {
+			return errTargetNotFound
+		}
+	}
+	
+	// Removed peers stop reaching the room at once, before their connection closes
+	if isPeer && len(conns) > 0 {
+		for _, kind := range []webrtc.MediaKind{webrtc.MediaAudio, webrtc.MediaVideo, webrtc.MediaScreen} {
+			r.RTC.SetPeerMedia(targetID, kind, false)
+		}
+	}
+	
+	r.broadcastEvent("peer_moderated", PeerModeratedData{
+		PeerID: targetID,
+		UserID: targetUserID,
+		Action: action,
+		Reason: reason,
+		Actor: ModerationActor{
+			PeerID:   actor.ID,
+			UserID:   actor.UserID,
+			Username: actor.Username,
+		},
+	})
+	
+	// Let the removed clients receive the event before disconnecting them;
+	// their read pumps then clean up the peers as for a normal leave, and
+	// peers held for a resume are released
+	if len(conns) > 0 {
+		time.AfterFunc(shutdownFlushDelay, func() {
+			for _, client := range conns {
+				if !r.release(client) {
+					client.Close()
+				}
+			}
+		})
+	}
+	
+	return nil
+}
+
+// forceOff records that a moderator switched off one kind of the peer's
+// media. The caller must hold the room's lock.
+func (p *Peer) forceOff(kind webrtc.MediaKind) {
+	if p.forcedOff == nil {
+		p.forcedOff = make(map[webrtc.MediaKind]bool)
+	}
+	p.forcedOff[kind] = true
+}
+
+// refuseForcedOff replies with a forbidden error when the peer asks to send
+// media a moderator switched off, reporting whether it did. The caller must
+// hold the room's lock.
+func (r *Room) refuseForcedOff(peer *Peer, c *chat.Client, requestType string, audio, video, screen bool) bool {
+	requested := map[webrtc.MediaKind]bool{
+		webrtc.MediaAudio:  audio,
+		webrtc.MediaVideo:  video,
+		webrtc.MediaScreen: screen,
+	}
+	for _, kind := range []webrtc.MediaKind{webrtc.MediaAudio, webrtc.MediaVideo, webrtc.MediaScreen} {
+		if requested[kind] && peer.forcedOff[kind] {
+			r.sendError(c, requestType, ErrCodeForbidden, fmt.Sprintf("A moderator turned off your %s; wait for a moderator to allow it", kind))
+			return true
+		}
+	}
+	
+	return false
+}
+
+// isBanned reports whether a user was banned from the room
+func (r *Room) isBanned(userID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return r.banned[userID]
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pionwebrtc "github.com/pion/webrtc/v3"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// Signal types for room control, each gated by a capability
+const (
+	SignalMediaState     = "media_state"
+	SignalSetRole        = "set_role"
+	SignalUpdateSettings = "update_settings"
+	SignalCloseRoom      = "close_room"
+)
+
+// Error code for actions the sender's role does not allow
+const ErrCodeForbidden = "forbidden"
+
+// RoomSettingsUpdatedData is the payload of a room_settings_updated event
+type RoomSettingsUpdatedData struct {
+	EnableChat      bool   `json:"enable_chat"`
+	MaxParticipants int    `json:"max_participants"`
+	EnableLobby     bool   `json:"enable_lobby"`
+	ChangedBy       string `json:"changed_by"`
+}
+
+// RoomClosedData is the payload of a room_closed event
+type RoomClosedData struct {
+	RoomID   string `json:"room_id"`
+	ClosedBy string `json:"closed_by"`
+}
+
+// MediaStateData is the payload of a media_state frame and peer_media_changed event
+type MediaStateData struct {
+	PeerID      string `json:"peer_id,omitempty"`
+	Audio       bool   `json:"audio"`
+	Video       bool   `json:"video"`
+	ScreenShare bool   `json:"screen_share"`
+	
+	// ID of the video track carrying the screen share, if any
+	ScreenTrackID string `json:"screen_track_id,omitempty"`
+}
+
+// SetRoleData is the payload of a set_role frame
+type SetRoleData struct {
+	PeerID string    `json:"peer_id"`
+	Role   chat.Role `json:"role"`
+}
+
+// RoleChangedData is the payload of a role_changed event
+type RoleChangedData struct {
+	PeerID       string            `json:"peer_id"`
+	UserID       string            `json:"user_id"`
+	Role         chat.Role         `json:"role"`
+	Capabilities []chat.Capability `json:"capabilities"`
+	ChangedBy    string            `json:"changed_by"`
+}
+
+// RoomSettingsData is the payload of an update_settings frame; omitted fields are unchanged
+type RoomSettingsData struct {
+	EnableChat      *bool `json:"enable_chat,omitempty"`
+	MaxParticipants *int  `json:"max_participants,omitempty"`
+	EnableLobby     *bool `json:"enable_lobby,omitempty"`
+}
+
+// roleOf returns the role of a peer in the room
+func (r *Room) roleOf(peerID string) (chat.Role, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	peer, exists := r.Peers[peerID]
+	if !exists {
+		return "", false
+	}
+	return peer.Role, true
+}
+
+// authorize reports whether a peer's role has the capability
+func (r *Room) authorize(peerID string, capability chat.Capability) bool {
+	role, exists := r.roleOf(peerID)
+	return exists && role.Can(capability)
+}
+
+// require checks a capability for the sender of a signal, replying with a
+// forbidden error frame when it is missing
+func (r *Room) require(c *chat.Client, requestType string, capability chat.Capability) bool {
+	if r.authorize(c.Info.ID, capability) {
+		return true
+	}
+	
+	r.sendError(c, requestType, ErrCodeForbidden, fmt.Sprintf("Your role does not allow %s", capability))
+	return false
+}
+
+// checkOffer rejects offers that would publish media the sender may not
+// send, or that a moderator turned off
+func (r *Room) checkOffer(c *chat.Client, signal *webrtc.SignalMessage) bool {
+	var offer pionwebrtc.SessionDescription
+	if err := json.Unmarshal(signal.Data, &offer); err != nil {
+		// Left to the peer connection, which reports the parse error
+		return true
+	}
+	
+	audio, video := sendingMedia(offer.SDP)
+	if audio && !r.require(c, signal.Type, chat.CapPublishAudio) {
+		return false
+	}
+	if video && !r.require(c, signal.Type, chat.CapPublishVideo) {
+		return false
+	}
+	
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	peer, exists := r.Peers[c.Info.ID]
+	return !exists || !r.refuseForcedOff(peer, c, signal.Type, audio, video, false)
+}
+
+// sendingMedia reports whether an SDP sends audio or video, looking at each
+// active m= section and its direction (sendrecv when none is given)
+func sendingMedia(sdp string) (audio, video bool) {
+	kind := ""
+	sending := false
+	
+	flush := func() {
+		if !sending {
+			return
+		}
+		switch kind {
+		case "audio":
+			audio = true
+		case "video":
+			video = true
+		}
+	}
+	
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+	
+		switch {
+		case strings.HasPrefix(line, "m="):
+			flush()
+			fields := strings.Fields(strings.TrimPrefix(line, "m="))
+			kind = ""
+			sending = false
+	
+			// Port 0 marks a rejected section
+			if len(fields) >= 2 && fields[1] != "0" {
+				kind = fields[0]
+				sending = true
+			}
+		case line == "a=recvonly" || line == "a=inactive":
+			sending = false
+		}
+	}
+	flush()
+	
+	return audio, video
+}
+
+// handleMediaState records a peer's camera, microphone and screen share
+// state. Media a moderator turned off stays off until a moderator allows it.
+func (r *Room) handleMediaState(c *chat.Client, signal *webrtc.SignalMessage) {
+	var state MediaStateData
+	if err := json.Unmarshal(signal.Data, &state); err != nil {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, "media_state needs audio, video and screen_share")
+		return
+	}
+	
+	if state.Audio && !r.require(c, signal.Type, chat.CapPublishAudio) {
+		return
+	}
+	if state.Video && !r.require(c, signal.Type, chat.CapPublishVideo) {
+		return
+	}
+	if state.ScreenShare && !r.require(c, signal.Type, chat.CapShareScreen) {
+		return
+	}
+	
+	r.mutex.Lock()
+	peer, exists := r.Peers[c.Info.ID]
+	if exists && r.refuseForcedOff(peer, c, signal.Type, state.Audio, state.Video, state.ScreenShare) {
+		r.mutex.Unlock()
+		return
+	}
+	if exists {
+		peer.Settings = PeerSettings{
+			Video:       state.Video,
+			Audio:       state.Audio,
+			ScreenShare: state.ScreenShare,
+		}
+	}
+	r.mutex.Unlock()
+	
+	if !exists {
+		return
+	}
+	
+	// Forward exactly the media the peer says it is sending
+	if peer.RTC != nil {
+		peer.RTC.SetScreenTrack(state.ScreenTrackID)
+		peer.RTC.SetMediaEnabled(webrtc.MediaAudio, state.Audio)
+		peer.RTC.SetMediaEnabled(webrtc.MediaVideo, state.Video)
+		peer.RTC.SetMediaEnabled(webrtc.MediaScreen, state.ScreenShare)
+	}
+	
+	state.PeerID = c.Info.ID
+	r.broadcastEvent("peer_media_changed", state)
+}
+
+// handleSetRole changes another peer's role and announces it
+func (r *Room) handleSetRole(c *chat.Client, signal *webrtc.SignalMessage) {
+	if !r.require(c, signal.Type, chat.CapAssignRoles) {
+		return
+	}
+	
+	var request SetRoleData
+	if err := json.Unmarshal(signal.Data, &request); err != nil {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, "set_role needs peer_id and role")
+		return
+	}
+	
+	role, ok := chat.ParseRole(string(request.Role))
+	if !ok {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, fmt.Sprintf("Unknown role %q", request.Role))
+		return
+	}
+	
+	r.mutex.Lock()
+	peer, exists := r.Peers[request.PeerID]
+	if !exists {
+		r.mutex.Unlock()
+		r.sendError(c, signal.Type, ErrCodePeerNotFound, fmt.Sprintf("Peer %s is not in this room", request.PeerID))
+		return
+	}
+	
+	// A room must keep at least one moderator
+	if peer.Role == chat.RoleModerator && role != chat.RoleModerator && r.moderatorCount() == 1 {
+		r.mutex.Unlock()
+		r.sendError(c, signal.Type, ErrCodeForbidden, "The last moderator cannot be demoted")
+		return
+	}
+	
+	peer.Role = role
+	userID := peer.UserID
+	revoked := peer.revokeMedia(role)
+	r.mutex.Unlock()
+	
+	// Tracks already being forwarded are only checked when they start, so
+	// stop the media the new role may not send
+	for _, kind := range revoked {
+		r.RTC.SetPeerMedia(request.PeerID, kind, false)
+	}
+	
+	r.broadcastEvent("role_changed", RoleChangedData{
+		PeerID:       request.PeerID,
+		UserID:       userID,
+		Role:         role,
+		Capabilities: role.Capabilities(),
+		ChangedBy:    c.Info.ID,
+	})
+}
+
+// revokeMedia switches off the peer's settings for media the role may not
+// send and returns those kinds. The caller must hold the room's lock.
+func (p *Peer) revokeMedia(role chat.Role) []webrtc.MediaKind {
+	var revoked []webrtc.MediaKind
+	if !role.Can(chat.CapPublishAudio) {
+		p.Settings.Audio = false
+		revoked = append(revoked, webrtc.MediaAudio)
+	}
+	if !role.Can(chat.CapPublishVideo) {
+		p.Settings.Video = false
+		revoked = append(revoked, webrtc.MediaVideo)
+	}
+	if !role.Can(chat.CapShareScreen) {
+		p.Settings.ScreenShare = false
+		revoked = append(revoked, webrtc.MediaScreen)
+	}
+	return revoked
+}
+
+// moderatorCount counts moderators in the room. The caller must hold the lock.
+func (r *Room) moderatorCount() int {
+	count := 0
+	for _, peer := range r.Peers {
+		if peer.Role == chat.RoleModerator {
+			count++
+		}
+	}
+	return count
+}
+
+// handleUpdateSettings changes room-wide settings and announces them
+func (r *Room) handleUpdateSettings(c *chat.Client, signal *webrtc.SignalMessage) {
+	if !r.require(c, signal.Type, chat.CapChangeSettings) {
+		return
+	}
+	
+	var update RoomSettingsData
+	if err := json.Unmarshal(signal.Data, &update); err != nil {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, "update_settings needs enable_chat, max_participants or enable_lobby")
+		return
+	}
+	if update.MaxParticipants != nil && *update.MaxParticipants < 0 {
+		r.sendError(c, signal.Type, ErrCodeInvalidMessage, "max_participants cannot be negative")
+		return
+	}
+	
+	r.updateSettings(update, c.Info.ID)
+}
+
+// updateSettings applies a settings change and announces it to the room
+func (r *Room) updateSettings(update RoomSettingsData, changedBy string) {
+	r.RTC.UpdateConfig(func(config *webrtc.RoomConfig) {
+		if update.EnableChat != nil {
+			config.EnableChat = *update.EnableChat
+		}
+		if update.MaxParticipants != nil {
+			config.MaxParticipants = *update.MaxParticipants
+		}
+		if update.EnableLobby != nil {
+			config.EnableLobby = *update.EnableLobby
+		}
+	})
+	
+	config := r.RTC.GetConfig()
+	r.broadcastEvent("room_settings_updated", RoomSettingsUpdatedData{
+		EnableChat:      config.EnableChat,
+		MaxParticipants: config.MaxParticipants,
+		EnableLobby:     config.EnableLobby,
+		ChangedBy:       changedBy,
+	})
+	
+	// Switching the lobby off lets everyone waiting in, unless they are
+	// waiting for a scheduled room to open
+	if !config.EnableLobby && !config.Schedule.IsEarly(time.Now()) {
+		r.admitAll()
+	}
+}
+
+// handleCloseRoom ends the room for everyone
+func (r *Room) handleCloseRoom(c *chat.Client, signal *webrtc.SignalMessage) {
+	if !r.require(c, signal.Type, chat.CapCloseRoom) {
+		return
+	}
+	
+	r.close(c.Info.ID)
+}
+
+// close tells every client the room is over, tears down its WebRTC session
+// and disconnects everyone once the notice has been flushed
+func (r *Room) close(closedBy string) {
+	roomManager.Remove(r.ID)
+	if r.opening != nil {
+		r.opening.Stop()
+	}
+	
+	// Breakouts do not outlive their parent
+	r.closeBreakouts(closedBy)
+	
+	r.broadcastEvent("room_closed", RoomClosedData{
+		RoomID:   r.ID,
+		ClosedBy: closedBy,
+	})
+	r.RTC.Close()
+	
+	time.AfterFunc(shutdownFlushDelay, func() {
+		// Stopping the hub flushes what is queued and sends each client a
+		// close frame, so wait for that before dropping the connections
+		r.Hub.Stop()
+		<-r.Hub.Done()
+		
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+	
+		for _, peer := range r.Peers {
+			if peer.held != nil {
+				peer.held.Stop()
+			}
+			peer.Client.Close()
+		}
+		for _, viewer := range r.Viewers {
+			viewer.Close()
+		}
+		for _, entry := range r.lobby {
+			entry.Client.Close()
+		}
+	})
+}
+
+// canChat reports whether a client may send chat to the room. Viewers are
+// not peers and chat whenever the room allows it; moderators always may.
+func (r *Room) canChat(c *chat.Client) bool {
+	role, exists := r.roleOf(c.Info.ID)
+	if !exists {
+		if !r.isViewer(c.Info.ID) {
+			return false
+		}
+		role = chat.RoleViewer
+	}
+	
+	if !role.Can(chat.CapSendChat) {
+		return false
+	}
+	return r.RTC.GetConfig().EnableChat || role == chat.RoleModerator
+}
+
+// isViewer reports whether a client is watching the room as a viewer
+func (r *Room) isViewer(clientID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	_, exists := r.Viewers[clientID]
+	return exists
+}
+
+// broadcastEvent sends an event frame to every client in the room
+func (r *Room) broadcastEvent(event string, data interface{}) {
+	eventBytes, err := events.Encode(event, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event, err)
+		return
+	}
+	
+	r.Hub.Publish(eventBytes)
+}
+
+// sendEvent queues an event frame on a single client's send buffer
+func (r *Room) sendEvent(c *chat.Client, event string, data interface{}) {
+	eventBytes, err := events.Encode(event, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event, err)
+		return
+	}
+	
+	if !c.Queue(eventBytes) {
+		log.Printf("Send buffer full for client %s, dropping %s event", c.Info.ID, event)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// sdp joins SDP lines with CRLF as browsers send them
+func sdp(lines ...string) string {
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestSendingMedia(t *testing.T) {
+	session := []string{"v=0", "o=- 1 2 IN IP4 127.0.0.1", "s=-", "t=0 0"}
+
+	tests := []struct {
+		name      string
+		lines     []string
+		wantAudio bool
+		wantVideo bool
+	}{
+		{"no media", nil, false, false},
+		{"sendrecv audio and video", []string{
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111", "a=sendrecv",
+			"m=video 9 UDP/TLS/RTP/SAVPF 96", "a=sendrecv",
+		}, true, true},
+		{"default direction sends", []string{
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111",
+		}, true, false},
+		{"sendonly video", []string{
+			"m=video 9 UDP/TLS/RTP/SAVPF 96", "a=sendonly",
+		}, false, true},
+		{"recvonly", []string{
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111", "a=recvonly",
+			"m=video 9 UDP/TLS/RTP/SAVPF 96", "a=recvonly",
+		}, false, false},
+		{"inactive audio", []string{
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111", "a=inactive",
+			"m=video 9 UDP/TLS/RTP/SAVPF 96", "a=sendrecv",
+		}, false, true},
+		{"rejected section", []string{
+			"m=audio 0 UDP/TLS/RTP/SAVPF 111", "a=sendrecv",
+		}, false, false},
+		{"direction stays in its section", []string{
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111", "a=recvonly",
+			"m=video 9 UDP/TLS/RTP/SAVPF 96",
+		}, false, true},
+		{"data channel", []string{
+			"m=application 9 UDP/DTLS/SCTP webrtc-datachannel",
+		}, false, false},
+		{"second video section", []string{
+			"m=video 9 UDP/TLS/RTP/SAVPF 96", "a=recvonly",
+			"m=video 9 UDP/TLS/RTP/SAVPF 96", "a=sendrecv",
+		}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio, video := sendingMedia(sdp(append(append([]string(nil), session...), tt.lines...)...))
+			if audio != tt.wantAudio || video != tt.wantVideo {
+				t.Errorf("sendingMedia() = audio %v, video %v, want %v, %v", audio, video, tt.wantAudio, tt.wantVideo)
+			}
+		})
+	}
+}
+
+func TestSendingMediaBareNewlines(t *testing.T) {
+	audio, video := sendingMedia("v=0\nm=audio 9 RTP/AVP 0\nm=video 9 RTP/AVP 96\na=recvonly\n")
+	if !audio || video {
+		t.Errorf("sendingMedia() = audio %v, video %v, want true, false", audio, video)
+	}
+}
+
+func TestSetRoleRevokesMedia(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	room := &Room{
+		Hub: chat.NewHub("room"),
+		RTC: webrtc.NewRoom("room", "", webrtc.RoomConfig{}),
+		Peers: map[string]*Peer{
+			"moderator": {ID: "moderator", Role: chat.RoleModerator},
+			"presenter": {ID: "presenter", Role: chat.RolePresenter, Settings: PeerSettings{Audio: true, Video: true, ScreenShare: true}},
+		},
+	}
+	go room.Hub.Run(ctx)
+	defer room.RTC.Close()
+
+	rtcPeer, err := room.RTC.AddPeer("presenter", "presenter", "presenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moderator := chat.NewClient(room.Hub, nil, chat.ClientInfo{ID: "moderator"})
+	room.handleSetRole(moderator, &webrtc.SignalMessage{
+		Type: "set_role",
+		Data: []byte(`{"peer_id":"presenter","role":"participant"}`),
+	})
+
+	settings := room.Peers["presenter"].Settings
+	if !settings.Audio || !settings.Video || settings.ScreenShare {
+		t.Errorf("settings after demotion to participant = %+v, want only screen share off", settings)
+	}
+	if !rtcPeer.AudioEnabled || !rtcPeer.VideoEnabled || rtcPeer.ScreenEnabled {
+		t.Errorf("forwarding after demotion to participant = audio %v, video %v, screen %v, want only screen off",
+			rtcPeer.AudioEnabled, rtcPeer.VideoEnabled, rtcPeer.ScreenEnabled)
+	}
+
+	room.handleSetRole(moderator, &webrtc.SignalMessage{
+		Type: "set_role",
+		Data: []byte(`{"peer_id":"presenter","role":"viewer"}`),
+	})
+
+	if settings := room.Peers["presenter"].Settings; settings != (PeerSettings{}) {
+		t.Errorf("settings after demotion to viewer = %+v, want all off", settings)
+	}
+	if rtcPeer.AudioEnabled || rtcPeer.VideoEnabled || rtcPeer.ScreenEnabled {
+		t.Error("the viewer's media is still forwarded")
+	}
+	if role := room.Peers["presenter"].Role; role != chat.RoleViewer {
+		t.Errorf("role = %s, want viewer", role)
+	}
+}
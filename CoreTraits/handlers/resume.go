@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/access"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+// PeerReconnectingData is the payload of a peer_reconnecting event, sent
+// when a peer's connection drops and it is held for a resume
+type PeerReconnectingData struct {
+	PeerID   string    `json:"peer_id"`
+	UserID   string    `json:"user_id"`
+	ResumeBy time.Time `json:"resume_by"`
+}
+
+// PeerResumedData is the payload of a peer_resumed event
+type PeerResumedData struct {
+	PeerID   string    `json:"peer_id"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Role     chat.Role `json:"role"`
+}
+
+// issueResumeToken gives the peer a new resume token in place of its last
+// one. No token is issued when resuming is switched off.
+func (r *Room) issueResumeToken(peer *Peer) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	return r.issueResumeTokenLocked(peer)
+}
+
+// issueResumeTokenLocked is issueResumeToken for callers holding the room's lock
+func (r *Room) issueResumeTokenLocked(peer *Peer) string {
+	if cfg.Chat.ResumeGrace <= 0 {
+		return ""
+	}
+	
+	token, err := access.NewToken()
+	if err != nil {
+		log.Printf("Failed to create resume token for peer %s: %v", peer.ID, err)
+		return ""
+	}
+	
+	delete(r.resumeTokens, peer.resumeToken)
+	peer.resumeToken = token
+	r.resumeTokens[token] = peer.ID
+	
+	return token
+}
+
+// hold keeps a peer whose connection dropped in the room for the resume
+// grace, keeping its role, hand and settings while the hub queues its
+// messages. It reports whether the peer is held. Nobody is held once the
+// room is closed or while the server shuts down.
+func (r *Room) hold(c *chat.Client) bool {
+	grace := cfg.Chat.ResumeGrace.Std()
+	if grace <= 0 || shuttingDown.Load() {
+		return false
+	}
+	if room, open := roomManager.Get(r.ID); !open || room != r {
+		return false
+	}
+	
+	r.mutex.Lock()
+	peer, exists := r.Peers[c.Info.ID]
+	if !exists || peer.Client != c || peer.resumeToken == "" {
+		r.mutex.Unlock()
+		return false
+	}
+	
+	peer.IsAlive = false
+	peer.held = time.AfterFunc(grace, func() {
+		r.release(c)
+	})
+	r.mutex.Unlock()
+	
+	r.broadcastEvent("peer_reconnecting", PeerReconnectingData{
+		PeerID:   c.Info.ID,
+		UserID:   c.Info.UserID,
+		ResumeBy: time.Now().Add(grace),
+	})
+	
+	return true
+}
+
+// release removes a held peer as if it had left, when its grace runs out or
+// a moderator removes it. It reports whether the client was held.
+func (r *Room) release(c *chat.Client) bool {
+	r.mutex.Lock()
+	peer, exists := r.Peers[c.Info.ID]
+	if !exists || peer.Client != c || peer.held == nil {
+		r.mutex.Unlock()
+		return false
+	}
+	
+	peer.held.Stop()
+	peer.held = nil
+	r.removePeerLocked(peer)
+	r.mutex.Unlock()
+	
+	r.Hub.Leave(c)
+	r.finishLeave(c)
+	
+	return true
+}
+
+// resume moves a held peer onto a new websocket when the same user presents
+// its resume token. The peer keeps its ID, role, hand and settings and is
+// sent what it missed, then is served as usual. A peer still connected is
+// dropped first, for clients that notice a dead connection before the
+// server does. It reports false when the token does not resume a peer, so
+// the caller joins the client as a new one.
+func (r *Room) resume(c *websocket.Conn, token string) bool {
+	user := identity(c)
+	
+	r.mutex.RLock()
+	peer, exists := r.Peers[r.resumeTokens[token]]
+	if !exists || peer.UserID != user.UserID || r.banned[user.UserID] {
+		r.mutex.RUnlock()
+		return false
+	}
+	previous, connected := peer.Client, peer.held == nil
+	r.mutex.RUnlock()
+	
+	if connected {
+		previous.Drop()
+		<-previous.Done()
+	}
+	
+	r.mutex.Lock()
+	if r.Peers[peer.ID] != peer || peer.Client != previous || peer.held == nil || !peer.held.Stop() {
+		r.mutex.Unlock()
+		return false
+	}
+	peer.held = nil
+	
+	client := r.newPeerClient(c, peer.ID, peer.Role)
+	r.sendEvent(client, "room_joined", RoomJoinedData{
+		RoomID:       r.ID,
+		PeerID:       peer.ID,
+		Role:         peer.Role,
+		Capabilities: peer.Role.Capabilities(),
+		ResumeToken:  r.issueResumeTokenLocked(peer),
+		Resumed:      true,
+	})
+	
+	// The hub drops clients whose buffer fills while they are away
+	resumed := r.Hub.Resume(previous, client)
+	if resumed {
+		peer.Client = client
+		peer.IsAlive = true
+	} else {
+		r.removePeerLocked(peer)
+	}
+	r.mutex.Unlock()
+	
+	if !resumed {
+		r.finishLeave(previous)
+		return false
+	}
+	
+	r.broadcastEvent("peer_resumed", PeerResumedData{
+		PeerID:   peer.ID,
+		UserID:   peer.UserID,
+		Username: peer.Username,
+		Role:     peer.Role,
+	})
+	
+	serve(client, r.leave)
+	return true
+}
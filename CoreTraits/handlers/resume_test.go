@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// resumeRoom opens a room owned by alice with alice and bob in it and
+// returns their connections and bob's room_joined data
+func resumeRoom(t *testing.T, id string) (string, *fws.Conn, *fws.Conn, RoomJoinedData) {
+	t.Helper()
+
+	base := testServer(t)
+	room := newRoom(id, RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{EnableChat: true}, nil)
+	t.Cleanup(func() {
+		room.close("test")
+		roomManager.Remove(room.ID)
+	})
+
+	alice := dialTest(t, base+"/room/"+id+"/websocket?u=alice")
+	readEvent(t, alice, "room_joined", nil)
+
+	var joined RoomJoinedData
+	bob := dialTest(t, base+"/room/"+id+"/websocket?u=bob")
+	readEvent(t, bob, "room_joined", &joined)
+	if joined.ResumeToken == "" {
+		t.Fatal("room_joined has no resume token")
+	}
+	readEvent(t, alice, "peer_joined", nil)
+
+	return base + "/room/" + id + "/websocket", alice, bob, joined
+}
+
+func TestResumeWithinGrace(t *testing.T) {
+	url, alice, bob, joined := resumeRoom(t, "resume-room")
+
+	bob.Close()
+	var reconnecting PeerReconnectingData
+	readEvent(t, alice, "peer_reconnecting", &reconnecting)
+	if reconnecting.PeerID != joined.PeerID {
+		t.Fatalf("peer_reconnecting for %s, want bob", reconnecting.PeerID)
+	}
+
+	// Frames sent while bob is away are waiting on the new connection
+	send(t, alice, `{"type":"chat","data":{"message":"you missed this"}}`)
+
+	var resumed RoomJoinedData
+	again := dialTest(t, url+"?u=bob&resume="+joined.ResumeToken)
+	readEvent(t, again, "room_joined", &resumed)
+	if !resumed.Resumed || resumed.PeerID != joined.PeerID {
+		t.Errorf("room_joined = %+v, want bob's peer resumed", resumed)
+	}
+	if resumed.ResumeToken == "" || resumed.ResumeToken == joined.ResumeToken {
+		t.Error("resuming did not issue a new resume token")
+	}
+	readEvent(t, again, "chat", nil)
+	readEvent(t, alice, "peer_resumed", nil)
+
+	// Tokens are single use
+	var rejoined RoomJoinedData
+	late := dialTest(t, url+"?u=bob&resume="+joined.ResumeToken)
+	readEvent(t, late, "room_joined", &rejoined)
+	if rejoined.Resumed || rejoined.PeerID == joined.PeerID {
+		t.Errorf("a spent token resumed peer %s", rejoined.PeerID)
+	}
+}
+
+func TestResumeGraceExpires(t *testing.T) {
+	waitHandlers(t)
+	previous := cfg.Chat.ResumeGrace
+	cfg.Chat.ResumeGrace = config.Duration(300 * time.Millisecond)
+	t.Cleanup(func() {
+		waitHandlers(t)
+		cfg.Chat.ResumeGrace = previous
+	})
+
+	url, alice, bob, joined := resumeRoom(t, "expired-resume-room")
+
+	bob.Close()
+	readEvent(t, alice, "peer_reconnecting", nil)
+	var left PeerLeftData
+	readEvent(t, alice, "peer_left", &left)
+	if left.PeerID != joined.PeerID {
+		t.Errorf("peer_left for %s, want bob", left.PeerID)
+	}
+
+	var rejoined RoomJoinedData
+	again := dialTest(t, url+"?u=bob&resume="+joined.ResumeToken)
+	readEvent(t, again, "room_joined", &rejoined)
+	if rejoined.Resumed || rejoined.PeerID == joined.PeerID {
+		t.Errorf("room_joined = %+v, want a new peer once the grace is over", rejoined)
+	}
+}
+
+func TestResumeRefusesOtherUsers(t *testing.T) {
+	url, alice, bob, joined := resumeRoom(t, "stolen-resume-room")
+
+	bob.Close()
+	readEvent(t, alice, "peer_reconnecting", nil)
+
+	// Someone else's token joins the thief as themselves
+	var stolen RoomJoinedData
+	mallory := dialTest(t, url+"?u=mallory&resume="+joined.ResumeToken)
+	readEvent(t, mallory, "room_joined", &stolen)
+	if stolen.Resumed || stolen.PeerID == joined.PeerID {
+		t.Fatalf("mallory resumed bob's peer %s", stolen.PeerID)
+	}
+
+	// Bob's place is still kept
+	var resumed RoomJoinedData
+	again := dialTest(t, url+"?u=bob&resume="+joined.ResumeToken)
+	readEvent(t, again, "room_joined", &resumed)
+	if !resumed.Resumed || resumed.PeerID != joined.PeerID {
+		t.Errorf("room_joined = %+v, want bob's peer resumed", resumed)
+	}
+}
+
+func TestResumeReplacesLiveConnection(t *testing.T) {
+	url, alice, bob, joined := resumeRoom(t, "replaced-resume-room")
+
+	// The client noticed a dead connection before the server did
+	var resumed RoomJoinedData
+	again := dialTest(t, url+"?u=bob&resume="+joined.ResumeToken)
+	readEvent(t, again, "room_joined", &resumed)
+	if !resumed.Resumed || resumed.PeerID != joined.PeerID {
+		t.Errorf("room_joined = %+v, want bob's peer resumed", resumed)
+	}
+	readClosed(t, bob)
+	readEvent(t, alice, "peer_resumed", nil)
+
+	// The peer stays in the room on its new connection
+	send(t, alice, `{"type":"chat","data":{"message":"still here?"}}`)
+	readEvent(t, again, "chat", nil)
+}
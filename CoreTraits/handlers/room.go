@@ -1,26 +1,74 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
 )
 
-// RoomManager handles the management of WebRTC rooms
+// RoomManager handles the management of WebRTC rooms. It is safe for
+// concurrent use.
 type RoomManager struct {
-	Rooms map[string]*Room
+	rooms map[string]*Room
+	mutex sync.RWMutex
+}
+
+// RoomMetadata describes what a room is for
+type RoomMetadata struct {
+	Name     string   `json:"name"`
+	OwnerID  string   `json:"owner_id"`
+	Tags     []string `json:"tags"`
+	CourseID string   `json:"course_id,omitempty"`
 }
 
 // Room represents a WebRTC meeting room
 type Room struct {
 	ID        string
 	CreatedAt time.Time
+	Metadata  RoomMetadata
 	Peers     map[string]*Peer
-	Hub       *Hub
+	Viewers   map[string]*chat.Client // Viewer connections, which are not peers
+	Hub       *chat.Hub
+	RTC       *webrtc.Room // Server-side peer connections for the room
+	
+	// User IDs banned for the rest of the room's life
+	banned map[string]bool
+	
+	// Clients waiting in the lobby, by peer ID
+	lobby map[string]*lobbyEntry
+	
+	// Breakout rooms: the room a breakout was spawned from, or the open
+	// breakouts of a parent with the parent role of each user sent to them
+	Parent          *Room
+	breakouts       []*Room
+	breakoutRoles   map[string]chat.Role
+	breakoutsEnding bool
+	
+	// Raised hands, in the order they were raised
+	hands []RaisedHand
+	
+	// Peer IDs by the resume token issued to them
+	resumeTokens map[string]string
+	
+	// Janitor state: whether the expiry warning and start reminder went out
+	// and since when the room is empty
+	expiryWarned  bool
+	startReminded bool
+	emptySince    time.Time
+	
+	// Lets early joiners in when a scheduled room opens
+	opening *time.Timer
+
+	// Lock for concurrent access to Metadata and the Peers, Viewers, banned, lobby, breakout and resume fields
+	mutex sync.RWMutex
 }
 
 // Peer represents a WebRTC peer connection
@@ -28,11 +76,61 @@ type Peer struct {
 	ID        string
 	UserID    string
 	Username  string
-	Role      string // "moderator" or "participant"
-	Conn      *websocket.Conn
+	Role      chat.Role
+	Client    *chat.Client
 	Room      *Room
+	RTC       *webrtc.Peer
 	IsAlive   bool
 	Settings  PeerSettings
+	
+	// Token the peer resumes with, and the timer removing it for good
+	// while its connection is lost
+	resumeToken string
+	held        *time.Timer
+	
+	// Media a moderator switched off, which the peer may not switch back on
+	// until a moderator allows it
+	forcedOff map[webrtc.MediaKind]bool
+}
+
+// RoomJoinedData is the payload of the room_joined event sent to a new peer,
+// telling it which peer ID to signal with and what its role allows. The
+// resume token lets it reclaim the peer if its connection drops; resumed
+// peers get the event again with Resumed set.
+type RoomJoinedData struct {
+	RoomID       string            `json:"room_id"`
+	PeerID       string            `json:"peer_id"`
+	Role         chat.Role         `json:"role"`
+	Capabilities []chat.Capability `json:"capabilities"`
+	ResumeToken  string            `json:"resume_token,omitempty"`
+	Resumed      bool              `json:"resumed,omitempty"`
+}
+
+// PeerJoinedData is the payload of a peer_joined event
+type PeerJoinedData struct {
+	PeerID   string    `json:"peer_id"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Role     chat.Role `json:"role"`
+}
+
+// PeerLeftData is the payload of a peer_left event
+type PeerLeftData struct {
+	PeerID string `json:"peer_id"`
+	UserID string `json:"user_id"`
+}
+
+// ViewerEventData is the payload of viewer_joined and viewer_left events
+type ViewerEventData struct {
+	ViewerID string `json:"viewer_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// JoinErrorData is the payload of the error event sent to a client that
+// could not join
+type JoinErrorData struct {
+	Message string `json:"message"`
 }
 
 // PeerSettings represents user device settings
@@ -42,69 +140,110 @@ type PeerSettings struct {
 	ScreenShare bool `json:"screen_share"`
 }
 
-// Hub represents the broadcasting hub for a room
-type Hub struct {
-	Clients    map[*Client]bool
-	Broadcast  chan []byte
-	Register   chan *Client
-	Unregister chan *Client
+// NewRoomManager creates a new RoomManager
+func NewRoomManager() *RoomManager {
+	return &RoomManager{
+		rooms: make(map[string]*Room),
+	}
+}
+
+// Get returns the room with the given ID
+func (m *RoomManager) Get(roomID string) (*Room, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	room, exists := m.rooms[roomID]
+	return room, exists
 }
 
-// Client represents a connected WebSocket client
-type Client struct {
-	ID     string
-	UserID string
-	Hub    *Hub
-	Conn   *websocket.Conn
-	Send   chan []byte
+// Add registers a room under its ID
+func (m *RoomManager) Add(room *Room) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	m.rooms[room.ID] = room
 }
 
-// NewRoomManager creates a new RoomManager
-func NewRoomManager() *RoomManager {
-	return &RoomManager{
-		Rooms: make(map[string]*Room),
+// Remove unregisters the room with the given ID
+func (m *RoomManager) Remove(roomID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	delete(m.rooms, roomID)
+}
+
+// List returns a snapshot of the registered rooms
+func (m *RoomManager) List() []*Room {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
 	}
+	return rooms
+}
+
+// Count returns the number of registered rooms
+func (m *RoomManager) Count() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	return len(m.rooms)
 }
 
 // Global instance of the RoomManager
 var roomManager = NewRoomManager()
 
-// RoomCreate creates a new room
-func RoomCreate(c *fiber.Ctx) error {
-	roomID := uuid.New().String()
-	
+// newRoom creates a room with its hub and server-side WebRTC session and
+// registers it. Breakout rooms pass the room they were spawned from.
+func newRoom(roomID string, meta RoomMetadata, config webrtc.RoomConfig, parent *Room) *Room {
 	// Create a new hub for the room
-	hub := &Hub{
-		Clients:    make(map[*Client]bool),
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-	}
+	hub := chat.NewHub(roomID)
 	
-	// Create the room
+	// Create the room with its server-side WebRTC session
 	room := &Room{
-		ID:        roomID,
-		CreatedAt: time.Now(),
-		Peers:     make(map[string]*Peer),
-		Hub:       hub,
+		ID:            roomID,
+		CreatedAt:     time.Now(),
+		Metadata:      meta,
+		Peers:         make(map[string]*Peer),
+		Viewers:       make(map[string]*chat.Client),
+		Hub:           hub,
+		banned:        make(map[string]bool),
+		lobby:         make(map[string]*lobbyEntry),
+		Parent:        parent,
+		breakoutRoles: make(map[string]chat.Role),
+		resumeTokens:  make(map[string]string),
+		RTC:           webrtc.NewRoom(roomID, meta.Name, config),
 	}
 	
-	// Register the room
-	roomManager.Rooms[roomID] = room
+	// Route answers, offers and ICE candidates from the server back to the owning client
+	room.RTC.SetOnSignalCallback(room.deliverSignal)
+	room.RTC.SetOnSignalErrorCallback(room.deliverSignalError)
+	room.RTC.SetAuthorizeCallback(room.authorize)
+	
+	// Bring everyone back when the breakout time is up. The announced end
+	// time is now, so there is no countdown left to give.
+	room.RTC.SetOnBreakoutsEndCallback(func() {
+		room.endBreakouts(0, "timer")
+	})
+	
+	// Register the room, scheduled ones to let early joiners in when they open
+	room.scheduleOpening(config.Schedule)
+	roomManager.Add(room)
 	
 	// Start the hub
-	go hub.Run()
+	go hub.Run(sessions)
 	
-	return c.JSON(fiber.Map{
-		"success": true,
-		"room_id": roomID,
-	})
+	return room
 }
 
-// Room displays info about a room
-func Room(c *fiber.Ctx) error {
+// GetRoom displays info about a room. Its owner, course and join URLs are
+// only shown to those who may join, so it must run after RequireToken and
+// RequireRoomAccess.
+func GetRoom(c *fiber.Ctx) error {
 	roomID := c.Params("uuid")
-	room, exists := roomManager.Rooms[roomID]
+	room, exists := roomManager.Get(roomID)
 	
 	if !exists {
 		return c.Status(404).JSON(fiber.Map{
@@ -113,195 +252,253 @@ func Room(c *fiber.Ctx) error {
 		})
 	}
 	
-	// Get peer count
-	peerCount := len(room.Peers)
+	response := roomResource(c, room, "")
+	response["success"] = true
 	
-	return c.JSON(fiber.Map{
-		"success":    true,
-		"room_id":    roomID,
-		"peer_count": peerCount,
-		"created_at": room.CreatedAt,
-	})
+	return c.JSON(response)
 }
 
 // RoomWebsocket handles WebSocket connections to a room
 func RoomWebsocket(c *websocket.Conn) {
+	if !trackConnection(c) {
+		rejectConnection(c)
+		return
+	}
+	defer untrackConnection(c)
+	
 	// Extract roomID from URL parameters
+	// The user was authenticated by RequireToken before the upgrade
 	roomID := c.Params("uuid")
-	userID := c.Query("user_id")
-	username := c.Query("username")
-	role := c.Query("role")
+	user := identity(c)
+	userID := user.UserID
+	username := user.Username
 	
-	if userID == "" || username == "" {
+	// Check if room exists
+	room, exists := roomManager.Get(roomID)
+	if !exists {
 		c.Close()
 		return
 	}
 	
-	// Validate role
-	if role != "moderator" && role != "participant" {
-		role = "participant" // Default role
+	// Breakouts keep the role each user has in the parent room
+	role := room.roleFor(user)
+	if room.Parent != nil {
+		role = room.Parent.breakoutRole(userID, room.Parent.roleFor(user))
 	}
 	
-	// Check if room exists
-	room, exists := roomManager.Rooms[roomID]
-	if !exists {
-		c.Close()
+	// Peers whose connection dropped reclaim their place with their token
+	if token := c.Query("resume"); token != "" && room.resume(c, token) {
 		return
 	}
 	
-	// Create new peer
+	// Create new client, whose frames are signaling messages
 	peerID := uuid.New().String()
-	peer := &Peer{
-		ID:       peerID,
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		Room:     room,
-		IsAlive:  true,
-		Settings: PeerSettings{
-			Video:       true,
-			Audio:       true,
-			ScreenShare: false,
-		},
+	client := room.newPeerClient(c, peerID, role)
+	
+	// Create the server-side WebRTC peer for this participant
+	rtcPeer, waiting, err := room.addPeer(client, username, role)
+	if err != nil {
+		log.Printf("Failed to add peer to room %s: %v", roomID, err)
+		rejectJoin(c, err)
+		return
 	}
 	
-	// Create new client
-	client := &Client{
-		ID:     peerID,
-		UserID: userID,
-		Hub:    room.Hub,
-		Conn:   c.Conn,
-		Send:   make(chan []byte, 256),
+	// Waiting clients are not in the hub until admitted; they only hear about the lobby
+	if waiting {
+		room.notifyLobby(peerID)
+		serve(client, room.leave)
+		return
 	}
 	
+	peer := room.newPeer(client, rtcPeer, username, role)
+	
 	// Register the client with the hub
-	client.Hub.Register <- client
+	client.Hub.Join(client)
 	
 	// Register the peer with the room
+	room.mutex.Lock()
 	room.Peers[peerID] = peer
+	room.mutex.Unlock()
 	
-	// Broadcast new peer joined
-	joinMessage := fmt.Sprintf(`{"event":"peer_joined","data":{"peer_id":"%s","user_id":"%s","username":"%s","role":"%s"}}`, 
-		peerID, userID, username, role)
-	room.Hub.Broadcast <- []byte(joinMessage)
+	room.announcePeer(peer)
+	
+	// Moderators see who is already waiting
+	if role.Can(chat.CapAdmitPeers) {
+		room.notifyLobby("")
+	}
 	
 	// Start the client read/write pumps
-	go client.writePump()
-	client.readPump()
-}
-
-// Run starts the hub
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.Register:
-			h.Clients[client] = true
-		case client := <-h.Unregister:
-			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
-			}
-		case message := <-h.Broadcast:
-			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
-			}
-		}
+	serve(client, room.leave)
+}
+
+// roleFor works out the role a user joins the room with. The owner moderates
+// the room, educators present in it and everyone else participates. A role
+// in the user's token only ever lowers this, so a token cannot make its
+// holder a moderator of rooms they do not own.
+func (r *Room) roleFor(user *chat.ClientInfo) chat.Role {
+	role := chat.RoleParticipant
+	switch {
+	case r.GetMetadata().OwnerID == user.UserID:
+		role = chat.RoleModerator
+	case user.IsEducator:
+		role = chat.RolePresenter
+	}
+	
+	if limit, ok := chat.ParseRole(string(user.Role)); ok {
+		role = role.AtMost(limit)
 	}
+	return role
 }
 
-// readPump reads messages from the client
-func (c *Client) readPump() {
-	defer func() {
-		c.Hub.Unregister <- c
-		c.Conn.Close()
-		
-		// Remove peer from room
-		room := roomManager.Rooms[c.Hub.ID]
-		if room != nil {
-			delete(room.Peers, c.ID)
-			
-			// Broadcast peer left
-			leftMessage := fmt.Sprintf(`{"event":"peer_left","data":{"peer_id":"%s","user_id":"%s"}}`, 
-				c.ID, c.UserID)
-			room.Hub.Broadcast <- []byte(leftMessage)
-		}
-	}()
+// rejectJoin tells a client why it could not join and disconnects it
+func rejectJoin(c *websocket.Conn, err error) {
+	if errorMessage, err := events.Encode("error", JoinErrorData{Message: err.Error()}); err == nil {
+		c.WriteMessage(websocket.TextMessage, errorMessage)
+	}
+	c.Close()
+}
+
+// newClient creates the hub client for a websocket with the connecting
+// user's identity under the given client ID and role
+func newClient(hub *chat.Hub, c *websocket.Conn, id string, role chat.Role) *chat.Client {
+	info := *identity(c)
+	info.ID = id
+	info.Role = role
 	
-	c.Conn.SetReadLimit(512 * 1024) // 512KB
-	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.Conn.SetPongHandler(func(string) error { 
-		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil 
+	return chat.NewClient(hub, c.Conn, info)
+}
+
+// serve runs the client's read and write pumps until it disconnects and
+// calls leave, if set. Fiber releases the connection when the handler
+// returns, so serve also waits for the write pump to stop using it.
+func serve(client *chat.Client, leave func(*chat.Client)) {
+	go client.WritePump()
+	client.ReadPump()
+	
+	if leave != nil {
+		leave(client)
+	}
+	
+	<-client.Done()
+}
+
+// newPeerClient creates the hub client for a participant's websocket, whose
+// frames are signaling messages
+func (r *Room) newPeerClient(c *websocket.Conn, peerID string, role chat.Role) *chat.Client {
+	client := newClient(r.Hub, c, peerID, role)
+	client.SetOnMessageCallback(func(client *chat.Client, message []byte) bool {
+		return !r.handleSignal(client, message)
 	})
+	client.SetOnConnectionLostCallback(r.hold)
 	
-	for {
-		_, message, err := c.Conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				fmt.Printf("error: %v", err)
-			}
-			break
-		}
-		
-		// Broadcast the message
-		c.Hub.Broadcast <- message
+	return client
+}
+
+// leave removes a disconnected client from the room and tells the others.
+// Peers held for a resume stay until they resume or their grace runs out.
+func (r *Room) leave(c *chat.Client) {
+	// Clients still in the lobby never joined, so there is nothing to announce
+	if r.leaveLobby(c) {
+		return
+	}
+	
+	r.mutex.Lock()
+	peer, exists := r.Peers[c.Info.ID]
+	if !exists || peer.Client != c || peer.held != nil {
+		r.mutex.Unlock()
+		return
 	}
+	r.removePeerLocked(peer)
+	r.mutex.Unlock()
+	
+	r.finishLeave(c)
 }
 
-// writePump writes messages to the client
-func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
-	defer func() {
-		ticker.Stop()
-		c.Conn.Close()
-	}()
+// removePeerLocked forgets a peer and its resume token. The caller holds the
+// room's lock.
+func (r *Room) removePeerLocked(peer *Peer) {
+	delete(r.Peers, peer.ID)
+	delete(r.resumeTokens, peer.resumeToken)
+}
+
+// finishLeave tears down a removed peer's WebRTC session and hand and tells
+// the room it left
+func (r *Room) finishLeave(c *chat.Client) {
+	if err := r.RTC.RemovePeer(c.Info.ID); err != nil {
+		log.Printf("Failed to remove peer %s from room %s: %v", c.Info.ID, r.ID, err)
+	}
 	
-	for {
-		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				// The hub closed the channel
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-			
-			// Add queued messages
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
-			}
-			
-			if err := w.Close(); err != nil {
-				return
-			}
-		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
+	// Peers leave the queue with their connection
+	r.lowerHand(c.Info.ID, "")
+	
+	// Broadcast peer left
+	r.broadcastEvent("peer_left", PeerLeftData{
+		PeerID: c.Info.ID,
+		UserID: c.Info.UserID,
+	})
+}
+
+// GetMetadata returns a copy of the room's metadata
+func (r *Room) GetMetadata() RoomMetadata {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	meta := r.Metadata
+	meta.Tags = append([]string(nil), r.Metadata.Tags...)
+	return meta
+}
+
+// PeerCount returns the number of peers in the room
+func (r *Room) PeerCount() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return len(r.Peers)
+}
+
+// newPeer creates the room peer for a joined client
+func (r *Room) newPeer(client *chat.Client, rtcPeer *webrtc.Peer, username string, role chat.Role) *Peer {
+	return &Peer{
+		ID:       client.Info.ID,
+		UserID:   client.Info.UserID,
+		Username: username,
+		Role:     role,
+		Client:   client,
+		Room:     r,
+		RTC:      rtcPeer,
+		IsAlive:  true,
+		Settings: PeerSettings{
+			Video:       role.Can(chat.CapPublishVideo),
+			Audio:       role.Can(chat.CapPublishAudio),
+			ScreenShare: false,
+		},
 	}
 }
 
+// announcePeer welcomes a new peer and tells the room it joined
+func (r *Room) announcePeer(peer *Peer) {
+	// Tell the client which peer ID to use for signaling and what it may do
+	r.sendEvent(peer.Client, "room_joined", RoomJoinedData{
+		RoomID:       r.ID,
+		PeerID:       peer.ID,
+		Role:         peer.Role,
+		Capabilities: peer.Role.Capabilities(),
+		ResumeToken:  r.issueResumeToken(peer),
+	})
+	
+	// Broadcast new peer joined
+	r.broadcastEvent("peer_joined", PeerJoinedData{
+		PeerID:   peer.ID,
+		UserID:   peer.UserID,
+		Username: peer.Username,
+		Role:     peer.Role,
+	})
+}
+
 // RoomChat handles the chat functionality for a room
 func RoomChat(c *fiber.Ctx) error {
 	roomID := c.Params("uuid")
-	room, exists := roomManager.Rooms[roomID]
-	
-	if !exists {
+	if _, exists := roomManager.Get(roomID); !exists {
 		return c.Status(404).JSON(fiber.Map{
 			"success": false,
 			"message": "Room not found",
@@ -315,42 +512,63 @@ func RoomChat(c *fiber.Ctx) error {
 
 // RoomViewerWebsocket handles WebSocket connections for viewers
 func RoomViewerWebsocket(c *websocket.Conn) {
+	if !trackConnection(c) {
+		rejectConnection(c)
+		return
+	}
+	defer untrackConnection(c)
+	
 	// Similar to RoomWebsocket but for viewers only (no WebRTC)
 	roomID := c.Params("uuid")
-	userID := c.Query("user_id")
-	username := c.Query("username")
+	user := identity(c)
+	userID := user.UserID
+	username := user.Username
 	
-	if userID == "" || username == "" {
+	// Check if room exists
+	room, exists := roomManager.Get(roomID)
+	if !exists {
 		c.Close()
 		return
 	}
 	
-	// Check if room exists
-	room, exists := roomManager.Rooms[roomID]
-	if !exists {
-		c.Close()
+	// Viewers are let in on the same terms as peers, but cannot wait in the lobby
+	if err := room.admitViewer(user); err != nil {
+		log.Printf("Refused viewer for room %s: %v", roomID, err)
+		rejectJoin(c, err)
 		return
 	}
 	
-	// Create new client for the viewer
+	// Create new client for the viewer, who may only chat and only when the room allows it
 	clientID := uuid.New().String()
-	client := &Client{
-		ID:     clientID,
-		UserID: userID,
-		Hub:    room.Hub,
-		Conn:   c.Conn,
-		Send:   make(chan []byte, 256),
-	}
+	client := newClient(room.Hub, c, clientID, chat.RoleViewer)
+	client.SetOnMessageCallback(func(client *chat.Client, message []byte) bool {
+		if room.canChat(client) {
+			client.Chat(message)
+		}
+		return true
+	})
 	
 	// Register the client with the hub
-	client.Hub.Register <- client
+	client.Hub.Join(client)
+	
+	// Track the viewer so closing the room can disconnect it
+	room.mutex.Lock()
+	room.Viewers[clientID] = client
+	room.mutex.Unlock()
+	
+	defer func() {
+		room.mutex.Lock()
+		delete(room.Viewers, clientID)
+		room.mutex.Unlock()
+	}()
 	
 	// Broadcast new viewer joined
-	joinMessage := fmt.Sprintf(`{"event":"viewer_joined","data":{"viewer_id":"%s","user_id":"%s","username":"%s"}}`, 
-		clientID, userID, username)
-	room.Hub.Broadcast <- []byte(joinMessage)
+	room.broadcastEvent("viewer_joined", ViewerEventData{
+		ViewerID: clientID,
+		UserID:   userID,
+		Username: username,
+	})
 	
 	// Start the client read/write pumps
-	go client.writePump()
-	client.readPump()
+	serve(client, nil)
 }
\ No newline at end of file
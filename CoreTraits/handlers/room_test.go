@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+func TestRoleFor(t *testing.T) {
+	room := &Room{Metadata: RoomMetadata{OwnerID: "owner"}}
+
+	tests := []struct {
+		name string
+		user chat.ClientInfo
+		want chat.Role
+	}{
+		{"owner", chat.ClientInfo{UserID: "owner"}, chat.RoleModerator},
+		{"educator owner", chat.ClientInfo{UserID: "owner", IsEducator: true}, chat.RoleModerator},
+		{"educator", chat.ClientInfo{UserID: "teacher", IsEducator: true}, chat.RolePresenter},
+		{"student", chat.ClientInfo{UserID: "student"}, chat.RoleParticipant},
+		{"token moderator elsewhere", chat.ClientInfo{UserID: "student", Role: chat.RoleModerator}, chat.RoleParticipant},
+		{"token caps owner", chat.ClientInfo{UserID: "owner", Role: chat.RolePresenter}, chat.RolePresenter},
+		{"token viewer", chat.ClientInfo{UserID: "student", Role: chat.RoleViewer}, chat.RoleViewer},
+		{"unknown token role", chat.ClientInfo{UserID: "owner", Role: "admin"}, chat.RoleModerator},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := room.roleFor(&tt.user); got != tt.want {
+				t.Errorf("roleFor(%+v) = %s, want %s", tt.user, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Limits on room metadata
+const (
+	maxRoomNameLength = 100
+	maxRoomTags       = 10
+	maxRoomTagLength  = 32
+)
+
+// RoomConfigData is the room configuration accepted and returned by the
+// rooms resource. The access code is never returned.
+type RoomConfigData struct {
+	MaxParticipants int             `json:"max_participants"`
+	Lifetime        config.Duration `json:"lifetime"`
+	EnableChat      *bool           `json:"enable_chat,omitempty"`
+	EnableRecording bool            `json:"enable_recording"`
+	IsPrivate       bool            `json:"is_private"`
+	AccessCode      string          `json:"access_code,omitempty"`
+	EnableLobby     bool            `json:"enable_lobby"`
+	Schedule        *ScheduleData   `json:"schedule,omitempty"`
+}
+
+// RoomRequest is the body of POST /rooms
+type RoomRequest struct {
+	Name     string         `json:"name"`
+	Tags     []string       `json:"tags"`
+	CourseID string         `json:"course_id"`
+	Config   RoomConfigData `json:"config"`
+}
+
+// RoomUpdateData is the body of PATCH /rooms/:uuid; omitted fields are unchanged
+type RoomUpdateData struct {
+	Name     *string   `json:"name,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+	CourseID *string   `json:"course_id,omitempty"`
+	RoomSettingsData
+}
+
+// CreateRoom creates a room owned by the caller from a RoomRequest body.
+// Must run after RequireToken.
+func CreateRoom(c *fiber.Ctx) error {
+	if shuttingDown.Load() {
+		return rejectDuringShutdown(c)
+	}
+	
+	var request RoomRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Invalid request body: %v", err),
+			})
+		}
+	}
+	
+	schedule, err := request.Config.Schedule.schedule()
+	if err != nil {
+		return rejectRoomRequest(c, err)
+	}
+	
+	// Chat is on unless switched off
+	roomConfig := webrtc.RoomConfig{
+		MaxParticipants: request.Config.MaxParticipants,
+		Lifetime:        request.Config.Lifetime.Std(),
+		EnableChat:      request.Config.EnableChat == nil || *request.Config.EnableChat,
+		EnableRecording: request.Config.EnableRecording,
+		IsPrivate:       request.Config.IsPrivate,
+		AccessCode:      request.Config.AccessCode,
+		EnableLobby:     request.Config.EnableLobby,
+		Schedule:        schedule,
+	}
+	
+	meta := RoomMetadata{
+		Name:     strings.TrimSpace(request.Name),
+		OwnerID:  c.Locals(identityKey).(*chat.ClientInfo).UserID,
+		Tags:     request.Tags,
+		CourseID: request.CourseID,
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	
+	if err := validateMetadata(meta); err != nil {
+		return rejectRoomRequest(c, err)
+	}
+	if err := roomConfig.Validate(); err != nil {
+		return rejectRoomRequest(c, err)
+	}
+	
+	roomID := uuid.New().String()
+	
+	// Private rooms need an access code or invite to join
+	if roomConfig.IsPrivate {
+		code, err := privateAccess(roomConfig.AccessCode)
+		if err != nil {
+			log.Printf("Failed to create access code for room %s: %v", roomID, err)
+			return c.Status(500).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to create room",
+			})
+		}
+		roomConfig.AccessCode = code
+	}
+	
+	room := newRoom(roomID, meta, roomConfig, nil)
+	
+	// Only the creator learns the access code and gets invite links
+	invite := ""
+	if roomConfig.IsPrivate {
+		invite = inviter.Issue(roomID)
+	}
+	
+	response := roomResource(c, room, invite)
+	response["success"] = true
+	if roomConfig.IsPrivate {
+		response["access_code"] = roomConfig.AccessCode
+		response["invite_token"] = invite
+	}
+	
+	return c.Status(201).JSON(response)
+}
+
+// UpdateRoom changes a room's metadata and settings. Only the owner may
+// update a room. Must run after RequireToken.
+func UpdateRoom(c *fiber.Ctx) error {
+	room, err := ownedRoom(c)
+	if room == nil {
+		return err
+	}
+	
+	var update RoomUpdateData
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request body: %v", err),
+		})
+	}
+	
+	meta := room.GetMetadata()
+	if update.Name != nil {
+		meta.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Tags != nil {
+		meta.Tags = append([]string{}, *update.Tags...)
+	}
+	if update.CourseID != nil {
+		meta.CourseID = *update.CourseID
+	}
+	
+	if err := validateMetadata(meta); err != nil {
+		return rejectRoomRequest(c, err)
+	}
+	if update.MaxParticipants != nil && *update.MaxParticipants < 0 {
+		return rejectRoomRequest(c, fmt.Errorf("max_participants cannot be negative"))
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	
+	if update.Name != nil || update.Tags != nil || update.CourseID != nil {
+		room.mutex.Lock()
+		room.Metadata = meta
+		room.mutex.Unlock()
+	
+		room.broadcastEvent("room_updated", RoomUpdatedData{
+			RoomMetadata: meta,
+			ChangedBy:    info.UserID,
+		})
+	}
+	
+	if update.EnableChat != nil || update.MaxParticipants != nil || update.EnableLobby != nil {
+		room.updateSettings(update.RoomSettingsData, info.UserID)
+	}
+	
+	response := roomResource(c, room, "")
+	response["success"] = true
+	
+	return c.JSON(response)
+}
+
+// DeleteRoom closes a room and disconnects everyone in it. Only the owner may
+// delete a room. Must run after RequireToken.
+func DeleteRoom(c *fiber.Ctx) error {
+	room, err := ownedRoom(c)
+	if room == nil {
+		return err
+	}
+	
+	room.close(c.Locals(identityKey).(*chat.ClientInfo).UserID)
+	
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Room closed",
+		"room_id": room.ID,
+	})
+}
+
+// RoomUpdatedData is the payload of a room_updated event
+type RoomUpdatedData struct {
+	RoomMetadata
+	ChangedBy string `json:"changed_by"`
+}
+
+// ownedRoom looks up the room in the URL for its owner. When the room is
+// missing or owned by someone else it writes the response and returns nil.
+func ownedRoom(c *fiber.Ctx) (*Room, error) {
+	room, exists := roomManager.Get(c.Params("uuid"))
+	if !exists {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"message": "Room not found",
+		})
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	if room.GetMetadata().OwnerID != info.UserID {
+		return nil, c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "Only the room owner can change the room",
+		})
+	}
+	
+	return room, nil
+}
+
+// validateMetadata reports the first invalid metadata field
+func validateMetadata(meta RoomMetadata) error {
+	if len(meta.Name) > maxRoomNameLength {
+		return fmt.Errorf("name cannot be longer than %d characters", maxRoomNameLength)
+	}
+	if len(meta.Tags) > maxRoomTags {
+		return fmt.Errorf("a room can have at most %d tags", maxRoomTags)
+	}
+	for _, tag := range meta.Tags {
+		if tag == "" || len(tag) > maxRoomTagLength {
+			return fmt.Errorf("tags must be 1 to %d characters", maxRoomTagLength)
+		}
+	}
+	
+	return nil
+}
+
+// rejectRoomRequest answers a room request with invalid fields
+func rejectRoomRequest(c *fiber.Ctx, err error) error {
+	return c.Status(400).JSON(fiber.Map{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+// roomResource describes a room with its metadata, configuration and the
+// URLs to join it. Private rooms' URLs carry the invite, when one is given.
+func roomResource(c *fiber.Ctx, room *Room, invite string) fiber.Map {
+	meta := room.GetMetadata()
+	roomConfig := room.RTC.GetConfig()
+	enableChat := roomConfig.EnableChat
+	
+	resource := fiber.Map{
+		"room_id":    room.ID,
+		"name":       meta.Name,
+		"owner_id":   meta.OwnerID,
+		"tags":       meta.Tags,
+		"course_id":  meta.CourseID,
+		"peer_count": room.PeerCount(),
+		"created_at": room.CreatedAt,
+		"config": RoomConfigData{
+			MaxParticipants: roomConfig.MaxParticipants,
+			Lifetime:        config.Duration(roomConfig.Lifetime),
+			EnableChat:      &enableChat,
+			EnableRecording: roomConfig.EnableRecording,
+			IsPrivate:       roomConfig.IsPrivate,
+			EnableLobby:     roomConfig.EnableLobby,
+			Schedule:        scheduleData(roomConfig.Schedule),
+		},
+		"join_urls": joinURLs(c, room.ID, invite),
+	}
+	
+	if expiresAt := room.RTC.GetExpiresAt(); !expiresAt.IsZero() {
+		resource["expires_at"] = expiresAt.Format(time.RFC3339)
+	}
+	
+	// Breakouts point at their parent, parents list their open breakouts
+	if room.Parent != nil {
+		resource["parent_id"] = room.Parent.ID
+	} else if breakouts := room.openBreakouts(); len(breakouts) > 0 {
+		resource["breakouts"] = room.breakoutsData("").Breakouts
+	}
+	
+	return resource
+}
+
+// joinURLs returns the websocket URLs for joining a room as a participant,
+// viewer or chat client on the host the request came in on
+func joinURLs(c *fiber.Ctx, roomID, invite string) fiber.Map {
+	scheme := "ws"
+	if c.Protocol() == "https" {
+		scheme = "wss"
+	}
+	
+	base := fmt.Sprintf("%s://%s/room/%s", scheme, c.Hostname(), roomID)
+	query := ""
+	if invite != "" {
+		query = "?invite=" + url.QueryEscape(invite)
+	}
+	
+	return fiber.Map{
+		"participant": base + "/websocket" + query,
+		"viewer":      base + "/viewer/websocket" + query,
+		"chat":        base + "/chat/websocket" + query,
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+func TestRoomsResource(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(identityKey, &chat.ClientInfo{UserID: strings.Clone(c.Query("u"))})
+		return c.Next()
+	})
+	app.Post("/rooms", CreateRoom)
+	app.Get("/rooms/:uuid", RequireRoomAccess, GetRoom)
+	app.Patch("/rooms/:uuid", UpdateRoom)
+	app.Delete("/rooms/:uuid", DeleteRoom)
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp.StatusCode, decoded
+	}
+
+	if status, _ := do("POST", "/rooms?u=alice", `{"name":"Algebra","tags":["math","math","math","math","math","math","math","math","math","math","math"]}`); status != fiber.StatusBadRequest {
+		t.Errorf("room with too many tags = %d, want 400", status)
+	}
+
+	status, created := do("POST", "/rooms?u=alice", `{"name":"Algebra","course_id":"math-101","config":{"is_private":true}}`)
+	if status != fiber.StatusCreated {
+		t.Fatalf("create = %d %v", status, created)
+	}
+	roomID, _ := created["room_id"].(string)
+	invite, _ := created["invite_token"].(string)
+	if created["owner_id"] != "alice" || created["access_code"] == "" || invite == "" {
+		t.Fatalf("created room = %v, want alice's private room with an access code and invite", created)
+	}
+	t.Cleanup(func() {
+		if room, open := roomManager.Get(roomID); open {
+			room.close("test")
+		}
+	})
+
+	// Private rooms are only described to their owner and invitees
+	if status, room := do("GET", "/rooms/"+roomID+"?u=bob", ""); status != fiber.StatusForbidden || room["owner_id"] != nil {
+		t.Errorf("stranger get = %d %v, want 403 without room details", status, room)
+	}
+	if status, room := do("GET", "/rooms/"+roomID+"?u=bob&invite="+invite, ""); status != fiber.StatusOK || room["course_id"] != "math-101" {
+		t.Errorf("invitee get = %d %v, want the room", status, room)
+	}
+	if status, room := do("GET", "/rooms/"+roomID+"?u=alice", ""); status != fiber.StatusOK || room["access_code"] != nil {
+		t.Errorf("owner get = %d %v, want the room without its access code", status, room)
+	}
+
+	if status, _ := do("PATCH", "/rooms/"+roomID+"?u=bob", `{"name":"Mine now"}`); status != fiber.StatusForbidden {
+		t.Errorf("stranger update = %d, want 403", status)
+	}
+	status, updated := do("PATCH", "/rooms/"+roomID+"?u=alice", `{"name":"  Geometry ","tags":["math"]}`)
+	if status != fiber.StatusOK || updated["name"] != "Geometry" || updated["course_id"] != "math-101" {
+		t.Errorf("update = %d %v, want the new name and the course unchanged", status, updated)
+	}
+
+	if status, _ := do("DELETE", "/rooms/"+roomID+"?u=bob", ""); status != fiber.StatusForbidden {
+		t.Errorf("stranger delete = %d, want 403", status)
+	}
+	if status, _ := do("DELETE", "/rooms/"+roomID+"?u=alice", ""); status != fiber.StatusOK {
+		t.Errorf("delete = %d, want 200", status)
+	}
+	if status, _ := do("GET", "/rooms/"+roomID+"?u=alice", ""); status != fiber.StatusNotFound {
+		t.Errorf("get after delete = %d, want 404", status)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Kinds of scheduled session named in session_starting_soon events
+const (
+	SessionRoom   = "room"
+	SessionStream = "stream"
+)
+
+// ScheduleData is the schedule of a room or stream in requests and
+// responses. Sessions without ends_at stay open until closed; early_join is
+// reject or lobby and defaults to reject.
+type ScheduleData struct {
+	StartsAt   time.Time       `json:"starts_at"`
+	EndsAt     *time.Time      `json:"ends_at,omitempty"`
+	JoinWindow config.Duration `json:"join_window"`
+	EarlyJoin  string          `json:"early_join"`
+}
+
+// SessionStartingSoonData is the payload of a session_starting_soon event
+type SessionStartingSoonData struct {
+	SessionID       string    `json:"session_id"`
+	Kind            string    `json:"kind"`
+	StartsAt        time.Time `json:"starts_at"`
+	StartsInSeconds int       `json:"starts_in_seconds"`
+}
+
+// schedule returns the requested schedule, or none when d is nil
+func (d *ScheduleData) schedule() (webrtc.Schedule, error) {
+	if d == nil {
+		return webrtc.Schedule{}, nil
+	}
+	
+	schedule := webrtc.Schedule{
+		StartsAt:   d.StartsAt,
+		JoinWindow: d.JoinWindow.Std(),
+		EarlyJoin:  d.EarlyJoin,
+	}
+	if d.EndsAt != nil {
+		schedule.EndsAt = *d.EndsAt
+	}
+	if schedule.IsScheduled() && schedule.EarlyJoin == "" {
+		schedule.EarlyJoin = webrtc.EarlyJoinReject
+	}
+	
+	if err := schedule.Validate(); err != nil {
+		return schedule, err
+	}
+	if !schedule.EndsAt.IsZero() && !schedule.EndsAt.After(time.Now()) {
+		return schedule, errors.New("schedule ends_at is in the past")
+	}
+	
+	return schedule, nil
+}
+
+// scheduleData describes a schedule for responses, or nil when the session
+// is not scheduled
+func scheduleData(schedule webrtc.Schedule) *ScheduleData {
+	if !schedule.IsScheduled() {
+		return nil
+	}
+	
+	data := &ScheduleData{
+		StartsAt:   schedule.StartsAt,
+		JoinWindow: config.Duration(schedule.JoinWindow),
+		EarlyJoin:  schedule.EarlyJoin,
+	}
+	if !schedule.EndsAt.IsZero() {
+		endsAt := schedule.EndsAt
+		data.EndsAt = &endsAt
+	}
+	
+	return data
+}
+
+// earlyJoinError reports why a joiner arriving before a scheduled session
+// opens is turned away, or nil when it may wait in the lobby or is on time
+func earlyJoinError(kind string, schedule webrtc.Schedule, now time.Time) error {
+	if schedule.EarlyJoin == webrtc.EarlyJoinLobby {
+		return nil
+	}
+	
+	return notOpenError(kind, schedule, now)
+}
+
+// notOpenError reports why a joiner who cannot wait in a lobby is turned
+// away before a scheduled session opens, or nil when it is open
+func notOpenError(kind string, schedule webrtc.Schedule, now time.Time) error {
+	if !schedule.IsEarly(now) {
+		return nil
+	}
+	
+	return fmt.Errorf("the %s opens for joins at %s", kind, schedule.OpensAt().Format(time.RFC3339))
+}
+
+// startsSoon reports whether a reminder that a scheduled session starts is
+// due at the given time
+func startsSoon(schedule webrtc.Schedule, now time.Time) bool {
+	lead := cfg.Janitor.StartReminder.Std()
+	return schedule.IsScheduled() && lead > 0 && now.Before(schedule.StartsAt) && schedule.StartsAt.Sub(now) <= lead
+}
+
+// startingSoonData describes a session starting soon at the given time
+func startingSoonData(sessionID, kind string, schedule webrtc.Schedule, now time.Time) SessionStartingSoonData {
+	return SessionStartingSoonData{
+		SessionID:       sessionID,
+		Kind:            kind,
+		StartsAt:        schedule.StartsAt,
+		StartsInSeconds: int(schedule.StartsAt.Sub(now).Seconds()),
+	}
+}
+
+// scheduleOpening lets joiners waiting for a scheduled room in when it
+// opens. Rooms with a lobby leave them to the moderators.
+func (r *Room) scheduleOpening(schedule webrtc.Schedule) {
+	if !schedule.IsEarly(time.Now()) {
+		return
+	}
+	
+	r.opening = time.AfterFunc(time.Until(schedule.OpensAt()), func() {
+		if room, open := roomManager.Get(r.ID); !open || room != r {
+			return
+		}
+	
+		if r.RTC.GetConfig().EnableLobby {
+			r.notifyLobby("")
+			return
+		}
+		r.admitAll()
+	})
+}
+
+// remindStart tells the room's peers and the joiners waiting for it to open
+// that it starts soon
+func (r *Room) remindStart(schedule webrtc.Schedule, now time.Time) {
+	reminder := startingSoonData(r.ID, SessionRoom, schedule, now)
+	
+	r.broadcastEvent("session_starting_soon", reminder)
+	r.RTC.Announce("session_starting_soon", reminder)
+	
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	for _, entry := range r.lobby {
+		if !entry.denied {
+			r.sendEvent(entry.Client, "session_starting_soon", reminder)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestEarlyJoinError(t *testing.T) {
+	now := time.Now()
+	later := webrtc.Schedule{StartsAt: now.Add(time.Hour), EarlyJoin: webrtc.EarlyJoinReject}
+	lobby := webrtc.Schedule{StartsAt: now.Add(time.Hour), EarlyJoin: webrtc.EarlyJoinLobby}
+	open := webrtc.Schedule{StartsAt: now.Add(-time.Minute), EarlyJoin: webrtc.EarlyJoinReject}
+
+	tests := []struct {
+		name      string
+		schedule  webrtc.Schedule
+		earlyJoin bool
+		notOpen   bool
+	}{
+		{"unscheduled", webrtc.Schedule{}, false, false},
+		{"early reject", later, true, true},
+		{"early lobby", lobby, false, true},
+		{"open", open, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := earlyJoinError(SessionRoom, tt.schedule, now); (err != nil) != tt.earlyJoin {
+				t.Errorf("earlyJoinError() = %v, want error %v", err, tt.earlyJoin)
+			}
+			if err := notOpenError(SessionRoom, tt.schedule, now); (err != nil) != tt.notOpen {
+				t.Errorf("notOpenError() = %v, want error %v", err, tt.notOpen)
+			}
+		})
+	}
+}
+
+func TestAdmitViewer(t *testing.T) {
+	early := webrtc.Schedule{StartsAt: time.Now().Add(time.Hour), EarlyJoin: webrtc.EarlyJoinLobby}
+
+	tests := []struct {
+		name   string
+		config webrtc.RoomConfig
+		user   chat.ClientInfo
+		want   string
+	}{
+		{"open room", webrtc.RoomConfig{}, chat.ClientInfo{UserID: "student"}, ""},
+		{"not admitted", webrtc.RoomConfig{EnableLobby: true}, chat.ClientInfo{UserID: "student"}, "lobby"},
+		{"admitted", webrtc.RoomConfig{EnableLobby: true}, chat.ClientInfo{UserID: "peer"}, ""},
+		{"owner", webrtc.RoomConfig{EnableLobby: true}, chat.ClientInfo{UserID: "owner"}, ""},
+		{"early", webrtc.RoomConfig{Schedule: early}, chat.ClientInfo{UserID: "peer"}, "opens for joins"},
+		{"early owner", webrtc.RoomConfig{Schedule: early}, chat.ClientInfo{UserID: "owner"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := &Room{
+				Metadata: RoomMetadata{OwnerID: "owner"},
+				Peers:    map[string]*Peer{"p1": {ID: "p1", UserID: "peer"}},
+				RTC:      webrtc.NewRoom("room", "", tt.config),
+			}
+
+			err := room.admitViewer(&tt.user)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("admitViewer() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("admitViewer() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateStreamRejectsLobby(t *testing.T) {
+	app := fiber.New()
+	app.Post("/streams", func(c *fiber.Ctx) error {
+		c.Locals(identityKey, &chat.ClientInfo{UserID: "streamer", Username: "streamer"})
+		return c.Next()
+	}, CreateStream)
+
+	startsAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := `{"title":"Lecture","schedule":{"starts_at":"` + startsAt + `","early_join":"lobby"}}`
+	req := httptest.NewRequest("POST", "/streams", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if count := streamManager.Count(); count != 0 {
+		t.Errorf("streams = %d, want none created", count)
+	}
+}
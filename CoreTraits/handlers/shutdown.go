@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// Time given to write pumps to flush the shutdown notice before connections are closed
+const shutdownFlushDelay = time.Second
+
+var (
+	// Set once the server starts draining
+	shuttingDown atomic.Bool
+
+	// Open websocket connections, waited on during shutdown
+	connections sync.WaitGroup
+	activeConns = make(map[*websocket.Conn]struct{})
+	connMutex   sync.Mutex
+	
+	// Parent of every hub's Run, cancelled by Shutdown to stop them all
+	sessions, endSessions = context.WithCancel(context.Background())
+)
+
+// trackConnection registers an open websocket so shutdown can close and wait
+// for it. It reports false once the server is shutting down.
+func trackConnection(c *websocket.Conn) bool {
+	connMutex.Lock()
+	defer connMutex.Unlock()
+	
+	if shuttingDown.Load() {
+		return false
+	}
+	
+	connections.Add(1)
+	activeConns[c] = struct{}{}
+	
+	return true
+}
+
+// untrackConnection marks a websocket handler as finished
+func untrackConnection(c *websocket.Conn) {
+	connMutex.Lock()
+	delete(activeConns, c)
+	connMutex.Unlock()
+	
+	connections.Done()
+}
+
+// closeConnection sends a close frame to a tracked websocket and closes it,
+// waiting no longer than ctx allows for a slow client. Connections whose
+// handler already returned are skipped, as Fiber reuses them.
+func closeConnection(ctx context.Context, c *websocket.Conn) {
+	connMutex.Lock()
+	defer connMutex.Unlock()
+	
+	if _, active := activeConns[c]; !active {
+		return
+	}
+	
+	deadline := time.Now().Add(cfg.Chat.WriteWait.Std())
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutting down")
+	c.WriteControl(websocket.CloseMessage, closeMessage, deadline)
+	
+	// Hijacked connections are only closed once their handler returns,
+	// so expire the read deadline to end the blocked read
+	c.SetReadDeadline(time.Now())
+	c.Close()
+}
+
+// rejectConnection tells a client that arrived during shutdown to reconnect later
+func rejectConnection(c *websocket.Conn) {
+	c.WriteMessage(websocket.TextMessage, shutdownMessage())
+	c.Close()
+}
+
+// rejectDuringShutdown answers HTTP requests that would start a new session
+func rejectDuringShutdown(c *fiber.Ctx) error {
+	return c.Status(503).JSON(fiber.Map{
+		"success":            false,
+		"message":            "Server is shutting down",
+		"reconnect_after_ms": cfg.Server.ReconnectDelay.Std().Milliseconds(),
+	})
+}
+
+// ShutdownData is the payload of a server_shutting_down event
+type ShutdownData struct {
+	ReconnectAfterMs int64 `json:"reconnect_after_ms"`
+}
+
+// shutdownData tells clients when to reconnect
+func shutdownData() ShutdownData {
+	return ShutdownData{ReconnectAfterMs: cfg.Server.ReconnectDelay.Std().Milliseconds()}
+}
+
+// shutdownMessage builds the server_shutting_down event sent to hub clients
+func shutdownMessage() []byte {
+	message, err := events.Encode("server_shutting_down", shutdownData())
+	if err != nil {
+		log.Printf("Failed to marshal server_shutting_down event: %v", err)
+	}
+	return message
+}
+
+// Shutdown drains the server: new joins are refused, every client is told to
+// reconnect, rooms are closed, hubs are stopped and drained and open
+// websockets are closed. It returns once every websocket handler has
+// finished or ctx expires.
+func Shutdown(ctx context.Context) error {
+	connMutex.Lock()
+	shuttingDown.Store(true)
+	connMutex.Unlock()
+	
+	// Tell everyone, over websockets and data channels, to reconnect later
+	message := shutdownMessage()
+	hint := shutdownData()
+	
+	rooms := roomManager.List()
+	streams := streamManager.List()
+	
+	for _, room := range rooms {
+		room.Hub.Publish(message)
+		room.RTC.Announce("server_shutting_down", hint)
+	}
+	
+	for _, stream := range streams {
+		stream.ViewerHub.Publish(message)
+		stream.ChatHub.Publish(message)
+		stream.RTC.Announce("server_shutting_down", hint)
+	}
+	
+	// Let the write pumps flush the notice
+	select {
+	case <-time.After(shutdownFlushDelay):
+	case <-ctx.Done():
+	}
+	
+	// Tear down the WebRTC sessions. Ending a stream tells its clients and
+	// closes its peer connections.
+	for _, room := range rooms {
+		room.RTC.Close()
+	}
+	
+	for _, stream := range streams {
+		stream.changeStatus(StreamEnded, "shutdown")
+	}
+	
+	// Stop every hub and wait for their clients' write pumps to finish
+	hubs := []*chat.Hub{}
+	for _, room := range rooms {
+		hubs = append(hubs, room.Hub)
+	}
+	for _, stream := range streams {
+		hubs = append(hubs, stream.ViewerHub, stream.ChatHub)
+	}
+	
+	endSessions()
+	for _, hub := range hubs {
+		select {
+		case <-hub.Done():
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for hubs to drain: %v", ctx.Err())
+		}
+	}
+	log.Printf("All hubs drained")
+	
+	// Close the remaining websockets so the read pumps return, working from
+	// a snapshot so handlers can finish meanwhile
+	connMutex.Lock()
+	conns := make([]*websocket.Conn, 0, len(activeConns))
+	for c := range activeConns {
+		conns = append(conns, c)
+	}
+	connMutex.Unlock()
+	
+	for _, c := range conns {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("timed out closing websocket connections: %v", err)
+		}
+		closeConnection(ctx, c)
+	}
+	
+	// Wait for every websocket handler to return
+	done := make(chan struct{})
+	go func() {
+		connections.Wait()
+		close(done)
+	}()
+	
+	select {
+	case <-done:
+		log.Printf("All websocket connections drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for websocket connections to drain: %v", ctx.Err())
+	}
+}
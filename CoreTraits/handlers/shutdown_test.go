@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+func TestShutdownDrainsSessions(t *testing.T) {
+	base := testServer(t)
+
+	// Shutdown is once per process, so let later tests start sessions again
+	t.Cleanup(func() {
+		shuttingDown.Store(false)
+		sessions, endSessions = context.WithCancel(context.Background())
+	})
+
+	room := newRoom("drain-room", RoomMetadata{OwnerID: "alice"}, webrtc.RoomConfig{}, nil)
+	t.Cleanup(func() { roomManager.Remove(room.ID) })
+	alice := dialTest(t, base+"/room/drain-room/websocket?u=alice")
+	readEvent(t, alice, "room_joined", nil)
+
+	streamer := dialTest(t, base+"/stream/drain-stream/websocket?u=sam")
+	readEvent(t, streamer, "streamer_connected", nil)
+	t.Cleanup(func() { streamManager.Remove("drain-stream") })
+	viewer := dialTest(t, base+"/stream/drain-stream/viewer/websocket?u=vic")
+	readEvent(t, viewer, "viewer_joined", nil)
+
+	stream, _ := streamManager.Get("drain-stream")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- Shutdown(ctx) }()
+
+	// Clients hear about the shutdown, then streams end, then the server closes
+	var hint ShutdownData
+	readEvent(t, alice, "server_shutting_down", &hint)
+	if hint.ReconnectAfterMs != cfg.Server.ReconnectDelay.Std().Milliseconds() {
+		t.Errorf("reconnect_after_ms = %d, want the configured delay", hint.ReconnectAfterMs)
+	}
+	readEvent(t, viewer, "server_shutting_down", nil)
+
+	var ended StreamStatusData
+	readEvent(t, viewer, "stream_ended", &ended)
+	if ended.Previous != StreamLive || ended.ChangedBy != "shutdown" {
+		t.Errorf("stream_ended = %+v, want a live stream ended by the shutdown", ended)
+	}
+
+	for _, conn := range []*fws.Conn{alice, streamer, viewer} {
+		readClosed(t, conn)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown() = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+
+	if room.RTC.GetPeerCount() != 0 {
+		t.Error("room peers are still connected")
+	}
+	if stream.GetStatus() != StreamEnded {
+		t.Errorf("stream status = %s, want ended", stream.GetStatus())
+	}
+	if _, err := stream.RTC.AddViewer("late", "late", "late"); err == nil {
+		t.Error("the stream's peer connections were not closed")
+	}
+
+	// Joins arriving during the drain are told to come back later
+	late := dialTest(t, base+"/room/drain-room/websocket?u=bob")
+	readEvent(t, late, "server_shutting_down", nil)
+}
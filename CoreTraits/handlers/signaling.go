@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// Signal types accepted on the room websocket
+const (
+	SignalJoin         = "join"
+	SignalOffer        = "offer"
+	SignalAnswer       = "answer"
+	SignalICECandidate = "ice-candidate"
+	SignalLeave        = "leave"
+	SignalRenegotiate  = "renegotiate"
+	SignalChat         = "chat"
+	SignalError        = "error"
+)
+
+// Error codes returned to the sender in error frames
+const (
+	ErrCodeInvalidMessage = "invalid_message"
+	ErrCodeUnknownType    = "unknown_type"
+	ErrCodePeerNotFound   = "peer_not_found"
+	ErrCodeSignalFailed   = "signal_failed"
+)
+
+// SignalErrorData is the payload of an error frame
+type SignalErrorData struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	RequestType string `json:"request_type,omitempty"`
+}
+
+// JoinData is the payload of the reply to a join frame
+type JoinData struct {
+	RoomID       string            `json:"room_id"`
+	PeerID       string            `json:"peer_id"`
+	Role         chat.Role         `json:"role"`
+	Capabilities []chat.Capability `json:"capabilities"`
+	Peers        []PeerInfo        `json:"peers"`
+	RaisedHands  []RaisedHand      `json:"raised_hands"`
+}
+
+// PeerInfo describes another participant in the room
+type PeerInfo struct {
+	PeerID   string    `json:"peer_id"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Role     chat.Role `json:"role"`
+}
+
+// handleSignal parses a signaling envelope from a participant and delivers it.
+// Offers, answers, candidates and renegotiation requests without a target (or
+// targeting the sender) go to the sender's server-side peer; anything with a
+// target goes to that peer only. It reports whether the client asked to leave.
+func (r *Room) handleSignal(c *chat.Client, message []byte) bool {
+	var signal webrtc.SignalMessage
+	if err := json.Unmarshal(message, &signal); err != nil {
+		r.sendError(c, "", ErrCodeInvalidMessage, "Message is not a valid signaling envelope")
+		return false
+	}
+	
+	// Identity is always stamped by the server so clients cannot spoof each other
+	signal.FromPeer = c.Info.ID
+	signal.SessionID = r.ID
+	
+	// Clients in the lobby may only leave until they are admitted
+	if r.isWaiting(c) {
+		return r.handleWaitingSignal(c, &signal)
+	}
+	
+	switch signal.Type {
+	case SignalJoin:
+		r.sendJoin(c)
+	case SignalLeave:
+		return true
+	case SignalChat:
+		if !r.canChat(c) {
+			r.sendError(c, signal.Type, ErrCodeForbidden, "Chat is not allowed")
+			return false
+		}
+		r.broadcastSignal(&signal)
+	case SignalMediaState:
+		r.handleMediaState(c, &signal)
+	case SignalSetRole:
+		r.handleSetRole(c, &signal)
+	case SignalUpdateSettings:
+		r.handleUpdateSettings(c, &signal)
+	case SignalCloseRoom:
+		r.handleCloseRoom(c, &signal)
+	case SignalLobbyAdmit, SignalLobbyDeny:
+		r.handleLobbyDecision(c, &signal)
+	case SignalRaiseHand:
+		r.handleRaiseHand(c, &signal)
+	case SignalLowerHand:
+		r.handleLowerHand(c, &signal)
+	case SignalCallNext:
+		r.handleCallNext(c, &signal)
+	case SignalBreakoutStart, SignalBreakoutAssign, SignalBreakoutBroadcast, SignalBreakoutJoin, SignalBreakoutEnd:
+		r.handleBreakout(c, &signal)
+	case ActionKick, ActionBan, ActionForceMuteAudio, ActionForceStopVideo, ActionStopScreenshare,
+		ActionAllowAudio, ActionAllowVideo, ActionAllowScreenshare:
+		r.handleModeration(c, &signal)
+	case SignalOffer, SignalAnswer, SignalICECandidate, SignalRenegotiate:
+		// Offers are where new media is published
+		if signal.Type == SignalOffer && !r.checkOffer(c, &signal) {
+			return false
+		}
+		
+		if signal.ToPeer == "" || signal.ToPeer == c.Info.ID {
+			signal.ToPeer = c.Info.ID
+			r.RTC.SendSignal(&signal)
+			return false
+		}
+		
+		if !r.relaySignal(&signal) {
+			r.sendError(c, signal.Type, ErrCodePeerNotFound, fmt.Sprintf("Peer %s is not in this room", signal.ToPeer))
+		}
+	default:
+		r.sendError(c, signal.Type, ErrCodeUnknownType, fmt.Sprintf("Unknown signal type %q", signal.Type))
+	}
+	
+	return false
+}
+
+// deliverSignal sends a server-generated signaling message to the peer it is addressed to
+func (r *Room) deliverSignal(signal *webrtc.SignalMessage) {
+	if !r.relaySignal(signal) {
+		log.Printf("Dropping %s signal for unknown peer %s in room %s", signal.Type, signal.ToPeer, r.ID)
+	}
+}
+
+// deliverSignalError reports a signal the server-side peer failed to process to its sender
+func (r *Room) deliverSignalError(signal *webrtc.SignalMessage, err error) {
+	r.mutex.RLock()
+	peer, exists := r.Peers[signal.FromPeer]
+	r.mutex.RUnlock()
+	
+	if !exists {
+		return
+	}
+	
+	r.sendError(peer.Client, signal.Type, ErrCodeSignalFailed, err.Error())
+}
+
+// relaySignal sends a signal to the client of signal.ToPeer only.
+// It reports whether the target peer exists.
+func (r *Room) relaySignal(signal *webrtc.SignalMessage) bool {
+	r.mutex.RLock()
+	peer, exists := r.Peers[signal.ToPeer]
+	r.mutex.RUnlock()
+	
+	if !exists {
+		return false
+	}
+	
+	r.sendFrame(peer.Client, signal)
+	
+	return true
+}
+
+// broadcastSignal sends a signal to every participant in the room
+func (r *Room) broadcastSignal(signal *webrtc.SignalMessage) {
+	signalBytes, err := json.Marshal(signal)
+	if err != nil {
+		log.Printf("Failed to marshal signal: %v", err)
+		return
+	}
+	
+	r.Hub.Publish(signalBytes)
+}
+
+// sendJoin replies to a join frame with the sender's identity, the current peers
+// and the raise-hand queue
+func (r *Room) sendJoin(c *chat.Client) {
+	var role chat.Role
+	
+	r.mutex.RLock()
+	peers := make([]PeerInfo, 0, len(r.Peers))
+	for _, peer := range r.Peers {
+		if peer.ID == c.Info.ID {
+			role = peer.Role
+			continue
+		}
+		peers = append(peers, PeerInfo{
+			PeerID:   peer.ID,
+			UserID:   peer.UserID,
+			Username: peer.Username,
+			Role:     peer.Role,
+		})
+	}
+	hands := r.handQueue()
+	r.mutex.RUnlock()
+	
+	data, err := json.Marshal(JoinData{
+		RoomID:       r.ID,
+		PeerID:       c.Info.ID,
+		Role:         role,
+		Capabilities: role.Capabilities(),
+		Peers:        peers,
+		RaisedHands:  hands,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal join reply: %v", err)
+		return
+	}
+	
+	r.sendFrame(c, &webrtc.SignalMessage{
+		Type:      SignalJoin,
+		ToPeer:    c.Info.ID,
+		SessionID: r.ID,
+		Data:      data,
+	})
+}
+
+// sendError sends a typed error frame to a single client
+func (r *Room) sendError(c *chat.Client, requestType, code, message string) {
+	data, err := json.Marshal(SignalErrorData{Code: code, Message: message, RequestType: requestType})
+	if err != nil {
+		log.Printf("Failed to marshal error frame: %v", err)
+		return
+	}
+	
+	r.sendFrame(c, &webrtc.SignalMessage{
+		Type:      SignalError,
+		ToPeer:    c.Info.ID,
+		SessionID: r.ID,
+		Data:      data,
+	})
+}
+
+// sendFrame queues a signaling frame on a single client's send buffer
+func (r *Room) sendFrame(c *chat.Client, signal *webrtc.SignalMessage) {
+	signalBytes, err := json.Marshal(signal)
+	if err != nil {
+		log.Printf("Failed to marshal signal: %v", err)
+		return
+	}
+	
+	if !c.Queue(signalBytes) {
+		log.Printf("Send buffer full for peer %s, dropping %s signal", c.Info.ID, signal.Type)
+	}
+}
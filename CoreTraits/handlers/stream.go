@@ -1,17 +1,39 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// Stream statuses. A stream is scheduled until its owner starts it, can be
+// paused and resumed while live, and never leaves ended.
+const (
+	StreamScheduled = "scheduled"
+	StreamLive      = "live"
+	StreamPaused    = "paused"
+	StreamEnded     = "ended"
 )
 
-// StreamManager handles the management of streaming sessions
+// errInvalidTransition is returned for a status change the current status does not allow
+var errInvalidTransition = errors.New("invalid stream status change")
+
+// StreamManager handles the management of streaming sessions. It is safe
+// for concurrent use.
 type StreamManager struct {
-	Streams map[string]*Stream
+	streams map[string]*Stream
+	mutex   sync.RWMutex
 }
 
 // Stream represents a streaming session
@@ -20,12 +42,22 @@ type Stream struct {
 	UserID     string
 	Username   string
 	CreatedAt  time.Time
-	Status     string // "live", "ended"
-	ViewerHub  *Hub   // Hub for viewers
-	ChatHub    *Hub   // Hub for chat messages
+	Status     string         // "scheduled", "live", "paused", "ended"
+	ViewerHub  *chat.Hub      // Hub for viewers
+	ChatHub    *chat.Hub      // Hub for chat messages
+	RTC        *webrtc.Stream // Server-side peer connections for the streamer and viewers
 	Settings   StreamSettings
 	Viewers    map[string]*Viewer
 	Statistics StreamStatistics
+	
+	// When a scheduled stream runs; fixed once the stream is registered
+	Schedule webrtc.Schedule
+	
+	// Janitor state: whether the start reminder went out
+	startReminded bool
+	
+	// Lock for concurrent access to Status, Settings, Viewers, Statistics and janitor state
+	mutex sync.RWMutex
 }
 
 // StreamSettings represents configuration for a stream
@@ -34,6 +66,7 @@ type StreamSettings struct {
 	Description string `json:"description"`
 	EnableChat  bool   `json:"enable_chat"`
 	IsPrivate   bool   `json:"is_private"`
+	AccessCode  string `json:"-"` // Never sent to clients
 	MaxViewers  int    `json:"max_viewers"`
 }
 
@@ -45,6 +78,22 @@ type StreamStatistics struct {
 	StreamEndTime   time.Time `json:"stream_end_time"`
 }
 
+// StreamerConnectedData is the payload of a streamer_connected event
+type StreamerConnectedData struct {
+	StreamID string `json:"stream_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// StreamerMessageData is the payload of a streamer_message event: a JSON
+// frame the streamer sent to its viewers
+type StreamerMessageData struct {
+	StreamID string          `json:"stream_id"`
+	UserID   string          `json:"user_id"`
+	Data     json.RawMessage `json:"data"`
+	SentAt   time.Time       `json:"sent_at"`
+}
+
 // Viewer represents a stream viewer
 type Viewer struct {
 	ID       string
@@ -55,146 +104,308 @@ type Viewer struct {
 
 // Global instance of the StreamManager
 var streamManager = &StreamManager{
-	Streams: make(map[string]*Stream),
+	streams: make(map[string]*Stream),
 }
 
-// Stream handler shows the stream page
-func Stream(c *fiber.Ctx) error {
-	streamID := c.Params("ssuid")
-	stream, exists := streamManager.Streams[streamID]
+// Get returns the stream with the given ID
+func (m *StreamManager) Get(streamID string) (*Stream, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	
-	if !exists {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Stream not found",
-		})
+	stream, exists := m.streams[streamID]
+	return stream, exists
+}
+
+// Add registers a stream under its ID
+func (m *StreamManager) Add(stream *Stream) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	m.streams[stream.ID] = stream
+}
+
+// GetOrAdd returns the stream with the given ID, registering the one built
+// by create if there is none. It reports whether create was called.
+func (m *StreamManager) GetOrAdd(streamID string, create func() *Stream) (*Stream, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	if stream, exists := m.streams[streamID]; exists {
+		return stream, false
 	}
 	
-	// Return stream details
-	return c.JSON(fiber.Map{
-		"stream_id":   streamID,
-		"user_id":     stream.UserID,
-		"username":    stream.Username,
-		"created_at":  stream.CreatedAt,
-		"status":      stream.Status,
-		"settings":    stream.Settings,
-		"viewer_count": len(stream.Viewers),
-		"statistics":  stream.Statistics,
-	})
+	stream := create()
+	m.streams[streamID] = stream
+	return stream, true
 }
 
-// CreateStream creates a new streaming session
-func CreateStream(c *fiber.Ctx) error {
-	// Extract user info from request
-	userID := c.Query("user_id")
-	username := c.Query("username")
+// Remove unregisters the stream with the given ID
+func (m *StreamManager) Remove(streamID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	
-	if userID == "" || username == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "User ID and username are required",
-		})
+	delete(m.streams, streamID)
+}
+
+// List returns a snapshot of the registered streams
+func (m *StreamManager) List() []*Stream {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	streams := make([]*Stream, 0, len(m.streams))
+	for _, stream := range m.streams {
+		streams = append(streams, stream)
 	}
+	return streams
+}
+
+// Count returns the number of registered streams
+func (m *StreamManager) Count() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	
-	// Generate a new stream ID
-	streamID := uuid.New().String()
+	return len(m.streams)
+}
+
+// GetStatus returns whether the stream is scheduled, live, paused or ended
+func (s *Stream) GetStatus() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	
-	// Create hubs for viewers and chat
-	viewerHub := &Hub{
-		Clients:    make(map[*Client]bool),
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+	return s.Status
+}
+
+// GetSettings returns a copy of the stream's settings
+func (s *Stream) GetSettings() StreamSettings {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	
+	return s.Settings
+}
+
+// GetStatistics returns a copy of the stream's viewer metrics
+func (s *Stream) GetStatistics() StreamStatistics {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	
+	return s.Statistics
+}
+
+// ViewerCount returns the number of viewers watching the stream
+func (s *Stream) ViewerCount() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	
+	return len(s.Viewers)
+}
+
+// addViewer adds a viewer unless the stream has ended or is full, updating
+// the statistics. It reports whether the viewer was added.
+func (s *Stream) addViewer(viewer *Viewer) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	if s.Status == StreamEnded || len(s.Viewers) >= s.Settings.MaxViewers {
+		return false
 	}
 	
-	chatHub := &Hub{
-		Clients:    make(map[*Client]bool),
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+	s.Viewers[viewer.ID] = viewer
+	s.Statistics.TotalViewers++
+	if len(s.Viewers) > s.Statistics.PeakViewers {
+		s.Statistics.PeakViewers = len(s.Viewers)
 	}
 	
-	// Start the hubs
-	go viewerHub.Run()
-	go chatHub.Run()
+	return true
+}
+
+// markStartReminded records that the start reminder went out. It reports
+// false if it already had.
+func (s *Stream) markStartReminded() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	if s.startReminded {
+		return false
+	}
+	s.startReminded = true
+	return true
+}
+
+// removeViewer removes a viewer that disconnected
+func (s *Stream) removeViewer(viewerID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	
-	// Create default stream settings
-	settings := StreamSettings{
-		Title:       fmt.Sprintf("%s's Stream", username),
-		Description: "Live stream",
-		EnableChat:  true,
-		IsPrivate:   false,
-		MaxViewers:  100,
+	delete(s.Viewers, viewerID)
+}
+
+// transition moves the stream to the given status and returns the status it
+// had. Moving to the current status does nothing. A stream only pauses while
+// live and cannot go live again once ended.
+func (s *Stream) transition(status string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	previous := s.Status
+	if previous == status {
+		return previous, nil
 	}
 	
-	// Create a new stream
+	switch status {
+	case StreamLive:
+		if previous == StreamEnded {
+			return previous, errInvalidTransition
+		}
+		if s.Statistics.StreamStartTime.IsZero() {
+			s.Statistics.StreamStartTime = time.Now()
+		}
+	case StreamPaused:
+		if previous != StreamLive {
+			return previous, errInvalidTransition
+		}
+	case StreamEnded:
+		s.Statistics.StreamEndTime = time.Now()
+	default:
+		return previous, errInvalidTransition
+	}
+	
+	s.Status = status
+	return previous, nil
+}
+
+// broadcastEvent sends an event frame to the stream's viewers, streamer and chat
+func (s *Stream) broadcastEvent(event string, data interface{}) {
+	eventBytes, err := events.Encode(event, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event, err)
+		return
+	}
+	
+	s.ViewerHub.Publish(eventBytes)
+	s.ChatHub.Publish(eventBytes)
+}
+
+// publishViewerEvent sends an event frame to the stream's viewers and streamer only
+func (s *Stream) publishViewerEvent(event string, data interface{}) {
+	eventBytes, err := events.Encode(event, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event, err)
+		return
+	}
+	
+	s.ViewerHub.Publish(eventBytes)
+}
+
+// handleSignal hands a signaling envelope of one of the given types to the
+// sender's server-side peer. It reports false for any other frame.
+func (s *Stream) handleSignal(c *chat.Client, message []byte, types ...string) bool {
+	var signal webrtc.SignalMessage
+	if err := json.Unmarshal(message, &signal); err != nil {
+		return false
+	}
+	
+	for _, signalType := range types {
+		if signal.Type != signalType {
+			continue
+		}
+		
+		// Identity is always stamped by the server so clients cannot spoof
+		// each other, and every signal is for the sender's own peer
+		signal.FromPeer = c.Info.ID
+		signal.ToPeer = c.Info.ID
+		signal.SessionID = s.ID
+		s.RTC.SendSignal(&signal)
+		return true
+	}
+	
+	return false
+}
+
+// deliverSignal sends a server-generated signaling message to the streamer
+// or viewer it is addressed to
+func (s *Stream) deliverSignal(signal *webrtc.SignalMessage) {
+	client := s.ViewerHub.GetClientByID(signal.ToPeer)
+	if client == nil {
+		log.Printf("Dropping %s signal for unknown peer %s on stream %s", signal.Type, signal.ToPeer, s.ID)
+		return
+	}
+	
+	signalBytes, err := json.Marshal(signal)
+	if err != nil {
+		log.Printf("Failed to marshal signal: %v", err)
+		return
+	}
+	
+	if !client.Queue(signalBytes) {
+		log.Printf("Send buffer full for peer %s, dropping %s signal", signal.ToPeer, signal.Type)
+	}
+}
+
+// sendError tells a stream client why its frame was refused
+func (s *Stream) sendError(c *chat.Client, code, message string) {
+	data, err := json.Marshal(SignalErrorData{Code: code, Message: message})
+	if err != nil {
+		log.Printf("Failed to marshal error frame: %v", err)
+		return
+	}
+	
+	s.deliverSignal(&webrtc.SignalMessage{
+		Type:      SignalError,
+		ToPeer:    c.Info.ID,
+		SessionID: s.ID,
+		Data:      data,
+	})
+}
+
+// newStream creates a stream with the given settings and starts its hubs.
+// Live streams count as started from now.
+func newStream(streamID, userID, username, status string, settings StreamSettings) *Stream {
+	// Create hubs for viewers and chat
+	viewerHub := chat.NewHub(streamID)
+	chatHub := chat.NewHub(streamID)
+	
+	// Start the hubs
+	go viewerHub.Run(sessions)
+	go chatHub.Run(sessions)
+	
 	stream := &Stream{
 		ID:        streamID,
 		UserID:    userID,
 		Username:  username,
 		CreatedAt: time.Now(),
-		Status:    "live",
+		Status:    status,
 		ViewerHub: viewerHub,
 		ChatHub:   chatHub,
+		RTC:       webrtc.NewStream(streamID, userID, username, settings.Title, webrtc.StreamConfig{}),
 		Settings:  settings,
 		Viewers:   make(map[string]*Viewer),
-		Statistics: StreamStatistics{
-			PeakViewers:     0,
-			TotalViewers:    0,
-			StreamStartTime: time.Now(),
-		},
+	}
+	if status == StreamLive {
+		stream.Statistics.StreamStartTime = stream.CreatedAt
 	}
 	
-	// Register the stream
-	streamManager.Streams[streamID] = stream
+	// Answers and ICE candidates from the server-side peers go out over the
+	// streamer's and viewers' websockets
+	stream.RTC.SetOnSignalCallback(stream.deliverSignal)
 	
-	return c.JSON(fiber.Map{
-		"success":   true,
-		"stream_id": streamID,
-	})
+	return stream
 }
 
-// EndStream ends a streaming session
-func EndStream(c *fiber.Ctx) error {
-	streamID := c.Params("ssuid")
-	userID := c.Query("user_id")
-	
-	stream, exists := streamManager.Streams[streamID]
-	if !exists {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Stream not found",
-		})
-	}
-	
-	// Verify that the user is the streamer
-	if stream.UserID != userID {
-		return c.Status(403).JSON(fiber.Map{
-			"success": false,
-			"message": "Only the streamer can end the stream",
-		})
+// defaultStreamSettings returns the settings of a new stream
+func defaultStreamSettings(username string) StreamSettings {
+	return StreamSettings{
+		Title:       fmt.Sprintf("%s's Stream", username),
+		Description: "Live stream",
+		EnableChat:  true,
+		MaxViewers:  cfg.Stream.MaxViewers,
 	}
-	
-	// Update stream status
-	stream.Status = "ended"
-	stream.Statistics.StreamEndTime = time.Now()
-	
-	// Notify all viewers that the stream has ended
-	endMessage := fmt.Sprintf(`{"event":"stream_ended","data":{"stream_id":"%s"}}`, streamID)
-	stream.ViewerHub.Broadcast <- []byte(endMessage)
-	
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Stream ended successfully",
-	})
 }
 
-// UpdateStreamSettings updates the stream settings
-func UpdateStreamSettings(c *fiber.Ctx) error {
+// GetStream shows the stream page
+func GetStream(c *fiber.Ctx) error {
 	streamID := c.Params("ssuid")
-	userID := c.Query("user_id")
+	stream, exists := streamManager.Get(streamID)
 	
-	stream, exists := streamManager.Streams[streamID]
 	if !exists {
 		return c.Status(404).JSON(fiber.Map{
 			"success": false,
@@ -202,145 +413,124 @@ func UpdateStreamSettings(c *fiber.Ctx) error {
 		})
 	}
 	
-	// Verify that the user is the streamer
-	if stream.UserID != userID {
-		return c.Status(403).JSON(fiber.Map{
-			"success": false,
-			"message": "Only the streamer can update settings",
-		})
-	}
-	
-	// Parse and update settings
-	var settings StreamSettings
-	if err := c.BodyParser(&settings); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid settings format",
-		})
-	}
-	
-	// Update settings
-	stream.Settings = settings
-	
-	// Notify all viewers about the settings update
-	updateMessage := fmt.Sprintf(`{"event":"settings_updated","data":{"stream_id":"%s","settings":%+v}}`, 
-		streamID, settings)
-	stream.ViewerHub.Broadcast <- []byte(updateMessage)
-	
+	// Return stream details
 	return c.JSON(fiber.Map{
-		"success":  true,
-		"message":  "Stream settings updated",
-		"settings": settings,
+		"stream_id":   streamID,
+		"user_id":     stream.UserID,
+		"username":    stream.Username,
+		"created_at":  stream.CreatedAt,
+		"status":      stream.GetStatus(),
+		"settings":    stream.GetSettings(),
+		"schedule":    scheduleData(stream.Schedule),
+		"viewer_count": stream.ViewerCount(),
+		"statistics":  stream.GetStatistics(),
 	})
 }
 
 // StreamWebsocket handles WebSocket connections for the streamer
 func StreamWebsocket(c *websocket.Conn) {
+	if !trackConnection(c) {
+		rejectConnection(c)
+		return
+	}
+	defer untrackConnection(c)
+	
+	// The user was authenticated by RequireToken before the upgrade
 	streamID := c.Params("ssuid")
-	userID := c.Query("user_id")
-	username := c.Query("username")
+	user := identity(c)
+	userID := user.UserID
+	username := user.Username
 	
-	// Validate query parameters
-	if userID == "" || username == "" {
+	// Create the stream if it doesn't exist, unless another connection just did
+	stream, _ := streamManager.GetOrAdd(streamID, func() *Stream {
+		return newStream(streamID, userID, username, StreamLive, defaultStreamSettings(username))
+	})
+	
+	if stream.UserID != userID {
+		// Verify that the user is the streamer
 		c.Close()
 		return
 	}
 	
-	// Check if stream exists
-	stream, exists := streamManager.Streams[streamID]
-	if !exists {
-		// Create a new stream if it doesn't exist
-		viewerHub := &Hub{
-			Clients:    make(map[*Client]bool),
-			Broadcast:  make(chan []byte),
-			Register:   make(chan *Client),
-			Unregister: make(chan *Client),
-		}
-		
-		chatHub := &Hub{
-			Clients:    make(map[*Client]bool),
-			Broadcast:  make(chan []byte),
-			Register:   make(chan *Client),
-			Unregister: make(chan *Client),
-		}
-		
-		// Start the hubs
-		go viewerHub.Run()
-		go chatHub.Run()
-		
-		stream = &Stream{
-			ID:        streamID,
-			UserID:    userID,
-			Username:  username,
-			CreatedAt: time.Now(),
-			Status:    "live",
-			ViewerHub: viewerHub,
-			ChatHub:   chatHub,
-			Viewers:   make(map[string]*Viewer),
-			Settings: StreamSettings{
-				Title:       fmt.Sprintf("%s's Stream", username),
-				Description: "Live stream",
-				EnableChat:  true,
-				IsPrivate:   false,
-				MaxViewers:  100,
-			},
-			Statistics: StreamStatistics{
-				PeakViewers:     0,
-				TotalViewers:    0,
-				StreamStartTime: time.Now(),
-			},
-		}
-		
-		streamManager.Streams[streamID] = stream
-	} else if stream.UserID != userID {
-		// Verify that the user is the streamer
+	// Ended streams cannot be restarted, scheduled ones start on connect
+	switch stream.GetStatus() {
+	case StreamEnded:
 		c.Close()
 		return
+	case StreamScheduled:
+		if _, err := stream.changeStatus(StreamLive, userID); err != nil {
+			c.Close()
+			return
+		}
 	}
 	
-	// Create a new client for the streamer
-	client := &Client{
-		ID:     userID,
-		UserID: userID,
-		Hub:    stream.ViewerHub,
-		Conn:   c.Conn,
-		Send:   make(chan []byte, 256),
+	// The streamer publishes its media through one server-side peer at a time
+	if _, err := stream.RTC.SetBroadcaster(userID, userID, username); err != nil {
+		rejectJoin(c, fmt.Errorf("cannot broadcast to the stream: %v", err))
+		return
 	}
+	defer stream.RTC.RemoveBroadcaster()
+	
+	// Create a new client for the streamer. Its signals go to its
+	// server-side peer and other JSON frames reach viewers as
+	// streamer_message events while the stream is live.
+	client := newClient(stream.ViewerHub, c, userID, chat.RolePresenter)
+	client.SetOnMessageCallback(func(client *chat.Client, message []byte) bool {
+		if stream.handleSignal(client, message, SignalOffer, SignalAnswer, SignalICECandidate) {
+			return true
+		}
+		if !json.Valid(message) {
+			stream.sendError(client, ErrCodeInvalidMessage, "Message is not valid JSON")
+			return true
+		}
+		if stream.GetStatus() == StreamLive {
+			stream.publishViewerEvent("streamer_message", StreamerMessageData{
+				StreamID: streamID,
+				UserID:   userID,
+				Data:     message,
+				SentAt:   time.Now(),
+			})
+		}
+		return true
+	})
 	
 	// Register the client with the hub
-	client.Hub.Register <- client
+	client.Hub.Join(client)
 	
 	// Notify viewers that the streamer has connected
-	startMessage := fmt.Sprintf(`{"event":"streamer_connected","data":{"stream_id":"%s","user_id":"%s","username":"%s"}}`, 
-		streamID, userID, username)
-	stream.ViewerHub.Broadcast <- []byte(startMessage)
+	stream.publishViewerEvent("streamer_connected", StreamerConnectedData{
+		StreamID: streamID,
+		UserID:   userID,
+		Username: username,
+	})
 	
 	// Start the client read/write pumps
-	go client.writePump()
-	client.readPump()
+	serve(client, nil)
 }
 
 // StreamViewerWebsocket handles WebSocket connections for stream viewers
 func StreamViewerWebsocket(c *websocket.Conn) {
-	streamID := c.Params("ssuid")
-	userID := c.Query("user_id")
-	username := c.Query("username")
-	
-	if userID == "" || username == "" {
-		c.Close()
+	if !trackConnection(c) {
+		rejectConnection(c)
 		return
 	}
+	defer untrackConnection(c)
+	
+	streamID := c.Params("ssuid")
+	user := identity(c)
+	userID := user.UserID
+	username := user.Username
 	
 	// Check if stream exists
-	stream, exists := streamManager.Streams[streamID]
-	if !exists || stream.Status == "ended" {
+	stream, exists := streamManager.Get(streamID)
+	if !exists {
 		c.Close()
 		return
 	}
 	
-	// Check if the stream has reached max viewers
-	if len(stream.Viewers) >= stream.Settings.MaxViewers {
-		c.Close()
+	// Scheduled streams turn viewers away until they open
+	if err := notOpenError(SessionStream, stream.Schedule, time.Now()); err != nil {
+		rejectJoin(c, err)
 		return
 	}
 	
@@ -353,115 +543,98 @@ func StreamViewerWebsocket(c *websocket.Conn) {
 		JoinedAt: time.Now(),
 	}
 	
-	// Register the viewer
-	stream.Viewers[viewerID] = viewer
-	
-	// Update statistics
-	stream.Statistics.TotalViewers++
-	if len(stream.Viewers) > stream.Statistics.PeakViewers {
-		stream.Statistics.PeakViewers = len(stream.Viewers)
+	// Register the viewer, turning it away if the stream ended or has reached max viewers
+	if !stream.addViewer(viewer) {
+		c.Close()
+		return
 	}
 	
-	// Create a new client for the viewer
-	client := &Client{
-		ID:     viewerID,
-		UserID: userID,
-		Hub:    stream.ViewerHub,
-		Conn:   c.Conn,
-		Send:   make(chan []byte, 256),
+	// Give the viewer a server-side peer to receive the stream's media from
+	if _, err := stream.RTC.AddViewer(viewerID, userID, username); err != nil {
+		stream.removeViewer(viewerID)
+		rejectJoin(c, err)
+		return
 	}
 	
+	// Create a new client for the viewer. Viewers only send signals for
+	// their peer through this connection, they chat over the chat connection.
+	client := newClient(stream.ViewerHub, c, viewerID, chat.RoleViewer)
+	client.SetOnMessageCallback(func(client *chat.Client, message []byte) bool {
+		stream.handleSignal(client, message, SignalOffer, SignalICECandidate)
+		return true
+	})
+	
 	// Register the client with the hub
-	client.Hub.Register <- client
+	client.Hub.Join(client)
 	
 	// Notify about the new viewer
-	joinMessage := fmt.Sprintf(`{"event":"viewer_joined","data":{"viewer_id":"%s","user_id":"%s","username":"%s"}}`, 
-		viewerID, userID, username)
-	stream.ViewerHub.Broadcast <- []byte(joinMessage)
-	
-	// Start the client read/write pumps
-	go client.writePump()
+	stream.publishViewerEvent("viewer_joined", ViewerEventData{
+		ViewerID: viewerID,
+		UserID:   userID,
+		Username: username,
+	})
 	
 	defer func() {
-		client.Hub.Unregister <- client
-		
 		// Remove viewer when they disconnect
-		delete(stream.Viewers, viewerID)
+		stream.removeViewer(viewerID)
+		stream.RTC.RemoveViewer(viewerID)
 		
 		// Notify about viewer leaving
-		leaveMessage := fmt.Sprintf(`{"event":"viewer_left","data":{"viewer_id":"%s","user_id":"%s","username":"%s"}}`, 
-			viewerID, userID, username)
-		stream.ViewerHub.Broadcast <- []byte(leaveMessage)
+		stream.publishViewerEvent("viewer_left", ViewerEventData{
+			ViewerID: viewerID,
+			UserID:   userID,
+			Username: username,
+		})
 	}()
 	
-	// Keep the connection open and handle incoming messages
-	for {
-		_, _, err := c.Conn.ReadMessage()
-		if err != nil {
-			break
-		}
-		// Viewers typically don't send messages through this connection
-		// They use the chat connection instead
-	}
+	// Start the client read/write pumps
+	serve(client, nil)
 }
 
 // StreamChatWebsocket handles WebSocket connections for stream chat
 func StreamChatWebsocket(c *websocket.Conn) {
-	streamID := c.Params("ssuid")
-	userID := c.Query("user_id")
-	username := c.Query("username")
-	
-	if userID == "" || username == "" {
-		c.Close()
+	if !trackConnection(c) {
+		rejectConnection(c)
 		return
 	}
+	defer untrackConnection(c)
+	
+	streamID := c.Params("ssuid")
 	
 	// Check if stream exists
-	stream, exists := streamManager.Streams[streamID]
-	if !exists || stream.Status == "ended" {
+	stream, exists := streamManager.Get(streamID)
+	if !exists || stream.GetStatus() == StreamEnded {
 		c.Close()
 		return
 	}
 	
 	// Check if chat is enabled
-	if !stream.Settings.EnableChat {
+	if !stream.GetSettings().EnableChat {
 		c.Close()
 		return
 	}
 	
-	// Create a new client for chat
-	clientID := uuid.New().String()
-	client := &Client{
-		ID:     clientID,
-		UserID: userID,
-		Hub:    stream.ChatHub,
-		Conn:   c.Conn,
-		Send:   make(chan []byte, 256),
+	// Scheduled streams turn chat away until they open
+	if err := notOpenError(SessionStream, stream.Schedule, time.Now()); err != nil {
+		rejectJoin(c, err)
+		return
 	}
 	
+	// Create a new client for chat. Messages are stamped with the sender's
+	// identity and broadcast to all chat clients, unless the streamer has
+	// switched chat off since the client connected.
+	clientID := uuid.New().String()
+	client := newClient(stream.ChatHub, c, clientID, chat.RoleViewer)
+	client.SetOnMessageCallback(func(client *chat.Client, message []byte) bool {
+		if stream.GetSettings().EnableChat {
+			client.Chat(message)
+		}
+		return true
+	})
+	
 	// Register the client with the hub
-	client.Hub.Register <- client
+	client.Hub.Join(client)
 	
 	// Start the client read/write pumps
-	go client.writePump()
-	
-	defer func() {
-		client.Hub.Unregister <- client
-	}()
-	
-	// Handle incoming chat messages
-	for {
-		_, message, err := c.Conn.ReadMessage()
-		if err != nil {
-			break
-		}
-		
-		// Format the message with user info before broadcasting
-		// In a real implementation, you would parse the message and validate it
-		chatMessage := fmt.Sprintf(`{"event":"chat_message","data":{"user_id":"%s","username":"%s","message":%s}}`, 
-			userID, username, string(message))
-		
-		// Broadcast the chat message to all chat clients
-		stream.ChatHub.Broadcast <- []byte(chatMessage)
-	}
+	serve(client, nil)
 }
\ No newline at end of file
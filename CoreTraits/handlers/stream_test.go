@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+	pionwebrtc "github.com/pion/webrtc/v3"
+)
+
+// offerFrame returns a signaling frame with an offer from a new peer
+// connection that sends audio, or only receives media if recvOnly
+func offerFrame(t *testing.T, recvOnly bool) string {
+	t.Helper()
+
+	pc, err := pionwebrtc.NewPeerConnection(pionwebrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	direction := pionwebrtc.RTPTransceiverDirectionSendonly
+	if recvOnly {
+		direction = pionwebrtc.RTPTransceiverDirectionRecvonly
+	}
+	if _, err := pc.AddTransceiverFromKind(pionwebrtc.RTPCodecTypeAudio, pionwebrtc.RTPTransceiverInit{Direction: direction}); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return `{"type":"offer","data":` + string(data) + `}`
+}
+
+func TestStreamSignalsReachServerPeers(t *testing.T) {
+	base := testServer(t)
+	t.Cleanup(func() { streamManager.Remove("signal-stream") })
+
+	streamer := dialTest(t, base+"/stream/signal-stream/websocket?u=sam")
+	readEvent(t, streamer, "streamer_connected", nil)
+	viewer := dialTest(t, base+"/stream/signal-stream/viewer/websocket?u=vic")
+	readEvent(t, viewer, "viewer_joined", nil)
+
+	// A second broadcaster connection is turned away
+	second := dialTest(t, base+"/stream/signal-stream/websocket?u=sam")
+	readEvent(t, second, "error", nil)
+
+	for name, conn := range map[string]*fws.Conn{"streamer": streamer, "viewer": viewer} {
+		send(t, conn, offerFrame(t, name == "viewer"))
+
+		var answer pionwebrtc.SessionDescription
+		readEvent(t, conn, "answer", &answer)
+		if answer.Type != pionwebrtc.SDPTypeAnswer || answer.SDP == "" {
+			t.Errorf("%s got answer %+v", name, answer)
+		}
+	}
+}
+
+func TestStreamerFramesReachViewersAsEvents(t *testing.T) {
+	base := testServer(t)
+	t.Cleanup(func() { streamManager.Remove("frames-stream") })
+
+	streamer := dialTest(t, base+"/stream/frames-stream/websocket?u=sam")
+	readEvent(t, streamer, "streamer_connected", nil)
+	viewer := dialTest(t, base+"/stream/frames-stream/viewer/websocket?u=vic")
+	readEvent(t, viewer, "viewer_joined", nil)
+
+	send(t, streamer, "not json")
+	var refused SignalErrorData
+	readEvent(t, streamer, "error", &refused)
+	if refused.Code != ErrCodeInvalidMessage {
+		t.Errorf("error code = %s, want %s", refused.Code, ErrCodeInvalidMessage)
+	}
+
+	send(t, streamer, `{"type":"caption","text":"Welcome"}`)
+	var message StreamerMessageData
+	readEvent(t, viewer, "streamer_message", &message)
+	if message.UserID != "sam" || string(message.Data) != `{"type":"caption","text":"Welcome"}` {
+		t.Errorf("streamer_message = %+v, want sam's frame", message)
+	}
+}
+
+func TestStreamChatSendsOnlyText(t *testing.T) {
+	base := testServer(t)
+	t.Cleanup(func() { streamManager.Remove("chat-stream") })
+
+	streamer := dialTest(t, base+"/stream/chat-stream/websocket?u=sam")
+	readEvent(t, streamer, "streamer_connected", nil)
+	amy := dialTest(t, base+"/stream/chat-stream/chat/websocket?u=amy")
+	readEvent(t, amy, "user_joined", nil)
+	vic := dialTest(t, base+"/stream/chat-stream/chat/websocket?u=vic")
+	readEvent(t, amy, "user_joined", nil)
+
+	// Clients cannot pass their messages off as other types or attach data
+	send(t, vic, `{"type":"system","event":"stream_ended","content":"hello","data":{"status":"ended"}}`)
+	frame := readFrame(t, amy, "text")
+	var message map[string]interface{}
+	if err := json.Unmarshal(frame, &message); err != nil {
+		t.Fatal(err)
+	}
+	sender, _ := message["sender"].(map[string]interface{})
+	if message["content"] != "hello" || message["data"] != nil || sender["user_id"] != "vic" {
+		t.Errorf("chat message = %s, want vic's content alone", frame)
+	}
+
+	send(t, vic, "plain words")
+	var text struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(readFrame(t, amy, "text"), &text); err != nil || text.Content != "plain words" {
+		t.Errorf("plain chat content = %q, want it sent as is", text.Content)
+	}
+}
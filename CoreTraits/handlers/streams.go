@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+)
+
+// Limits on stream settings
+const (
+	maxStreamTitleLength       = 200
+	maxStreamDescriptionLength = 2000
+)
+
+// StreamSettingsData is the body of POST /streams and PATCH /streams/:ssuid.
+// Omitted fields keep their default or current value.
+type StreamSettingsData struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	EnableChat  *bool   `json:"enable_chat,omitempty"`
+	IsPrivate   *bool   `json:"is_private,omitempty"`
+	AccessCode  *string `json:"access_code,omitempty"`
+	MaxViewers  *int    `json:"max_viewers,omitempty"`
+}
+
+// StreamRequest is the body of POST /streams: the stream's settings and,
+// for streams planned ahead, when it runs
+type StreamRequest struct {
+	StreamSettingsData
+	Schedule *ScheduleData `json:"schedule,omitempty"`
+}
+
+// StreamStatusData is the payload of stream_started, stream_paused,
+// stream_resumed and stream_ended events
+type StreamStatusData struct {
+	StreamID  string    `json:"stream_id"`
+	Status    string    `json:"status"`
+	Previous  string    `json:"previous_status"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// StreamSettingsUpdatedData is the payload of a settings_updated event
+type StreamSettingsUpdatedData struct {
+	StreamID  string         `json:"stream_id"`
+	Settings  StreamSettings `json:"settings"`
+	ChangedBy string         `json:"changed_by"`
+}
+
+// CreateStream schedules a stream owned by the caller. It goes live when the
+// owner starts it or connects as the streamer, and a stream with a scheduled
+// end is ended then. Must run after RequireToken.
+func CreateStream(c *fiber.Ctx) error {
+	if shuttingDown.Load() {
+		return rejectDuringShutdown(c)
+	}
+	
+	var request StreamRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Invalid request body: %v", err),
+			})
+		}
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	streamID := uuid.New().String()
+	
+	settings, err := applyStreamSettings(defaultStreamSettings(info.Username), request.StreamSettingsData)
+	if err != nil {
+		return rejectStreamRequest(c, err)
+	}
+	
+	schedule, err := request.Schedule.schedule()
+	if err != nil {
+		return rejectStreamRequest(c, err)
+	}
+	
+	// Streams have no lobby for early viewers to wait in
+	if schedule.EarlyJoin == webrtc.EarlyJoinLobby {
+		return rejectStreamRequest(c, errors.New("streams do not support early_join lobby; early viewers are turned away"))
+	}
+	
+	// Private streams need an access code or invite to watch
+	if settings.IsPrivate {
+		code, err := privateAccess(settings.AccessCode)
+		if err != nil {
+			log.Printf("Failed to create access code for stream %s: %v", streamID, err)
+			return c.Status(500).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to create stream",
+			})
+		}
+		settings.AccessCode = code
+	}
+	
+	stream := newStream(streamID, info.UserID, info.Username, StreamScheduled, settings)
+	stream.Schedule = schedule
+	streamManager.Add(stream)
+	
+	response := fiber.Map{
+		"success":    true,
+		"stream_id":  streamID,
+		"status":     StreamScheduled,
+		"settings":   settings,
+		"schedule":   scheduleData(schedule),
+		"is_private": settings.IsPrivate,
+	}
+	if settings.IsPrivate {
+		response["access_code"] = settings.AccessCode
+		response["invite_token"] = inviter.Issue(streamID)
+	}
+	
+	return c.Status(201).JSON(response)
+}
+
+// StartStream takes a scheduled stream live or resumes a paused one. Only the
+// owner may start a stream. Must run after RequireToken.
+func StartStream(c *fiber.Ctx) error {
+	return setStreamStatus(c, StreamLive)
+}
+
+// PauseStream pauses a live stream, holding the streamer's frames back from
+// viewers until it is resumed. Only the owner may pause a stream. Must run
+// after RequireToken.
+func PauseStream(c *fiber.Ctx) error {
+	return setStreamStatus(c, StreamPaused)
+}
+
+// EndStream ends a streaming session. Only the owner may end a stream. Must
+// run after RequireToken.
+func EndStream(c *fiber.Ctx) error {
+	return setStreamStatus(c, StreamEnded)
+}
+
+// UpdateStreamSettings updates the stream settings. Only the owner may
+// update a stream. Must run after RequireToken.
+func UpdateStreamSettings(c *fiber.Ctx) error {
+	stream, err := ownedStream(c)
+	if stream == nil {
+		return err
+	}
+	
+	var update StreamSettingsData
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid settings format",
+		})
+	}
+	
+	if stream.GetStatus() == StreamEnded {
+		return c.Status(409).JSON(fiber.Map{
+			"success": false,
+			"message": "The stream has ended",
+		})
+	}
+	
+	settings, err := stream.updateSettings(update)
+	if err != nil {
+		return rejectStreamRequest(c, err)
+	}
+	
+	// Notify viewers and chat about the settings update
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	stream.broadcastEvent("settings_updated", StreamSettingsUpdatedData{
+		StreamID:  stream.ID,
+		Settings:  settings,
+		ChangedBy: info.UserID,
+	})
+	
+	response := fiber.Map{
+		"success":  true,
+		"message":  "Stream settings updated",
+		"settings": settings,
+	}
+	
+	// Tell the owner the code for a stream that just went private
+	if settings.IsPrivate && (update.IsPrivate != nil || update.AccessCode != nil) {
+		response["access_code"] = settings.AccessCode
+		response["invite_token"] = inviter.Issue(stream.ID)
+	}
+	
+	return c.JSON(response)
+}
+
+// setStreamStatus moves the stream in the URL to status for its owner.
+// Repeating a change succeeds without telling the clients again.
+func setStreamStatus(c *fiber.Ctx, status string) error {
+	stream, err := ownedStream(c)
+	if stream == nil {
+		return err
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	changed, err := stream.changeStatus(status, info.UserID)
+	if err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"success": false,
+			"message": fmt.Sprintf("Cannot change the stream from %s to %s", stream.GetStatus(), status),
+		})
+	}
+	
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"stream_id": stream.ID,
+		"status":    status,
+		"changed":   changed,
+	})
+}
+
+// changeStatus moves the stream to status and tells its clients when the
+// status changed. It reports whether it did.
+func (s *Stream) changeStatus(status, changedBy string) (bool, error) {
+	previous, err := s.transition(status)
+	if err != nil || previous == status {
+		return false, err
+	}
+	
+	var event string
+	switch {
+	case status == StreamLive && previous == StreamPaused:
+		event = "stream_resumed"
+	case status == StreamLive:
+		event = "stream_started"
+	case status == StreamPaused:
+		event = "stream_paused"
+	default:
+		event = "stream_ended"
+	}
+	
+	s.broadcastEvent(event, StreamStatusData{
+		StreamID:  s.ID,
+		Status:    status,
+		Previous:  previous,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	})
+	
+	// Ended streams never go live again, so their peer connections can go
+	if status == StreamEnded {
+		s.RTC.Close()
+	}
+	
+	return true, nil
+}
+
+// updateSettings applies an update to the stream's settings and returns the
+// result. A stream made private without a code gets a generated one.
+func (s *Stream) updateSettings(update StreamSettingsData) (StreamSettings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	settings, err := applyStreamSettings(s.Settings, update)
+	if err != nil {
+		return s.Settings, err
+	}
+	
+	if settings.IsPrivate && settings.AccessCode == "" {
+		code, err := privateAccess("")
+		if err != nil {
+			return s.Settings, fmt.Errorf("failed to create access code: %w", err)
+		}
+		settings.AccessCode = code
+	}
+	if !settings.IsPrivate {
+		settings.AccessCode = ""
+	}
+	
+	s.Settings = settings
+	return settings, nil
+}
+
+// applyStreamSettings returns settings with the given fields changed, or the
+// first invalid field
+func applyStreamSettings(settings StreamSettings, update StreamSettingsData) (StreamSettings, error) {
+	if update.Title != nil {
+		settings.Title = strings.TrimSpace(*update.Title)
+	}
+	if update.Description != nil {
+		settings.Description = *update.Description
+	}
+	if update.EnableChat != nil {
+		settings.EnableChat = *update.EnableChat
+	}
+	if update.IsPrivate != nil {
+		settings.IsPrivate = *update.IsPrivate
+	}
+	if update.AccessCode != nil {
+		settings.AccessCode = *update.AccessCode
+	}
+	if update.MaxViewers != nil {
+		settings.MaxViewers = *update.MaxViewers
+	}
+	
+	switch {
+	case settings.Title == "":
+		return settings, fmt.Errorf("title cannot be empty")
+	case len(settings.Title) > maxStreamTitleLength:
+		return settings, fmt.Errorf("title cannot be longer than %d characters", maxStreamTitleLength)
+	case len(settings.Description) > maxStreamDescriptionLength:
+		return settings, fmt.Errorf("description cannot be longer than %d characters", maxStreamDescriptionLength)
+	case settings.MaxViewers < 1:
+		return settings, fmt.Errorf("max_viewers must be at least 1")
+	case update.AccessCode != nil && *update.AccessCode != "" && !settings.IsPrivate:
+		return settings, fmt.Errorf("access_code requires is_private")
+	}
+	
+	return settings, nil
+}
+
+// ownedStream looks up the stream in the URL for its owner. When the stream
+// is missing or owned by someone else it writes the response and returns nil.
+func ownedStream(c *fiber.Ctx) (*Stream, error) {
+	stream, exists := streamManager.Get(c.Params("ssuid"))
+	if !exists {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"message": "Stream not found",
+		})
+	}
+	
+	info := c.Locals(identityKey).(*chat.ClientInfo)
+	if stream.UserID != info.UserID {
+		return nil, c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"message": "Only the streamer can control the stream",
+		})
+	}
+	
+	return stream, nil
+}
+
+// rejectStreamRequest answers a stream request with invalid fields
+func rejectStreamRequest(c *fiber.Ctx, err error) error {
+	return c.Status(400).JSON(fiber.Map{
+		"success": false,
+		"message": err.Error(),
+	})
+}
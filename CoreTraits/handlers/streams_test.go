@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+)
+
+func TestStreamStatusTransitions(t *testing.T) {
+	base := testServer(t)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		user := strings.Clone(c.Query("u"))
+		c.Locals(identityKey, &chat.ClientInfo{UserID: user, Username: user})
+		return c.Next()
+	})
+	app.Post("/streams", CreateStream)
+	app.Post("/streams/:ssuid/start", StartStream)
+	app.Post("/streams/:ssuid/pause", PauseStream)
+	app.Post("/streams/:ssuid/end", EndStream)
+
+	do := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+
+		resp, err := app.Test(httptest.NewRequest("POST", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		return resp.StatusCode, decoded
+	}
+
+	status, created := do("/streams?u=sam")
+	if status != fiber.StatusCreated || created["status"] != StreamScheduled {
+		t.Fatalf("create = %d %v, want a scheduled stream", status, created)
+	}
+	streamID := created["stream_id"].(string)
+	t.Cleanup(func() { streamManager.Remove(streamID) })
+	path := "/streams/" + streamID
+
+	chatConn := dialTest(t, base+"/stream/"+streamID+"/chat/websocket?u=vic")
+	readEvent(t, chatConn, "user_joined", nil)
+
+	steps := []struct {
+		action  string
+		user    string
+		want    int
+		changed bool
+		event   string
+	}{
+		{"pause", "sam", fiber.StatusConflict, false, ""},
+		{"start", "vic", fiber.StatusForbidden, false, ""},
+		{"start", "sam", fiber.StatusOK, true, "stream_started"},
+		{"start", "sam", fiber.StatusOK, false, ""},
+		{"pause", "sam", fiber.StatusOK, true, "stream_paused"},
+		{"start", "sam", fiber.StatusOK, true, "stream_resumed"},
+		{"end", "sam", fiber.StatusOK, true, "stream_ended"},
+		{"start", "sam", fiber.StatusConflict, false, ""},
+		{"end", "sam", fiber.StatusOK, false, ""},
+	}
+
+	previous := StreamScheduled
+	for _, step := range steps {
+		status, body := do(path + "/" + step.action + "?u=" + step.user)
+		if status != step.want {
+			t.Fatalf("%s by %s = %d %v, want %d", step.action, step.user, status, body, step.want)
+		}
+		if status == fiber.StatusOK && body["changed"] != step.changed {
+			t.Errorf("%s by %s changed = %v, want %v", step.action, step.user, body["changed"], step.changed)
+		}
+		if step.event == "" {
+			continue
+		}
+
+		// Clients hear about each change in order, with where it came from
+		var data StreamStatusData
+		readEvent(t, chatConn, step.event, &data)
+		if data.Previous != previous || data.ChangedBy != "sam" {
+			t.Errorf("%s = %+v, want a change from %s by sam", step.event, data, previous)
+		}
+		previous = data.Status
+	}
+
+	stream, _ := streamManager.Get(streamID)
+	if stats := stream.GetStatistics(); stats.StreamStartTime.IsZero() || stats.StreamEndTime.Before(stats.StreamStartTime) {
+		t.Errorf("statistics = %+v, want the start and end recorded", stats)
+	}
+}
@@ -41,6 +41,15 @@ func Health(c *fiber.Ctx) error {
 	// - Available memory and CPU usage
 	// - Server uptime
 	
+	// Fail health checks while draining so load balancers stop routing here
+	if shuttingDown.Load() {
+		return c.Status(503).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server is shutting down",
+			"health":  "draining",
+		})
+	}
+	
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Server is running",
@@ -51,22 +60,23 @@ func Health(c *fiber.Ctx) error {
 // Stats returns server statistics
 func Stats(c *fiber.Ctx) error {
 	// Get room count
-	roomCount := len(roomManager.Rooms)
+	roomCount := roomManager.Count()
 	
 	// Get stream count
-	streamCount := len(streamManager.Streams)
+	streamCount := streamManager.Count()
 	
 	// Get active connections count
 	activeConnections := 0
-	for _, room := range roomManager.Rooms {
-		activeConnections += len(room.Peers)
+	for _, room := range roomManager.List() {
+		activeConnections += room.PeerCount()
 	}
 	
 	// Get active stream viewers
 	activeViewers := 0
-	for _, stream := range streamManager.Streams {
-		if stream.Status == "live" {
-			activeViewers += len(stream.Viewers)
+	for _, stream := range streamManager.List() {
+		// Private streams are only reachable by ID
+		if stream.GetStatus() == StreamLive && !stream.GetSettings().IsPrivate {
+			activeViewers += stream.ViewerCount()
 		}
 	}
 	
@@ -93,10 +103,19 @@ func NotFound(c *fiber.Ctx) error {
 func GetActiveRooms(c *fiber.Ctx) error {
 	rooms := make([]fiber.Map, 0)
 	
-	for id, room := range roomManager.Rooms {
+	for _, room := range roomManager.List() {
+		// Private rooms and breakouts are only reachable by ID
+		if room.RTC.GetConfig().IsPrivate || room.Parent != nil {
+			continue
+		}
+		
+		meta := room.GetMetadata()
 		rooms = append(rooms, fiber.Map{
-			"id":         id,
-			"peer_count": len(room.Peers),
+			"id":         room.ID,
+			"name":       meta.Name,
+			"tags":       meta.Tags,
+			"course_id":  meta.CourseID,
+			"peer_count": room.PeerCount(),
 			"created_at": room.CreatedAt,
 		})
 	}
@@ -111,15 +130,17 @@ func GetActiveRooms(c *fiber.Ctx) error {
 func GetActiveStreams(c *fiber.Ctx) error {
 	streams := make([]fiber.Map, 0)
 	
-	for id, stream := range streamManager.Streams {
-		if stream.Status == "live" {
+	for _, stream := range streamManager.List() {
+		// Private streams are only reachable by ID
+		settings := stream.GetSettings()
+		if stream.GetStatus() == StreamLive && !settings.IsPrivate {
 			streams = append(streams, fiber.Map{
-				"id":           id,
+				"id":           stream.ID,
 				"user_id":      stream.UserID,
 				"username":     stream.Username,
-				"title":        stream.Settings.Title,
-				"description":  stream.Settings.Description,
-				"viewer_count": len(stream.Viewers),
+				"title":        settings.Title,
+				"description":  settings.Description,
+				"viewer_count": stream.ViewerCount(),
 				"created_at":   stream.CreatedAt,
 			})
 		}
@@ -160,19 +181,54 @@ func Documentation(c *fiber.Ctx) error {
 			"description": "List of active streams",
 		},
 		{
-			"path":        "/room/create",
+			"path":        "/events",
 			"method":      "GET",
-			"description": "Create a new room",
+			"description": "Every event the server sends, with its channel and JSON Schema",
+		},
+		{
+			"path":        "/events/:name",
+			"method":      "GET",
+			"description": "JSON Schema of one event, such as peer_joined or room_data.new_track, for generating client decoders",
+		},
+		{
+			"path":        "/config",
+			"method":      "GET",
+			"description": "Effective server configuration with secrets redacted (admin token required)",
+		},
+		{
+			"path":        "/rooms",
+			"method":      "POST",
+			"description": "Create a room owned by the caller from name, tags, course_id and config (max_participants, lifetime, enable_chat, enable_recording, is_private, access_code, enable_lobby, schedule); a schedule (starts_at, ends_at, join_window, early_join reject or lobby) limits when joins are accepted and closes the room at ends_at; returns the room with join URLs (bearer token required)",
+		},
+		{
+			"path":        "/rooms/:uuid",
+			"method":      "GET",
+			"description": "Get a room with its metadata, config and join URLs (bearer token required; private rooms also need the owner, an access code or an invite)",
+		},
+		{
+			"path":        "/rooms/:uuid",
+			"method":      "PATCH",
+			"description": "Update a room's name, tags, course_id, enable_chat, max_participants or enable_lobby (room owner only)",
+		},
+		{
+			"path":        "/rooms/:uuid",
+			"method":      "DELETE",
+			"description": "Close a room and disconnect everyone in it (room owner only)",
 		},
 		{
 			"path":        "/room/:uuid",
 			"method":      "GET",
-			"description": "Get information about a specific room",
+			"description": "Get information about a specific room (bearer token required; private rooms also need the owner, an access code or an invite)",
 		},
 		{
 			"path":        "/room/:uuid/websocket",
 			"method":      "WebSocket",
-			"description": "WebSocket connection for room participants",
+			"description": "WebSocket connection for room participants (bearer token required); pass ?resume=<resume_token> from room_joined to reclaim a dropped peer",
+		},
+		{
+			"path":        "/room/:uuid/peers/:peer/:action",
+			"method":      "POST",
+			"description": "Moderate a peer: kick, ban, force_mute_audio, force_stop_video, stop_screenshare, or allow_audio, allow_video and allow_screenshare to let a peer switch forced-off media back on (moderator in the room)",
 		},
 		{
 			"path":        "/room/:uuid/chat",
@@ -182,17 +238,42 @@ func Documentation(c *fiber.Ctx) error {
 		{
 			"path":        "/room/:uuid/chat/websocket",
 			"method":      "WebSocket",
-			"description": "WebSocket connection for room chat",
+			"description": "WebSocket connection for room chat (bearer token required)",
 		},
 		{
 			"path":        "/room/:uuid/viewer/websocket",
 			"method":      "WebSocket",
-			"description": "WebSocket connection for room viewers",
+			"description": "WebSocket connection for room viewers (bearer token required); viewers are turned away before a scheduled room opens, and while the lobby is on only users admitted to the room may watch",
+		},
+		{
+			"path":        "/streams",
+			"method":      "POST",
+			"description": "Schedule a stream owned by the caller from title, description, enable_chat, is_private, access_code, max_viewers and an optional schedule (starts_at, ends_at, join_window, early_join reject; streams have no lobby) that turns viewers away until it opens and ends the stream at ends_at (bearer token required)",
 		},
 		{
-			"path":        "/stream/create",
+			"path":        "/streams/:ssuid",
 			"method":      "GET",
-			"description": "Create a new stream",
+			"description": "Get a stream with its status, settings and statistics",
+		},
+		{
+			"path":        "/streams/:ssuid",
+			"method":      "PATCH",
+			"description": "Update a stream's title, description, enable_chat, is_private, access_code or max_viewers (stream owner only)",
+		},
+		{
+			"path":        "/streams/:ssuid/start",
+			"method":      "POST",
+			"description": "Take a scheduled stream live or resume a paused one (stream owner only)",
+		},
+		{
+			"path":        "/streams/:ssuid/pause",
+			"method":      "POST",
+			"description": "Pause a live stream (stream owner only)",
+		},
+		{
+			"path":        "/streams/:ssuid/end",
+			"method":      "POST",
+			"description": "End a stream (stream owner only)",
 		},
 		{
 			"path":        "/stream/:ssuid",
@@ -202,17 +283,17 @@ func Documentation(c *fiber.Ctx) error {
 		{
 			"path":        "/stream/:ssuid/websocket",
 			"method":      "WebSocket",
-			"description": "WebSocket connection for stream broadcaster",
+			"description": "WebSocket connection for stream broadcaster, carrying offer, answer and ice-candidate signals for its server-side peer; other JSON frames reach viewers as streamer_message events while the stream is live (owner's bearer token required; one connection at a time)",
 		},
 		{
 			"path":        "/stream/:ssuid/chat/websocket",
 			"method":      "WebSocket",
-			"description": "WebSocket connection for stream chat",
+			"description": "WebSocket connection for stream chat; each frame is sent as a text message, keeping only the content of JSON frames (bearer token required)",
 		},
 		{
 			"path":        "/stream/:ssuid/viewer/websocket",
 			"method":      "WebSocket",
-			"description": "WebSocket connection for stream viewers",
+			"description": "WebSocket connection for stream viewers, carrying offer and ice-candidate signals for the viewer's receive-only server-side peer (bearer token required)",
 		},
 	}
 	
@@ -0,0 +1,98 @@
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Length of generated access codes
+const codeLength = 8
+
+// MatchCode compares an access code in constant time
+func MatchCode(expected, given string) bool {
+	if expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(given)) == 1
+}
+
+// NewCode generates a random access code for a private session
+func NewCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate access code: %v", err)
+	}
+
+	return base32.StdEncoding.EncodeToString(buf)[:codeLength], nil
+}
+
+// NewToken generates a random opaque token, such as a peer's resume token
+func NewToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Inviter issues and checks invite tokens, which let the holder into one
+// private session without its access code until the token expires
+type Inviter struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewInviter creates an inviter signing with secret. An empty secret is
+// replaced with a random one, so invites do not survive a restart.
+func NewInviter(secret string, ttl time.Duration) *Inviter {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("failed to generate invite secret: %v", err))
+		}
+	}
+
+	return &Inviter{
+		secret: key,
+		ttl:    ttl,
+	}
+}
+
+// Issue returns an invite token for the session
+func (i *Inviter) Issue(sessionID string) string {
+	expires := strconv.FormatInt(time.Now().Add(i.ttl).Unix(), 10)
+	return expires + "." + i.sign(sessionID, expires)
+}
+
+// Valid reports whether the token is an unexpired invite to the session
+func (i *Inviter) Valid(sessionID, token string) bool {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(i.sign(sessionID, expires)))
+}
+
+// sign computes the token signature over the session and expiry
+func (i *Inviter) sign(sessionID, expires string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(sessionID + "|" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,117 @@
+package access
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		given    string
+		want     bool
+	}{
+		{"match", "ABCD2345", "ABCD2345", true},
+		{"wrong", "ABCD2345", "ABCD2346", false},
+		{"prefix", "ABCD2345", "ABCD", false},
+		{"longer", "ABCD2345", "ABCD23456", false},
+		{"case sensitive", "ABCD2345", "abcd2345", false},
+		{"empty given", "ABCD2345", "", false},
+		{"no code set", "", "", false},
+		{"no code set with guess", "", "ABCD2345", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchCode(tt.expected, tt.given); got != tt.want {
+				t.Errorf("MatchCode(%q, %q) = %v, want %v", tt.expected, tt.given, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := NewCode()
+		if err != nil {
+			t.Fatalf("NewCode() = %v", err)
+		}
+		if len(code) != codeLength {
+			t.Fatalf("NewCode() = %q, want %d characters", code, codeLength)
+		}
+		for _, r := range code {
+			if !strings.ContainsRune(alphabet, r) {
+				t.Fatalf("NewCode() = %q, has %q outside the base32 alphabet", code, r)
+			}
+		}
+		seen[code] = true
+	}
+
+	if len(seen) < 99 {
+		t.Errorf("NewCode() returned %d distinct codes in 100 calls", len(seen))
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	a, err := NewToken()
+	if err != nil {
+		t.Fatalf("NewToken() = %v", err)
+	}
+	b, _ := NewToken()
+
+	if len(a) != 32 || a == b {
+		t.Errorf("NewToken() = %q, %q, want distinct 32 character tokens", a, b)
+	}
+	if strings.ContainsAny(a, "+/=") {
+		t.Errorf("NewToken() = %q, want URL-safe characters", a)
+	}
+}
+
+func TestInviter(t *testing.T) {
+	inviter := NewInviter("secret", time.Hour)
+	token := inviter.Issue("room-1")
+
+	expires, signature, _ := strings.Cut(token, ".")
+	later := strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		inviter   *Inviter
+		sessionID string
+		token     string
+		want      bool
+	}{
+		{"valid", inviter, "room-1", token, true},
+		{"same secret", NewInviter("secret", time.Minute), "room-1", token, true},
+		{"other session", inviter, "room-2", token, false},
+		{"other secret", NewInviter("other", time.Hour), "room-1", token, false},
+		{"random secret", NewInviter("", time.Hour), "room-1", token, false},
+		{"extended expiry", inviter, "room-1", later + "." + signature, false},
+		{"tampered signature", inviter, "room-1", expires + "." + strings.ToUpper(signature), false},
+		{"missing signature", inviter, "room-1", expires, false},
+		{"bad expiry", inviter, "room-1", "soon." + signature, false},
+		{"empty", inviter, "room-1", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.inviter.Valid(tt.sessionID, tt.token); got != tt.want {
+				t.Errorf("Valid(%q, %q) = %v, want %v", tt.sessionID, tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInviterExpiry(t *testing.T) {
+	inviter := NewInviter("secret", -2*time.Second)
+
+	if token := inviter.Issue("room-1"); inviter.Valid("room-1", token) {
+		t.Errorf("Valid() accepted an expired invite %q", token)
+	}
+}
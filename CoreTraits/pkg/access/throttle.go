@@ -0,0 +1,157 @@
+// Package access guards private rooms and streams: access codes, signed
+// invite tokens and throttling of failed join attempts.
+package access
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracked keys kept before stale entries are swept
+const maxTrackedKeys = 10000
+
+// attempts counts failures for one key within the current window
+type attempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// Throttle counts failed access attempts per client IP and per session. An IP
+// that fails too often within the window is locked out. A session that fails
+// too often is locked out only for the IPs that fail against it, so clients
+// holding the right code still get in while it is being guessed at.
+type Throttle struct {
+	maxPerIP      int
+	maxPerSession int
+	window        time.Duration
+	lockout       time.Duration
+
+	entries map[string]*attempts
+	mutex   sync.Mutex
+}
+
+// NewThrottle creates a throttle allowing maxPerIP failures from one IP and
+// maxPerSession failures against one session within window before locking
+// out for lockout
+func NewThrottle(maxPerIP, maxPerSession int, window, lockout time.Duration) *Throttle {
+	return &Throttle{
+		maxPerIP:      maxPerIP,
+		maxPerSession: maxPerSession,
+		window:        window,
+		lockout:       lockout,
+		entries:       make(map[string]*attempts),
+	}
+}
+
+// Locked reports whether the IP may not try a code for the session and for
+// how long. That is when the IP is locked out, or when the session is locked
+// out and the IP failed against it during the lockout.
+func (t *Throttle) Locked(ip, sessionID string) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	wait := t.locked(ip, sessionID, time.Now())
+	return wait, wait > 0
+}
+
+// Fail records a failed attempt and reports whether the IP is now locked out
+// of the session and for how long
+func (t *Throttle) Fail(ip, sessionID string) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if len(t.entries) >= maxTrackedKeys {
+		t.sweep(now)
+	}
+
+	t.fail(ipKey(ip), t.maxPerIP, now)
+	t.fail(sessionKey(sessionID), t.maxPerSession, now)
+
+	// Shut out this IP for the rest of the session's lockout
+	if lockedUntil := t.entries[sessionKey(sessionID)].lockedUntil; now.Before(lockedUntil) {
+		t.entries[pairKey(ip, sessionID)] = &attempts{windowStart: now, lockedUntil: lockedUntil}
+	}
+
+	wait := t.locked(ip, sessionID, now)
+	return wait, wait > 0
+}
+
+// Succeed clears the failures recorded for the IP, which now holds the code.
+// Failures against the session are kept so other clients cannot reset them.
+func (t *Throttle) Succeed(ip, sessionID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.entries, ipKey(ip))
+	delete(t.entries, pairKey(ip, sessionID))
+}
+
+// locked returns how long the IP may not try a code for the session
+func (t *Throttle) locked(ip, sessionID string, now time.Time) time.Duration {
+	wait := t.remaining(ipKey(ip), now)
+	if pairWait := t.remaining(pairKey(ip, sessionID), now); pairWait > wait {
+		wait = pairWait
+	}
+
+	return wait
+}
+
+// remaining returns how long a key stays locked out
+func (t *Throttle) remaining(key string, now time.Time) time.Duration {
+	entry, ok := t.entries[key]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return 0
+	}
+
+	return entry.lockedUntil.Sub(now)
+}
+
+// fail counts a failure for a key, locking it once limit is reached. Failures
+// while the key is locked out do not extend the lockout.
+func (t *Throttle) fail(key string, limit int, now time.Time) {
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &attempts{windowStart: now}
+		t.entries[key] = entry
+	}
+	if now.Before(entry.lockedUntil) {
+		return
+	}
+	if now.Sub(entry.windowStart) > t.window {
+		entry.failures = 0
+		entry.windowStart = now
+	}
+
+	entry.failures++
+	if limit > 0 && entry.failures >= limit {
+		entry.lockedUntil = now.Add(t.lockout)
+		entry.failures = 0
+		entry.windowStart = now
+	}
+}
+
+// sweep drops entries that are neither locked nor inside their window
+func (t *Throttle) sweep(now time.Time) {
+	for key, entry := range t.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.windowStart) > t.window {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// ipKey namespaces a client IP
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// sessionKey namespaces a room or stream ID
+func sessionKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// pairKey namespaces an IP's lockout from one room or stream
+func pairKey(ip, sessionID string) string {
+	return "pair:" + ip + "|" + sessionID
+}
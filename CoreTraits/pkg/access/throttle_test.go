@@ -0,0 +1,148 @@
+package access
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestThrottleLocksIP(t *testing.T) {
+	throttle := NewThrottle(3, 100, time.Minute, time.Hour)
+
+	for i := 1; i < 3; i++ {
+		if _, locked := throttle.Fail("1.1.1.1", "room"); locked {
+			t.Fatalf("Fail() #%d locked the IP early", i)
+		}
+	}
+	wait, locked := throttle.Fail("1.1.1.1", "room")
+	if !locked || wait <= 59*time.Minute {
+		t.Fatalf("Fail() #3 = %v, %v, want locked for the lockout", wait, locked)
+	}
+
+	if _, locked := throttle.Locked("1.1.1.1", "other-room"); !locked {
+		t.Error("Locked() let a locked IP try another session")
+	}
+	if _, locked := throttle.Locked("2.2.2.2", "room"); locked {
+		t.Error("Locked() refused another IP")
+	}
+}
+
+func TestThrottleSessionLockoutOnlyRefusesFailingIPs(t *testing.T) {
+	throttle := NewThrottle(100, 4, time.Minute, time.Hour)
+
+	// Four IPs guess wrong once each, locking the session
+	for i := 0; i < 4; i++ {
+		throttle.Fail(fmt.Sprintf("10.0.0.%d", i), "room")
+	}
+
+	// The IP whose guess locked the session is refused
+	if _, locked := throttle.Locked("10.0.0.3", "room"); !locked {
+		t.Error("Locked() let in the IP that locked the session")
+	}
+
+	// A student who has not failed still gets to try their code
+	if _, locked := throttle.Locked("10.0.0.50", "room"); locked {
+		t.Fatal("Locked() refused an IP that never failed against the session")
+	}
+
+	// Guessing wrong while the session is locked shuts that IP out
+	wait, locked := throttle.Fail("10.0.0.50", "room")
+	if !locked || wait <= 59*time.Minute {
+		t.Fatalf("Fail() during session lockout = %v, %v, want locked until it ends", wait, locked)
+	}
+	if _, locked := throttle.Locked("10.0.0.50", "room"); !locked {
+		t.Error("Locked() let in an IP that failed during the session lockout")
+	}
+
+	// The lockout is per session
+	if _, locked := throttle.Locked("10.0.0.50", "other-room"); locked {
+		t.Error("Locked() refused the IP for another session")
+	}
+}
+
+func TestThrottleSucceedClearsIP(t *testing.T) {
+	throttle := NewThrottle(3, 2, time.Minute, time.Hour)
+
+	throttle.Fail("1.1.1.1", "room")
+	throttle.Fail("1.1.1.1", "room")
+	if _, locked := throttle.Locked("1.1.1.1", "room"); !locked {
+		t.Fatal("Locked() = false, want the session lockout to refuse the failing IP")
+	}
+
+	throttle.Succeed("1.1.1.1", "room")
+	if _, locked := throttle.Locked("1.1.1.1", "room"); locked {
+		t.Error("Locked() refused an IP that entered the right code")
+	}
+
+	// The session's own count is kept so one client cannot reset it
+	if _, locked := throttle.Fail("2.2.2.2", "room"); !locked {
+		t.Error("Fail() against a locked session did not shut out the new IP")
+	}
+}
+
+func TestThrottleWindow(t *testing.T) {
+	throttle := NewThrottle(2, 100, 50*time.Millisecond, time.Hour)
+
+	throttle.Fail("1.1.1.1", "room")
+	time.Sleep(80 * time.Millisecond)
+
+	// The first failure fell out of the window
+	if _, locked := throttle.Fail("1.1.1.1", "room"); locked {
+		t.Fatal("Fail() counted a failure from an earlier window")
+	}
+	if _, locked := throttle.Fail("1.1.1.1", "room"); !locked {
+		t.Fatal("Fail() did not lock after two failures in one window")
+	}
+}
+
+func TestThrottleLockoutEnds(t *testing.T) {
+	throttle := NewThrottle(1, 100, time.Minute, 50*time.Millisecond)
+
+	if _, locked := throttle.Fail("1.1.1.1", "room"); !locked {
+		t.Fatal("Fail() did not lock")
+	}
+	time.Sleep(80 * time.Millisecond)
+
+	if _, locked := throttle.Locked("1.1.1.1", "room"); locked {
+		t.Error("Locked() still refused the IP after the lockout")
+	}
+}
+
+func TestThrottleFailuresDuringLockoutDoNotExtendIt(t *testing.T) {
+	throttle := NewThrottle(100, 1, time.Minute, 100*time.Millisecond)
+
+	throttle.Fail("1.1.1.1", "room")
+	time.Sleep(60 * time.Millisecond)
+	throttle.Fail("2.2.2.2", "room")
+	time.Sleep(60 * time.Millisecond)
+
+	if _, locked := throttle.Locked("3.3.3.3", "room"); locked {
+		t.Fatal("Locked() refused an IP that never failed")
+	}
+	if _, locked := throttle.Locked("2.2.2.2", "room"); locked {
+		t.Error("a failure during the session lockout extended it")
+	}
+}
+
+func TestThrottleSweep(t *testing.T) {
+	throttle := NewThrottle(100, 100, time.Minute, time.Minute)
+
+	now := time.Now()
+	stale := &attempts{failures: 1, windowStart: now.Add(-time.Hour)}
+	for i := 0; i < maxTrackedKeys; i++ {
+		throttle.entries[ipKey(fmt.Sprint("10.0.", i))] = stale
+	}
+	throttle.entries[ipKey("locked")] = &attempts{windowStart: now.Add(-time.Hour), lockedUntil: now.Add(time.Minute)}
+	throttle.entries[ipKey("recent")] = &attempts{failures: 1, windowStart: now}
+
+	throttle.Fail("1.1.1.1", "room")
+
+	if got := len(throttle.entries); got != 4 {
+		t.Fatalf("entries after sweep = %d, want 4", got)
+	}
+	for _, ip := range []string{"locked", "recent", "1.1.1.1"} {
+		if _, ok := throttle.entries[ipKey(ip)]; !ok {
+			t.Errorf("sweep dropped live entry for %s", ip)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Authenticator resolves a bearer token to the user it was issued to. It
+// returns ErrMissingToken or ErrInvalidToken when the token should be refused,
+// and any other error when the token could not be checked.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*chat.ClientInfo, error)
+}
+
+var (
+	_ Authenticator = (*JWTVerifier)(nil)
+	_ Authenticator = (*SanctumAuthenticator)(nil)
+)
+
+// New creates the authenticator selected by the configured provider
+func New(cfg config.AuthConfig) (Authenticator, error) {
+	switch cfg.Provider {
+	case "jwt":
+		return NewJWTVerifier(cfg.JWT)
+	case "sanctum":
+		return NewSanctumAuthenticator(cfg.Sanctum), nil
+	default:
+		return nil, fmt.Errorf("unknown auth provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,115 @@
+// Package auth authenticates the bearer tokens presented on websocket handshakes
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Errors returned when a token cannot be used
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid bearer token")
+)
+
+// Claims are the token claims describing the connecting user. The user ID
+// comes from the standard "sub" claim. The role claim is the most the user
+// may be in any room; the room decides the role itself.
+type Claims struct {
+	Name     string `json:"name"`
+	Username string `json:"preferred_username"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// JWTVerifier checks signed tokens against a configured HMAC secret or RSA public key
+type JWTVerifier struct {
+	key    interface{}
+	parser *jwt.Parser
+}
+
+// NewJWTVerifier creates a verifier from the auth configuration
+func NewJWTVerifier(cfg config.JWTConfig) (*JWTVerifier, error) {
+	var key interface{}
+
+	if cfg.IsHMAC() {
+		if cfg.Secret == "" {
+			return nil, errors.New("jwt secret is required for HMAC algorithms")
+		}
+		key = []byte(cfg.Secret)
+	} else {
+		pem, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwt public key: %v", err)
+		}
+
+		key, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse jwt public key: %v", err)
+		}
+	}
+
+	// Only accept the configured algorithm so a token cannot pick its own
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{cfg.Algorithm}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway.Std()),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &JWTVerifier{
+		key:    key,
+		parser: jwt.NewParser(options...),
+	}, nil
+}
+
+// Authenticate verifies the token locally; the context is unused
+func (v *JWTVerifier) Authenticate(_ context.Context, token string) (*chat.ClientInfo, error) {
+	return v.Verify(token)
+}
+
+// Verify checks the token signature and claims and returns the user it identifies
+func (v *JWTVerifier) Verify(token string) (*chat.ClientInfo, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return v.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	}
+
+	// Prefer the display name, falling back to the username and then the ID
+	name := claims.Name
+	if name == "" {
+		name = claims.Username
+	}
+	if name == "" {
+		name = claims.Subject
+	}
+
+	return &chat.ClientInfo{
+		UserID:   claims.Subject,
+		Username: name,
+		Role:     chat.Role(claims.Role),
+	}, nil
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// Role Laravel assigns to educators (User::ROLE_EDUCATOR)
+const roleEducator = "educator"
+
+// Cached tokens kept before expired entries are swept
+const maxCachedTokens = 10000
+
+// SanctumUser is the part of the Laravel user model returned by the
+// introspection endpoint. Laravel user IDs are UUID strings.
+type SanctumUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// cachedUser is an accepted token's user and when it must be checked again
+type cachedUser struct {
+	info    chat.ClientInfo
+	expires time.Time
+}
+
+// SanctumAuthenticator checks Laravel Sanctum personal access tokens by
+// calling an endpoint protected by auth:sanctum that returns the current user,
+// such as GET /api/user. Accepted tokens are cached for the configured TTL, so
+// a revoked token keeps working until its entry expires.
+type SanctumAuthenticator struct {
+	endpoint string
+	client   *http.Client
+	ttl      time.Duration
+
+	// Keyed by the token's SHA-256 so raw tokens are not kept in memory
+	cache map[[sha256.Size]byte]cachedUser
+	mutex sync.Mutex
+}
+
+// NewSanctumAuthenticator creates an authenticator for the configured Laravel endpoint
+func NewSanctumAuthenticator(cfg config.SanctumConfig) *SanctumAuthenticator {
+	return &SanctumAuthenticator{
+		endpoint: cfg.Endpoint,
+		client:   &http.Client{Timeout: cfg.Timeout.Std()},
+		ttl:      cfg.CacheTTL.Std(),
+		cache:    make(map[[sha256.Size]byte]cachedUser),
+	}
+}
+
+// Authenticate returns the Laravel user that owns the token
+func (a *SanctumAuthenticator) Authenticate(ctx context.Context, token string) (*chat.ClientInfo, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	key := sha256.Sum256([]byte(token))
+	if info, ok := a.cached(key); ok {
+		return info, nil
+	}
+
+	user, err := a.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	info := user.clientInfo()
+	a.store(key, info)
+
+	return &info, nil
+}
+
+// introspect asks Laravel who the token belongs to
+func (a *SanctumAuthenticator) introspect(ctx context.Context, token string) (*SanctumUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach sanctum endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrInvalidToken
+	default:
+		return nil, fmt.Errorf("sanctum endpoint returned %s", resp.Status)
+	}
+
+	var user SanctumUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode sanctum user: %v", err)
+	}
+	if user.ID == "" {
+		return nil, fmt.Errorf("sanctum endpoint returned a user without an id")
+	}
+
+	return &user, nil
+}
+
+// cached returns the user for a token accepted within the TTL
+func (a *SanctumAuthenticator) cached(key [sha256.Size]byte) (*chat.ClientInfo, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, ok := a.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(a.cache, key)
+		return nil, false
+	}
+
+	info := entry.info
+	return &info, true
+}
+
+// store caches an accepted token
+func (a *SanctumAuthenticator) store(key [sha256.Size]byte, info chat.ClientInfo) {
+	if a.ttl <= 0 {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	if len(a.cache) >= maxCachedTokens {
+		for k, entry := range a.cache {
+			if now.After(entry.expires) {
+				delete(a.cache, k)
+			}
+		}
+	}
+	if len(a.cache) >= maxCachedTokens {
+		// Still full of live entries; start over rather than grow without bound
+		a.cache = make(map[[sha256.Size]byte]cachedUser)
+	}
+
+	a.cache[key] = cachedUser{
+		info:    info,
+		expires: now.Add(a.ttl),
+	}
+}
+
+// clientInfo maps the Laravel user onto chat client metadata
+func (u *SanctumUser) clientInfo() chat.ClientInfo {
+	username := u.Username
+	if username == "" {
+		username = u.Name
+	}
+
+	return chat.ClientInfo{
+		UserID:     u.ID,
+		Username:   username,
+		IsEducator: u.Role == roleEducator,
+	}
+}
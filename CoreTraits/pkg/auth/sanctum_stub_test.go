@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// SanctumStub is a local stand-in for the Laravel GET /api/user endpoint. It
+// answers 200 with the user for known tokens and 401 otherwise, unless told
+// to answer every request with another status.
+type SanctumStub struct {
+	server *httptest.Server
+
+	users    map[string]SanctumUser
+	status   int
+	requests int
+	mutex    sync.Mutex
+}
+
+// NewSanctumStub starts a stub server; call Close when done
+func NewSanctumStub() *SanctumStub {
+	stub := &SanctumStub{
+		users: make(map[string]SanctumUser),
+	}
+	stub.server = httptest.NewServer(http.HandlerFunc(stub.serveUser))
+
+	return stub
+}
+
+// Endpoint returns the URL to use as the Sanctum introspection endpoint
+func (s *SanctumStub) Endpoint() string {
+	return s.server.URL + "/api/user"
+}
+
+// AddToken makes the stub accept a token for the user
+func (s *SanctumStub) AddToken(token string, user SanctumUser) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.users[token] = user
+}
+
+// RevokeToken makes the stub reject a token
+func (s *SanctumStub) RevokeToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.users, token)
+}
+
+// SetStatus makes the stub answer every request with the status, or as
+// usual when it is 0
+func (s *SanctumStub) SetStatus(status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status = status
+}
+
+// Requests returns how many introspection requests the stub has answered
+func (s *SanctumStub) Requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests
+}
+
+// Close shuts the stub server down
+func (s *SanctumStub) Close() {
+	s.server.Close()
+}
+
+// serveUser mimics Route::get('/user') behind auth:sanctum
+func (s *SanctumStub) serveUser(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests++
+	user, ok := s.users[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	status := s.status
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if status != 0 {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"message": http.StatusText(status)})
+		return
+	}
+
+	if r.URL.Path != "/api/user" {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Unauthenticated."})
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// newSanctum starts a stub and an authenticator pointed at it
+func newSanctum(t *testing.T, ttl time.Duration) (*SanctumStub, *SanctumAuthenticator) {
+	t.Helper()
+
+	stub := NewSanctumStub()
+	t.Cleanup(stub.Close)
+
+	return stub, NewSanctumAuthenticator(config.SanctumConfig{
+		Endpoint: stub.Endpoint(),
+		Timeout:  config.Duration(time.Second),
+		CacheTTL: config.Duration(ttl),
+	})
+}
+
+func TestSanctumStatusMapping(t *testing.T) {
+	tests := []struct {
+		status      int
+		wantInvalid bool
+	}{
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, true},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+		{http.StatusServiceUnavailable, false},
+		{http.StatusTooManyRequests, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			stub, sanctum := newSanctum(t, time.Minute)
+			stub.SetStatus(tt.status)
+
+			info, err := sanctum.Authenticate(context.Background(), "token")
+			if err == nil {
+				t.Fatalf("Authenticate() = %+v, want error", info)
+			}
+			if invalid := errors.Is(err, ErrInvalidToken); invalid != tt.wantInvalid {
+				t.Fatalf("Authenticate() = %v, ErrInvalidToken %v, want %v", err, invalid, tt.wantInvalid)
+			}
+			// Anything other than the token errors is answered 503 by RequireToken
+			if errors.Is(err, ErrMissingToken) {
+				t.Fatalf("Authenticate() = %v, want no ErrMissingToken", err)
+			}
+		})
+	}
+}
+
+func TestSanctumAcceptsKnownToken(t *testing.T) {
+	stub, sanctum := newSanctum(t, time.Minute)
+	stub.AddToken("token", SanctumUser{ID: "9b1deb4d-3b7d-4bad-9bdd-2b0d7b3dcb6d", Name: "Ada Lovelace", Username: "ada"})
+
+	info, err := sanctum.Authenticate(context.Background(), "token")
+	if err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	if info.UserID != "9b1deb4d-3b7d-4bad-9bdd-2b0d7b3dcb6d" {
+		t.Errorf("UserID = %q, want the Laravel UUID", info.UserID)
+	}
+
+	if _, err := sanctum.Authenticate(context.Background(), "other"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate(unknown) = %v, want ErrInvalidToken", err)
+	}
+	if _, err := sanctum.Authenticate(context.Background(), ""); !errors.Is(err, ErrMissingToken) {
+		t.Errorf("Authenticate(\"\") = %v, want ErrMissingToken", err)
+	}
+}
+
+func TestSanctumRejectsUserWithoutID(t *testing.T) {
+	stub, sanctum := newSanctum(t, time.Minute)
+	stub.AddToken("token", SanctumUser{Name: "Nobody"})
+
+	_, err := sanctum.Authenticate(context.Background(), "token")
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Authenticate() = %v, want an error other than ErrInvalidToken", err)
+	}
+}
+
+func TestSanctumUserMapping(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         SanctumUser
+		wantUsername string
+		wantEducator bool
+	}{
+		{"username", SanctumUser{ID: "a", Name: "Ada Lovelace", Username: "ada", Role: "student"}, "ada", false},
+		{"name fallback", SanctumUser{ID: "b", Name: "Grace Hopper"}, "Grace Hopper", false},
+		{"educator", SanctumUser{ID: "c", Username: "alan", Role: "educator"}, "alan", true},
+		{"other role", SanctumUser{ID: "d", Username: "admin", Role: "admin"}, "admin", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.user.clientInfo()
+
+			if info.UserID != tt.user.ID {
+				t.Errorf("UserID = %q, want %q", info.UserID, tt.user.ID)
+			}
+			if info.Username != tt.wantUsername {
+				t.Errorf("Username = %q, want %q", info.Username, tt.wantUsername)
+			}
+			if info.IsEducator != tt.wantEducator {
+				t.Errorf("IsEducator = %v, want %v", info.IsEducator, tt.wantEducator)
+			}
+		})
+	}
+}
+
+func TestSanctumCachesUntilTTL(t *testing.T) {
+	stub, sanctum := newSanctum(t, 100*time.Millisecond)
+	stub.AddToken("token", SanctumUser{ID: "a", Username: "ada"})
+
+	for i := 0; i < 3; i++ {
+		if _, err := sanctum.Authenticate(context.Background(), "token"); err != nil {
+			t.Fatalf("Authenticate() = %v", err)
+		}
+	}
+	if got := stub.Requests(); got != 1 {
+		t.Fatalf("introspection requests = %d, want 1 while cached", got)
+	}
+
+	// A revoked token keeps working until its entry expires
+	stub.RevokeToken("token")
+	if _, err := sanctum.Authenticate(context.Background(), "token"); err != nil {
+		t.Fatalf("Authenticate() within TTL = %v, want cached user", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := sanctum.Authenticate(context.Background(), "token"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Authenticate() after TTL = %v, want ErrInvalidToken", err)
+	}
+	if got := stub.Requests(); got != 2 {
+		t.Errorf("introspection requests = %d, want 2 after expiry", got)
+	}
+}
+
+func TestSanctumWithoutCache(t *testing.T) {
+	stub, sanctum := newSanctum(t, 0)
+	stub.AddToken("token", SanctumUser{ID: "a", Username: "ada"})
+
+	for i := 0; i < 2; i++ {
+		if _, err := sanctum.Authenticate(context.Background(), "token"); err != nil {
+			t.Fatalf("Authenticate() = %v", err)
+		}
+	}
+	if got := stub.Requests(); got != 2 {
+		t.Errorf("introspection requests = %d, want 2 with caching off", got)
+	}
+}
+
+func TestSanctumDoesNotCacheFailures(t *testing.T) {
+	stub, sanctum := newSanctum(t, time.Minute)
+	stub.AddToken("token", SanctumUser{ID: "a", Username: "ada"})
+	stub.SetStatus(http.StatusServiceUnavailable)
+
+	if _, err := sanctum.Authenticate(context.Background(), "token"); err == nil {
+		t.Fatal("Authenticate() = nil, want error while Laravel is down")
+	}
+
+	stub.SetStatus(0)
+	if _, err := sanctum.Authenticate(context.Background(), "token"); err != nil {
+		t.Fatalf("Authenticate() after recovery = %v", err)
+	}
+}
+
+func TestSanctumCacheCap(t *testing.T) {
+	_, sanctum := newSanctum(t, time.Minute)
+
+	// Full of expired entries: they are swept and live ones kept
+	expired := time.Now().Add(-time.Second)
+	for i := 0; i < maxCachedTokens-1; i++ {
+		sanctum.cache[sha256.Sum256([]byte(fmt.Sprint("expired", i)))] = cachedUser{expires: expired}
+	}
+	live := sha256.Sum256([]byte("live"))
+	sanctum.cache[live] = cachedUser{expires: time.Now().Add(time.Minute)}
+
+	user := SanctumUser{ID: "a"}
+	sanctum.store(sha256.Sum256([]byte("new")), user.clientInfo())
+	if got := len(sanctum.cache); got != 2 {
+		t.Fatalf("cache size after sweep = %d, want 2", got)
+	}
+	if _, ok := sanctum.cache[live]; !ok {
+		t.Error("sweep dropped a live entry")
+	}
+
+	// Full of live entries: it starts over rather than growing
+	for i := len(sanctum.cache); i < maxCachedTokens; i++ {
+		sanctum.cache[sha256.Sum256([]byte(fmt.Sprint("live", i)))] = cachedUser{expires: time.Now().Add(time.Minute)}
+	}
+	newest := sha256.Sum256([]byte("newest"))
+	sanctum.store(newest, user.clientInfo())
+	if got := len(sanctum.cache); got != 1 {
+		t.Fatalf("cache size after reset = %d, want 1", got)
+	}
+	if _, ok := sanctum.cache[newest]; !ok {
+		t.Error("reset dropped the entry being stored")
+	}
+}
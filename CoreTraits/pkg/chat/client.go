@@ -4,24 +4,49 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/fasthttp/websocket"
 )
 
-const (
+// Settings tunes websocket clients and hubs
+type Settings struct {
 	// Time allowed to write a message to the peer
-	writeWait = 10 * time.Second
+	WriteWait time.Duration
 
 	// Time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period (must be less than pongWait)
-	pingPeriod = (pongWait * 9) / 10
+	PongWait time.Duration
 
 	// Maximum message size allowed from peer
-	maxMessageSize = 512 * 1024 // 512KB
-)
+	MaxMessageSize int64
+
+	// Number of outbound messages buffered per client
+	SendBufferSize int
+
+	// Number of messages new hubs keep in history
+	MaxHistory int
+}
+
+// Active settings, replaced at startup by Configure
+var settings = Settings{
+	WriteWait:      10 * time.Second,
+	PongWait:       60 * time.Second,
+	MaxMessageSize: 512 * 1024, // 512KB
+	SendBufferSize: 256,
+	MaxHistory:     100,
+}
+
+// Configure replaces the client and hub settings. Call before creating hubs.
+func Configure(s Settings) {
+	settings = s
+}
+
+// pingPeriod is how often pings are sent to the peer (must be less than PongWait)
+func pingPeriod() time.Duration {
+	return (settings.PongWait * 9) / 10
+}
 
 // Message represents a chat message
 type Message struct {
@@ -37,7 +62,11 @@ type ClientInfo struct {
 	ID       string `json:"id"`
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
-	Role     string `json:"role,omitempty"`
+	Role     Role   `json:"role,omitempty"`
+
+	// IsEducator is set for Laravel users with the educator role. It and a
+	// role from the token only help work out the user's role in each room.
+	IsEducator bool `json:"is_educator,omitempty"`
 }
 
 // Client is a middleman between the websocket connection and the hub
@@ -55,35 +84,180 @@ type Client struct {
 
 	// IsAlive tracks if the client is active
 	IsAlive bool
+
+	// OnMessageCallback, when set, handles each frame read from the client
+	// instead of it being broadcast as chat. Returning false ends the read loop.
+	OnMessageCallback func(c *Client, message []byte) bool
+
+	// OnConnectionLostCallback, when set, is called when the connection
+	// drops without either side closing it. Returning true detaches the
+	// client instead of removing it from the hub, which keeps queueing its
+	// messages until Hub.Resume hands them to a new connection.
+	OnConnectionLostCallback func(c *Client) bool
+
+	// Guards Send against sends after it is closed
+	sendMutex sync.Mutex
+	closed    bool
+
+	// Set by Close, so disconnects by the server are not taken for lost connections
+	closing atomic.Bool
+
+	// Closed when the client is detached, which stops the write pump
+	detached   chan struct{}
+	detachOnce sync.Once
+
+	// Messages the write pump took from Send but failed to write
+	unsent [][]byte
+
+	// Closed when the write pump returns
+	done chan struct{}
 }
 
 // NewClient creates a new chat client
 func NewClient(hub *Hub, conn *websocket.Conn, info ClientInfo) *Client {
 	return &Client{
-		Hub:     hub,
-		Conn:    conn,
-		Send:    make(chan []byte, 256),
-		Info:    info,
-		IsAlive: true,
+		Hub:      hub,
+		Conn:     conn,
+		Send:     make(chan []byte, settings.SendBufferSize),
+		Info:     info,
+		IsAlive:  true,
+		detached: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// SetOnMessageCallback sets the handler for frames read from the client
+func (c *Client) SetOnMessageCallback(callback func(c *Client, message []byte) bool) {
+	c.OnMessageCallback = callback
+}
+
+// SetOnConnectionLostCallback sets the handler deciding whether a client
+// whose connection dropped is detached for a later resume
+func (c *Client) SetOnConnectionLostCallback(callback func(c *Client) bool) {
+	c.OnConnectionLostCallback = callback
+}
+
+// Queue adds a message to the send buffer without blocking. It reports
+// false when the buffer is full or already closed.
+func (c *Client) Queue(message []byte) bool {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// CloseSend closes the send channel, which ends the write pump. Clients that
+// were never registered with the hub are closed this way.
+func (c *Client) CloseSend() {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// Close disconnects the client. The past read deadline ends the read pump
+// even where closing is deferred, as for hijacked fasthttp connections,
+// which are only closed once the websocket handler returns. Detached
+// clients have no connection left to close.
+func (c *Client) Close() {
+	if c.Detached() {
+		return
+	}
+
+	c.closing.Store(true)
+	c.closeConn()
+}
+
+// Drop closes the connection as if it was lost, so the client may be
+// detached, as when the user resumes from another connection first
+func (c *Client) Drop() {
+	if c.Detached() {
+		return
+	}
+
+	c.closeConn()
+}
+
+// closeConn closes the connection without marking the close as the server's
+func (c *Client) closeConn() {
+	c.Conn.SetReadDeadline(time.Now())
+	c.Conn.Close()
+}
+
+// Detached reports whether the client lost its connection and is waiting
+// in the hub to be resumed
+func (c *Client) Detached() bool {
+	select {
+	case <-c.detached:
+		return true
+	default:
+		return false
 	}
 }
 
+// detach stops the write pump, leaving queued messages in Send
+func (c *Client) detach() {
+	c.detachOnce.Do(func() {
+		close(c.detached)
+	})
+}
+
+// pending returns the messages that were never written to a detached
+// client, oldest first. Send must be closed and the write pump stopped.
+func (c *Client) pending() [][]byte {
+	messages := append([][]byte(nil), c.unsent...)
+	for message := range c.Send {
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// Done is closed once the client's write pump has returned
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
 // ReadPump pumps messages from the websocket connection to the hub
 //
 // The application runs readPump in a per-connection goroutine. The application
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
 func (c *Client) ReadPump() {
+	var readErr error
 	defer func() {
-		c.Hub.Unregister <- c
-		c.Conn.Close()
+		// Close first so frames sent from here on stay queued for a resume
+		// rather than being written to the dead connection
+		c.closeConn()
+
+		// Connections that drop without a close frame may be resumed
+		lost := readErr != nil && !c.closing.Load() &&
+			!websocket.IsCloseError(readErr, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+		keep := lost && c.OnConnectionLostCallback != nil && c.OnConnectionLostCallback(c)
+
+		if keep {
+			c.detach()
+		} else {
+			c.Hub.Leave(c)
+		}
 		c.IsAlive = false
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetReadLimit(settings.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(settings.PongWait))
 	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.Conn.SetReadDeadline(time.Now().Add(settings.PongWait))
 		return nil
 	})
 
@@ -93,37 +267,52 @@ func (c *Client) ReadPump() {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("websocket error: %v", err)
 			}
+			readErr = err
 			break
 		}
 
-		// Process message (could be JSON or other format)
-		// In this example, we'll assume it's a JSON chat message
-		var chatMessage Message
-		
-		err = json.Unmarshal(message, &chatMessage)
-		if err != nil {
-			// If not valid JSON, create a text message instead
-			chatMessage = Message{
-				Type:    "text",
-				Content: string(message),
-				Sender:  &c.Info,
-				Time:    time.Now(),
+		if c.OnMessageCallback != nil {
+			if !c.OnMessageCallback(c, message) {
+				break
 			}
-		} else {
-			// Ensure sender info is correct regardless of what client sent
-			chatMessage.Sender = &c.Info
-			chatMessage.Time = time.Now()
+			continue
 		}
 
-		// Re-encode with correct sender info
-		messageBytes, err := json.Marshal(chatMessage)
-		if err != nil {
-			log.Printf("error encoding message: %v", err)
+		// Clients whose role may not chat are ignored
+		if c.Info.Role != "" && !c.Info.Role.Can(CapSendChat) {
 			continue
 		}
 
-		c.Hub.Broadcast <- messageBytes
+		c.Chat(message)
+	}
+}
+
+// Chat broadcasts a chat message from the client as a text message stamped
+// with its identity. Only the content of a JSON message is kept, so clients
+// cannot send other message types or payloads through the chat.
+func (c *Client) Chat(message []byte) {
+	content := string(message)
+
+	var sent Message
+	if err := json.Unmarshal(message, &sent); err == nil {
+		content = sent.Content
 	}
+
+	chatMessage := Message{
+		Type:    "text",
+		Content: content,
+		Sender:  &c.Info,
+		Time:    time.Now(),
+	}
+
+	// Re-encode with correct sender info
+	messageBytes, err := json.Marshal(chatMessage)
+	if err != nil {
+		log.Printf("error encoding message: %v", err)
+		return
+	}
+
+	c.Hub.Publish(messageBytes)
 }
 
 // WritePump pumps messages from the hub to the websocket connection
@@ -132,40 +321,51 @@ func (c *Client) ReadPump() {
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(pingPeriod())
 	defer func() {
 		ticker.Stop()
-		c.Conn.Close()
+		if !c.Detached() {
+			c.closeConn()
+		}
+		close(c.done)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.SetWriteDeadline(time.Now().Add(settings.WriteWait))
 			if !ok {
 				// The hub closed the channel
+				c.closing.Store(true)
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
 			w, err := c.Conn.NextWriter(websocket.TextMessage)
 			if err != nil {
+				c.unsent = [][]byte{message}
 				return
 			}
 			w.Write(message)
+			batch := [][]byte{message}
 
 			// Add queued messages to the current websocket message
 			n := len(c.Send)
 			for i := 0; i < n; i++ {
+				queued := <-c.Send
 				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
+				w.Write(queued)
+				batch = append(batch, queued)
 			}
 
 			if err := w.Close(); err != nil {
+				c.unsent = batch
 				return
 			}
+		case <-c.detached:
+			return
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.SetWriteDeadline(time.Now().Add(settings.WriteWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -187,10 +387,8 @@ func (c *Client) SendEvent(eventType string, data interface{}) {
 		return
 	}
 
-	select {
-	case c.Send <- eventBytes:
-	default:
-		// Drop the message if the client's send buffer is full
+	if !c.Queue(eventBytes) {
+		// Drop the message if the client's send buffer is full or closed
 		fmt.Printf("client %s send buffer full, dropping message", c.Info.ID)
 	}
 }
\ No newline at end of file
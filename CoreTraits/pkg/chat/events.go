@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// UserEventData is the payload of user_joined and user_left system events
+type UserEventData struct {
+	User *ClientInfo `json:"user"`
+}
+
+// HistoryData is the payload of the history system event. Messages that
+// were stored as JSON are sent as objects, others as strings.
+type HistoryData struct {
+	Messages []interface{} `json:"messages"`
+}
+
+// Events lists the messages a hub sends to its clients
+var Events = []events.Spec{
+	systemEvent("user_joined", "A client joined the hub", UserEventData{User: &ClientInfo{}}),
+	systemEvent("user_left", "A client left the hub", UserEventData{User: &ClientInfo{}}),
+	systemEvent("history", "Recent messages, sent to a client when it joins", HistoryData{}),
+	{
+		Channel:     events.ChannelChat,
+		Name:        "text",
+		Description: "A chat message stamped with its sender",
+		Key:         "type",
+		Example:     Message{Type: "text", Sender: &ClientInfo{}},
+	},
+}
+
+// systemEvent describes a system event with the given payload type
+func systemEvent(name, description string, data interface{}) events.Spec {
+	return events.Spec{
+		Channel:     events.ChannelChat,
+		Name:        name,
+		Description: description,
+		Key:         "event",
+		Example:     SystemMessage{Type: "system", Event: name, Data: data},
+	}
+}
@@ -1,6 +1,7 @@
 package chat
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -32,6 +33,13 @@ type Hub struct {
 
 	// Lock for concurrent access to the Clients map
 	mutex sync.RWMutex
+
+	// Closed by Stop or when Run's context ends
+	quit     chan struct{}
+	stopOnce sync.Once
+
+	// Closed once Run has returned and the clients have drained
+	drained chan struct{}
 }
 
 // SystemMessage creates a new system message
@@ -50,15 +58,31 @@ func NewHub(id string) *Hub {
 		Unregister:     make(chan *Client),
 		Clients:        make(map[*Client]bool),
 		MessageHistory: make([][]byte, 0),
-		MaxHistory:     100, // Keep last 100 messages
+		MaxHistory:     settings.MaxHistory,
 		ID:             id,
+		quit:           make(chan struct{}),
+		drained:        make(chan struct{}),
 	}
 }
 
-// Run starts the hub's main loop
-func (h *Hub) Run() {
+// Run starts the hub's main loop. It runs until ctx is done or Stop is
+// called, then closes every client's send channel and waits for their
+// write pumps before reporting the hub drained through Done.
+func (h *Hub) Run(ctx context.Context) {
+	defer close(h.drained)
+	
 	for {
 		select {
+		case <-ctx.Done():
+			h.Stop()
+			h.drain()
+			return
+			
+		case <-h.quit:
+			h.drain()
+			return
+			
+
 		case client := <-h.Register:
 			// Add client to the map
 			h.mutex.Lock()
@@ -69,50 +93,125 @@ func (h *Hub) Run() {
 			h.sendMessageHistory(client)
 			
 			// Broadcast join event
-			h.broadcastSystemEvent("user_joined", map[string]interface{}{
-				"user": client.Info,
-			})
+			h.broadcastSystemEvent("user_joined", UserEventData{User: &client.Info})
 			
 		case client := <-h.Unregister:
 			// Check if client is registered
 			h.mutex.Lock()
-			if _, ok := h.Clients[client]; ok {
+			_, ok := h.Clients[client]
+			if ok {
 				delete(h.Clients, client)
-				close(client.Send)
-				
-				// Broadcast leave event
-				h.broadcastSystemEvent("user_left", map[string]interface{}{
-					"user": client.Info,
-				})
+				client.CloseSend()
 			}
 			h.mutex.Unlock()
 			
+			// Broadcast leave event, which takes the lock itself
+			if ok {
+				h.broadcastSystemEvent("user_left", UserEventData{User: &client.Info})
+			}
+			
 		case message := <-h.Broadcast:
 			// Store message in history if enabled
 			if h.MaxHistory > 0 {
 				h.addToMessageHistory(message)
 			}
 			
-			// Broadcast message to all clients
-			h.mutex.RLock()
+			// Broadcast message to all clients, removing those whose buffer is full
+			h.mutex.Lock()
 			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					// If client's buffer is full, remove them
-					h.mutex.RUnlock()
-					h.mutex.Lock()
+				if !client.Queue(message) {
 					delete(h.Clients, client)
-					close(client.Send)
-					h.mutex.Unlock()
-					h.mutex.RLock()
+					client.CloseSend()
 				}
 			}
-			h.mutex.RUnlock()
+			h.mutex.Unlock()
 		}
 	}
 }
 
+// drain closes every client's send channel and waits, up to the write
+// deadline, for their write pumps to send the close frame and return
+func (h *Hub) drain() {
+	h.mutex.RLock()
+	clients := make([]*Client, 0, len(h.Clients))
+	for client := range h.Clients {
+		client.CloseSend()
+		clients = append(clients, client)
+	}
+	h.mutex.RUnlock()
+	
+	deadline := time.After(settings.WriteWait)
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// Stop ends Run. Messages and clients sent to the hub afterwards are dropped.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.quit)
+	})
+}
+
+// Done is closed once the hub has stopped and its clients have drained
+func (h *Hub) Done() <-chan struct{} {
+	return h.drained
+}
+
+// Publish broadcasts a message to every client, unless the hub has stopped
+func (h *Hub) Publish(message []byte) {
+	select {
+	case h.Broadcast <- message:
+	case <-h.quit:
+	}
+}
+
+// Join registers a client with the hub, unless the hub has stopped
+func (h *Hub) Join(client *Client) {
+	select {
+	case h.Register <- client:
+	case <-h.quit:
+		client.CloseSend()
+	}
+}
+
+// Leave unregisters a client from the hub, unless the hub has stopped
+func (h *Hub) Leave(client *Client) {
+	select {
+	case h.Unregister <- client:
+	case <-h.quit:
+	}
+}
+
+// Resume hands the place of a detached client to a client on a new
+// connection, queueing it the messages the detached client missed. It
+// reports false when the hub already dropped the detached client, as it
+// does once its send buffer fills.
+func (h *Hub) Resume(detached, client *Client) bool {
+	// The write pump must have stopped taking from Send
+	<-detached.done
+	
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	
+	if _, ok := h.Clients[detached]; !ok {
+		return false
+	}
+	delete(h.Clients, detached)
+	detached.CloseSend()
+	
+	for _, message := range detached.pending() {
+		client.Queue(message)
+	}
+	h.Clients[client] = true
+	
+	return true
+}
+
 // addToMessageHistory adds a message to the history, maintaining MaxHistory limit
 func (h *Hub) addToMessageHistory(message []byte) {
 	if len(h.MessageHistory) >= h.MaxHistory {
@@ -126,14 +225,22 @@ func (h *Hub) addToMessageHistory(message []byte) {
 
 // sendMessageHistory sends the message history to a newly connected client
 func (h *Hub) sendMessageHistory(client *Client) {
+	// Send JSON messages as they are rather than base64 encoded
+	messages := make([]interface{}, 0, len(h.MessageHistory))
+	for _, message := range h.MessageHistory {
+		if json.Valid(message) {
+			messages = append(messages, json.RawMessage(message))
+		} else {
+			messages = append(messages, string(message))
+		}
+	}
+	
 	// Create a system message with history
 	historyMessage := SystemMessage{
 		Type:  "system",
 		Event: "history",
 		Time:  time.Now(),
-		Data: map[string]interface{}{
-			"messages": h.MessageHistory,
-		},
+		Data:  HistoryData{Messages: messages},
 	}
 	
 	// Marshal the history message
@@ -143,12 +250,8 @@ func (h *Hub) sendMessageHistory(client *Client) {
 		return
 	}
 	
-	// Send history to the client
-	select {
-	case client.Send <- historyBytes:
-	default:
-		// If client's buffer is full, we can't send history
-	}
+	// Send history to the client, skipped if its buffer is full
+	client.Queue(historyBytes)
 }
 
 // broadcastSystemEvent sends a system event to all clients
@@ -171,11 +274,8 @@ func (h *Hub) broadcastSystemEvent(event string, data interface{}) {
 	// Broadcast to all clients
 	h.mutex.RLock()
 	for client := range h.Clients {
-		select {
-		case client.Send <- systemBytes:
-		default:
-			// If client's buffer is full, skip this client
-		}
+		// If client's buffer is full, skip this client
+		client.Queue(systemBytes)
 	}
 	h.mutex.RUnlock()
 }
@@ -221,11 +321,8 @@ func (h *Hub) BroadcastToUser(userID string, message []byte) {
 	clients := h.GetClientsByUserID(userID)
 	
 	for _, client := range clients {
-		select {
-		case client.Send <- message:
-		default:
-			// If client's buffer is full, skip this client
-		}
+		// If client's buffer is full, skip this client
+		client.Queue(message)
 	}
 }
 
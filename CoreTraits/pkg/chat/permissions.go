@@ -0,0 +1,93 @@
+package chat
+
+// Role is a participant's permission level in a room or stream
+type Role string
+
+// Roles, from most to least privileged
+const (
+	RoleModerator   Role = "moderator"
+	RolePresenter   Role = "presenter"
+	RoleParticipant Role = "participant"
+	RoleViewer      Role = "viewer"
+)
+
+// roleOrder ranks the roles, from most to least privileged
+var roleOrder = []Role{RoleModerator, RolePresenter, RoleParticipant, RoleViewer}
+
+// Capability is an action a role may be allowed to take
+type Capability string
+
+// Capabilities checked by the signaling and chat paths
+const (
+	CapPublishAudio    Capability = "publish_audio"
+	CapPublishVideo    Capability = "publish_video"
+	CapShareScreen     Capability = "share_screen"
+	CapSendChat        Capability = "send_chat"
+	CapMuteOthers      Capability = "mute_others"
+	CapRemovePeers     Capability = "remove_peers"
+	CapChangeSettings  Capability = "change_settings"
+	CapAssignRoles     Capability = "assign_roles"
+	CapCloseRoom       Capability = "close_room"
+	CapAdmitPeers      Capability = "admit_peers"
+	CapManageBreakouts Capability = "manage_breakouts"
+	CapManageHands     Capability = "manage_hands"
+)
+
+// capabilities is the permission matrix
+var capabilities = map[Role][]Capability{
+	RoleModerator: {
+		CapPublishAudio, CapPublishVideo, CapShareScreen, CapSendChat,
+		CapMuteOthers, CapRemovePeers, CapChangeSettings, CapAssignRoles, CapCloseRoom,
+		CapAdmitPeers, CapManageBreakouts, CapManageHands,
+	},
+	RolePresenter: {
+		CapPublishAudio, CapPublishVideo, CapShareScreen, CapSendChat,
+	},
+	RoleParticipant: {
+		CapPublishAudio, CapPublishVideo, CapSendChat,
+	},
+	RoleViewer: {
+		CapSendChat,
+	},
+}
+
+// ParseRole returns the role with the given name, reporting whether it exists
+func ParseRole(name string) (Role, bool) {
+	role := Role(name)
+	_, ok := capabilities[role]
+	return role, ok
+}
+
+// Can reports whether the role has the capability. Unknown roles have none.
+func (r Role) Can(capability Capability) bool {
+	for _, c := range capabilities[r] {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// AtMost returns the role, lowered to limit when limit is less privileged.
+// Unknown limits lower it to nothing.
+func (r Role) AtMost(limit Role) Role {
+	if rank(limit) > rank(r) {
+		return limit
+	}
+	return r
+}
+
+// rank returns the role's position in roleOrder, after every role if unknown
+func rank(role Role) int {
+	for i, r := range roleOrder {
+		if r == role {
+			return i
+		}
+	}
+	return len(roleOrder)
+}
+
+// Capabilities returns everything the role may do
+func (r Role) Capabilities() []Capability {
+	return append([]Capability(nil), capabilities[r]...)
+}
@@ -0,0 +1,79 @@
+package chat
+
+import "testing"
+
+func TestCapabilityMatrix(t *testing.T) {
+	all := []Capability{
+		CapPublishAudio, CapPublishVideo, CapShareScreen, CapSendChat,
+		CapMuteOthers, CapRemovePeers, CapChangeSettings, CapAssignRoles, CapCloseRoom,
+		CapAdmitPeers, CapManageBreakouts, CapManageHands,
+	}
+	allowed := map[Role][]Capability{
+		RoleModerator:   all,
+		RolePresenter:   {CapPublishAudio, CapPublishVideo, CapShareScreen, CapSendChat},
+		RoleParticipant: {CapPublishAudio, CapPublishVideo, CapSendChat},
+		RoleViewer:      {CapSendChat},
+		Role("admin"):   nil,
+		Role(""):        nil,
+	}
+
+	for role, capabilities := range allowed {
+		want := make(map[Capability]bool)
+		for _, capability := range capabilities {
+			want[capability] = true
+		}
+
+		for _, capability := range all {
+			if got := role.Can(capability); got != want[capability] {
+				t.Errorf("Role(%q).Can(%s) = %v, want %v", role, capability, got, want[capability])
+			}
+		}
+		if got := len(role.Capabilities()); got != len(capabilities) {
+			t.Errorf("Role(%q).Capabilities() has %d entries, want %d", role, got, len(capabilities))
+		}
+	}
+}
+
+func TestCapabilitiesReturnsCopy(t *testing.T) {
+	capabilities := RoleViewer.Capabilities()
+	capabilities[0] = CapCloseRoom
+
+	if RoleViewer.Can(CapCloseRoom) {
+		t.Fatal("changing Capabilities() changed the matrix")
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, name := range []string{"moderator", "presenter", "participant", "viewer"} {
+		if role, ok := ParseRole(name); !ok || string(role) != name {
+			t.Errorf("ParseRole(%q) = %q, %v", name, role, ok)
+		}
+	}
+	for _, name := range []string{"", "admin", "Moderator"} {
+		if _, ok := ParseRole(name); ok {
+			t.Errorf("ParseRole(%q) accepted an unknown role", name)
+		}
+	}
+}
+
+func TestAtMost(t *testing.T) {
+	tests := []struct {
+		role  Role
+		limit Role
+		want  Role
+	}{
+		{RoleModerator, RoleModerator, RoleModerator},
+		{RoleModerator, RolePresenter, RolePresenter},
+		{RoleModerator, RoleViewer, RoleViewer},
+		{RoleParticipant, RoleModerator, RoleParticipant},
+		{RolePresenter, RoleParticipant, RoleParticipant},
+		{RoleViewer, RolePresenter, RoleViewer},
+		{RoleModerator, Role("admin"), Role("admin")},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.AtMost(tt.limit); got != tt.want {
+			t.Errorf("%s.AtMost(%s) = %s, want %s", tt.role, tt.limit, got, tt.want)
+		}
+	}
+}
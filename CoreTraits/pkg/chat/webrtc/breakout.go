@@ -0,0 +1,177 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Errors returned by breakout operations
+var (
+	ErrBreakoutsOpen   = errors.New("breakout rooms are already open")
+	ErrNoBreakouts     = errors.New("no breakout rooms are open")
+	ErrUnknownBreakout = errors.New("breakout room not found")
+	ErrNestedBreakouts = errors.New("breakout rooms cannot have breakout rooms")
+)
+
+// StartBreakouts opens child rooms under the room. With a positive duration
+// the breakouts end callback fires when the time is up.
+func (r *Room) StartBreakouts(children []*Room, duration time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	// Check if room is active
+	if !r.IsActive {
+		return fmt.Errorf("room is no longer active")
+	}
+	if r.Parent != nil {
+		return ErrNestedBreakouts
+	}
+	if len(r.Breakouts) > 0 {
+		return ErrBreakoutsOpen
+	}
+	
+	for _, child := range children {
+		child.Parent = r
+	}
+	r.Breakouts = children
+	r.Assignments = make(map[string]string)
+	
+	// Bring everyone back automatically when the time is up
+	if duration > 0 {
+		r.BreakoutsEndAt = time.Now().Add(duration)
+		r.breakoutTimer = time.AfterFunc(duration, func() {
+			if r.OnBreakoutsEndCallback != nil {
+				r.OnBreakoutsEndCallback()
+			}
+		})
+	}
+	
+	return nil
+}
+
+// AssignBreakout puts a user in one of the open breakout rooms, replacing
+// any earlier assignment
+func (r *Room) AssignBreakout(userID, breakoutID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	if len(r.Breakouts) == 0 {
+		return ErrNoBreakouts
+	}
+	if r.breakout(breakoutID) == nil {
+		return ErrUnknownBreakout
+	}
+	
+	r.Assignments[userID] = breakoutID
+	
+	return nil
+}
+
+// AssignBreakoutsRandomly spreads the users evenly over the open breakout
+// rooms in random order and returns the user ID to breakout ID assignments made
+func (r *Room) AssignBreakoutsRandomly(userIDs []string) (map[string]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	if len(r.Breakouts) == 0 {
+		return nil, ErrNoBreakouts
+	}
+	
+	shuffled := append([]string(nil), userIDs...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	
+	assigned := make(map[string]string, len(shuffled))
+	for i, userID := range shuffled {
+		breakoutID := r.Breakouts[i%len(r.Breakouts)].ID
+		r.Assignments[userID] = breakoutID
+		assigned[userID] = breakoutID
+	}
+	
+	return assigned, nil
+}
+
+// BreakoutFor returns the breakout room a user is assigned to
+func (r *Room) BreakoutFor(userID string) (*Room, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	child := r.breakout(r.Assignments[userID])
+	return child, child != nil
+}
+
+// GetBreakouts returns the open breakout rooms
+func (r *Room) GetBreakouts() []*Room {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return append([]*Room(nil), r.Breakouts...)
+}
+
+// GetAssignments returns a copy of the user ID to breakout ID assignments
+func (r *Room) GetAssignments() map[string]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	assignments := make(map[string]string, len(r.Assignments))
+	for userID, breakoutID := range r.Assignments {
+		assignments[userID] = breakoutID
+	}
+	return assignments
+}
+
+// GetBreakoutsEndAt returns when the open breakouts end, or the zero time
+// when they run until ended
+func (r *Room) GetBreakoutsEndAt() time.Time {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return r.BreakoutsEndAt
+}
+
+// EndBreakouts closes every breakout room and forgets the assignments. It
+// returns the rooms that were closed.
+func (r *Room) EndBreakouts() ([]*Room, error) {
+	r.mutex.Lock()
+	
+	if len(r.Breakouts) == 0 {
+		r.mutex.Unlock()
+		return nil, ErrNoBreakouts
+	}
+	
+	if r.breakoutTimer != nil {
+		r.breakoutTimer.Stop()
+		r.breakoutTimer = nil
+	}
+	
+	children := r.Breakouts
+	r.Breakouts = nil
+	r.Assignments = nil
+	r.BreakoutsEndAt = time.Time{}
+	r.mutex.Unlock()
+	
+	// Children take their own locks while closing
+	for _, child := range children {
+		child.Close()
+	}
+	
+	return children, nil
+}
+
+// breakout returns the open breakout room with the ID. The caller must hold the lock.
+func (r *Room) breakout(id string) *Room {
+	for _, child := range r.Breakouts {
+		if child.ID == id {
+			return child
+		}
+	}
+	return nil
+}
+
+// SetOnBreakoutsEndCallback sets the callback for breakouts running out of time
+func (r *Room) SetOnBreakoutsEndCallback(callback func()) {
+	r.OnBreakoutsEndCallback = callback
+}
@@ -0,0 +1,81 @@
+package webrtc
+
+import (
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/events"
+)
+
+// DataChannelMessage is a message a peer sends over its data channel
+type DataChannelMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+	Status  string `json:"status,omitempty"`
+}
+
+// ChatMessageData is the payload of a chat_message event
+type ChatMessageData struct {
+	Message string `json:"message"`
+}
+
+// PeerStatusData is the payload of a peer_status event
+type PeerStatusData struct {
+	Status string `json:"status"`
+}
+
+// NewTrackData is the payload of a new_track event
+type NewTrackData struct {
+	TrackID   string `json:"track_id"`
+	TrackKind string `json:"track_kind"`
+	StreamID  string `json:"stream_id"`
+}
+
+// StreamEndData is the payload of a stream_end event
+type StreamEndData struct {
+	Duration      int64 `json:"duration"`
+	PeakViewers   int   `json:"peak_viewers"`
+	TotalViewers  int   `json:"total_viewers"`
+	BytesStreamed int64 `json:"bytes_streamed"`
+}
+
+// Events lists the events rooms and streams send over peer data channels
+var Events = []events.Spec{
+	RoomEventSpec("peer_join", "A peer joined the room", nil),
+	RoomEventSpec("peer_leave", "A peer left the room", nil),
+	RoomEventSpec("peer_connected", "A peer's connection was established", nil),
+	RoomEventSpec("peer_disconnected", "A peer's connection was lost", nil),
+	RoomEventSpec("room_close", "The room was closed", nil),
+	RoomEventSpec("new_track", "A peer started publishing a track", NewTrackData{}),
+	RoomEventSpec("chat_message", "A peer sent a chat message", ChatMessageData{}),
+	RoomEventSpec("peer_status", "A peer changed its status", PeerStatusData{}),
+	StreamEventSpec("stream_start", "The broadcaster started the stream", nil),
+	StreamEventSpec("stream_end", "The stream ended", StreamEndData{}),
+	StreamEventSpec("viewer_join", "A viewer joined the stream", nil),
+	StreamEventSpec("viewer_leave", "A viewer left the stream", nil),
+	StreamEventSpec("peer_connected", "A peer's connection was established", nil),
+	StreamEventSpec("peer_disconnected", "A peer's connection was lost", nil),
+	StreamEventSpec("chat_message", "A viewer sent a chat message", ChatMessageData{}),
+}
+
+// RoomEventSpec describes a room data channel event with the given payload
+// type, nil for events without one. Use it for events sent with Room.Announce.
+func RoomEventSpec(name, description string, data interface{}) events.Spec {
+	return events.Spec{
+		Channel:     events.ChannelRoomData,
+		Name:        name,
+		Description: description,
+		Key:         "type",
+		Example:     RoomEvent{Type: name, Room: &RoomInfo{}, Peer: &PeerInfo{}, Data: data},
+	}
+}
+
+// StreamEventSpec describes a stream data channel event with the given
+// payload type, nil for events without one. Use it for events sent with
+// Stream.Announce.
+func StreamEventSpec(name, description string, data interface{}) events.Spec {
+	return events.Spec{
+		Channel:     events.ChannelStreamData,
+		Name:        name,
+		Description: description,
+		Key:         "type",
+		Example:     StreamEvent{Type: name, Stream: &StreamInfo{}, Viewer: &PeerInfo{}, Data: data},
+	}
+}
@@ -7,9 +7,42 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 )
 
+const (
+	// How often publishers are asked for a keyframe so new subscribers can start decoding
+	keyFrameInterval = 3 * time.Second
+
+	// Size of the buffer used to forward RTP packets
+	rtpBufferSize = 1500
+)
+
+// Settings tunes peer connections and signaling for all sessions
+type Settings struct {
+	// STUN/TURN servers offered to peer connections
+	ICEServers []webrtc.ICEServer
+
+	// Number of signals queued per room or stream
+	SignalBufferSize int
+}
+
+// Active settings, replaced at startup by Configure
+var settings = Settings{
+	ICEServers: []webrtc.ICEServer{
+		{
+			URLs: []string{"stun:stun.l.google.com:19302"},
+		},
+	},
+	SignalBufferSize: 100,
+}
+
+// Configure replaces the peer connection settings. Call before creating rooms or streams.
+func Configure(s Settings) {
+	settings = s
+}
+
 // PeerManager manages WebRTC peer connections
 type PeerManager struct {
 	// Lock for concurrent access
@@ -21,8 +54,11 @@ type PeerManager struct {
 	// Configuration for WebRTC
 	config webrtc.Configuration
 	
-	// Room this peer manager belongs to
-	room *Room
+	// Session (room or stream) this peer manager belongs to
+	sessionID string
+	
+	// Receiver of peer connection events
+	sink PeerEventSink
 	
 	// MediaTrack sources
 	videoTracks map[string]*webrtc.TrackLocalStaticRTP
@@ -39,8 +75,10 @@ type Peer struct {
 	// Connection
 	Connection *webrtc.PeerConnection
 	
-	// Tracks this peer is sending
+	// Tracks this peer is sending, by trackKey. Forwarders and joining peers
+	// change it from their own goroutines, so hold tracksMutex.
 	LocalTracks map[string]*webrtc.TrackLocalStaticRTP
+	tracksMutex sync.Mutex
 	
 	// Tracks this peer is receiving
 	RemoteTracks map[string]*webrtc.TrackRemote
@@ -54,12 +92,164 @@ type Peer struct {
 	IsSubscriber bool
 	JoinedAt     time.Time
 	
-	// Settings
+	// Guards Connected, IsPublisher, RemoteTracks and DataChannel, which the
+	// peer connection's callbacks change from their own goroutines
+	stateMutex sync.RWMutex
+	
+	// Settings. Forwarding of the peer's media follows these, so change them
+	// with SetMediaEnabled while the peer is publishing.
 	VideoEnabled  bool
 	AudioEnabled  bool
 	ScreenEnabled bool
+	
+	// ID of the video track carrying the screen share, as declared by the client
+	ScreenTrackID string
+	
+	// Guards the media settings, which forwarders read for every packet
+	mediaMutex sync.RWMutex
+	
+	// Set when tracks changed while an offer/answer exchange was in flight
+	renegotiationPending bool
+}
+
+// MediaKind names one kind of media a peer publishes
+type MediaKind string
+
+// Kinds of media that can be switched on and off per peer
+const (
+	MediaAudio  MediaKind = "audio"
+	MediaVideo  MediaKind = "video"
+	MediaScreen MediaKind = "screen"
+)
+
+// SetMediaEnabled turns forwarding of one kind of the peer's media on or off
+func (p *Peer) SetMediaEnabled(kind MediaKind, enabled bool) {
+	p.mediaMutex.Lock()
+	defer p.mediaMutex.Unlock()
+	
+	switch kind {
+	case MediaAudio:
+		p.AudioEnabled = enabled
+	case MediaVideo:
+		p.VideoEnabled = enabled
+	case MediaScreen:
+		p.ScreenEnabled = enabled
+	}
+}
+
+// SetScreenTrack records which of the peer's video tracks is the screen share
+func (p *Peer) SetScreenTrack(trackID string) {
+	p.mediaMutex.Lock()
+	defer p.mediaMutex.Unlock()
+	
+	p.ScreenTrackID = trackID
+}
+
+// forwards reports whether packets from one of the peer's tracks should
+// currently reach other peers
+func (p *Peer) forwards(track *webrtc.TrackRemote) bool {
+	p.mediaMutex.RLock()
+	defer p.mediaMutex.RUnlock()
+	
+	if track.Kind() == webrtc.RTPCodecTypeAudio {
+		return p.AudioEnabled
+	}
+	if p.ScreenTrackID != "" && track.ID() == p.ScreenTrackID {
+		return p.ScreenEnabled
+	}
+	return p.VideoEnabled
+}
+
+// IsConnected reports whether the peer's ICE connection is established
+func (p *Peer) IsConnected() bool {
+	p.stateMutex.RLock()
+	defer p.stateMutex.RUnlock()
+	
+	return p.Connected
+}
+
+// setConnected records whether the peer's ICE connection is established
+func (p *Peer) setConnected(connected bool) {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	
+	p.Connected = connected
 }
 
+// addRemoteTrack records a track the peer started sending
+func (p *Peer) addRemoteTrack(track *webrtc.TrackRemote) {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	
+	p.RemoteTracks[track.ID()] = track
+	p.IsPublisher = true
+}
+
+// setDataChannel records the data channel events are sent to the peer over
+func (p *Peer) setDataChannel(dataChannel *webrtc.DataChannel) {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	
+	p.DataChannel = dataChannel
+}
+
+// dataChannel returns the peer's data channel, or nil before it has one
+func (p *Peer) dataChannel() *webrtc.DataChannel {
+	p.stateMutex.RLock()
+	defer p.stateMutex.RUnlock()
+	
+	return p.DataChannel
+}
+
+// sends reports whether a local track is already being sent to the peer
+func (p *Peer) sends(track *webrtc.TrackLocalStaticRTP) bool {
+	p.tracksMutex.Lock()
+	defer p.tracksMutex.Unlock()
+	
+	_, sending := p.LocalTracks[trackKey(track)]
+	return sending
+}
+
+// trackKey identifies a local track. Clients reuse track IDs such as "audio"
+// across publishers, so the key includes the stream ID.
+func trackKey(track *webrtc.TrackLocalStaticRTP) string {
+	return track.StreamID() + "/" + track.ID()
+}
+
+// PeerEventSink receives the events raised by a PeerManager's peer connections.
+// Rooms, streams and any other session type implement it to plug into a PeerManager.
+type PeerEventSink interface {
+	// OnOutgoingSignal delivers a server-generated signal (answer, offer, ICE candidate) to the client
+	OnOutgoingSignal(signal *SignalMessage)
+	
+	// OnPeerConnected is called when a peer's ICE connection is established
+	OnPeerConnected(peerID string)
+	
+	// OnPeerDisconnected is called when a peer's ICE connection drops, fails or closes
+	OnPeerDisconnected(peerID string)
+	
+	// OnNewTrack is called when a peer starts sending a media track
+	OnNewTrack(peerID string, track *webrtc.TrackRemote)
+	
+	// OnDataChannelMessage is called when a peer sends a data channel message
+	OnDataChannelMessage(peerID string, data []byte)
+}
+
+// nopEventSink discards all peer events
+type nopEventSink struct{}
+
+func (nopEventSink) OnOutgoingSignal(*SignalMessage)        {}
+func (nopEventSink) OnPeerConnected(string)                 {}
+func (nopEventSink) OnPeerDisconnected(string)              {}
+func (nopEventSink) OnNewTrack(string, *webrtc.TrackRemote) {}
+func (nopEventSink) OnDataChannelMessage(string, []byte)    {}
+
+// Sessions that plug into a PeerManager
+var (
+	_ PeerEventSink = (*Room)(nil)
+	_ PeerEventSink = (*Stream)(nil)
+)
+
 // PeerEvent represents an event related to a peer
 type PeerEvent struct {
 	Type      string                 `json:"type"`
@@ -84,20 +274,18 @@ type SignalMessage struct {
 	Data      json.RawMessage `json:"data"`
 }
 
-// NewPeerManager creates a new peer manager
-func NewPeerManager(room *Room) *PeerManager {
-	// Setup ICE servers for STUN/TURN
-	iceServers := []webrtc.ICEServer{
-		{
-			URLs: []string{"stun:stun.l.google.com:19302"},
-		},
-		// Add TURN servers for production use
+// NewPeerManager creates a new peer manager for a session.
+// Peer connection events are reported to sink; a nil sink discards them.
+func NewPeerManager(sessionID string, sink PeerEventSink) *PeerManager {
+	if sink == nil {
+		sink = nopEventSink{}
 	}
 	
 	return &PeerManager{
 		peers:       make(map[string]*Peer),
-		config:      webrtc.Configuration{ICEServers: iceServers},
-		room:        room,
+		config:      webrtc.Configuration{ICEServers: settings.ICEServers},
+		sessionID:   sessionID,
+		sink:        sink,
 		videoTracks: make(map[string]*webrtc.TrackLocalStaticRTP),
 		audioTracks: make(map[string]*webrtc.TrackLocalStaticRTP),
 	}
@@ -163,9 +351,6 @@ func (pm *PeerManager) RemovePeer(id string) error {
 	// Remove the peer from the manager
 	delete(pm.peers, id)
 	
-	// Notify the room about the peer leaving
-	pm.room.OnPeerLeave(id)
-	
 	return nil
 }
 
@@ -205,6 +390,8 @@ func (pm *PeerManager) ProcessSignal(signal *SignalMessage) error {
 		return pm.handleAnswer(signal)
 	case "ice-candidate":
 		return pm.handleICECandidate(signal)
+	case "renegotiate":
+		return pm.handleRenegotiate(signal)
 	default:
 		return fmt.Errorf("unknown signal type: %s", signal.Type)
 	}
@@ -254,8 +441,13 @@ func (pm *PeerManager) handleOffer(signal *SignalMessage) error {
 		Data:      answerBytes,
 	}
 	
-	// Send the answer via the room
-	pm.room.SendSignal(answerSignal)
+	// Send the answer back to the remote side
+	pm.sink.OnOutgoingSignal(answerSignal)
+	
+	// Catch up on track changes that happened during the exchange
+	if peer.renegotiationPending {
+		return pm.handleRenegotiate(signal)
+	}
 	
 	return nil
 }
@@ -279,6 +471,57 @@ func (pm *PeerManager) handleAnswer(signal *SignalMessage) error {
 		return fmt.Errorf("failed to set remote description: %v", err)
 	}
 	
+	// Catch up on track changes that happened during the exchange
+	if peer.renegotiationPending {
+		return pm.handleRenegotiate(signal)
+	}
+	
+	return nil
+}
+
+// handleRenegotiate sends a fresh server-side offer to a peer whose
+// outgoing tracks changed. Must run on the room's signal loop.
+func (pm *PeerManager) handleRenegotiate(signal *SignalMessage) error {
+	// Get the peer
+	peer, err := pm.GetPeer(signal.ToPeer)
+	if err != nil {
+		return err
+	}
+	
+	// Wait for the current offer/answer exchange to finish
+	if peer.Connection.SignalingState() != webrtc.SignalingStateStable {
+		peer.renegotiationPending = true
+		return nil
+	}
+	peer.renegotiationPending = false
+	
+	// Create an offer
+	offer, err := peer.Connection.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %v", err)
+	}
+	
+	// Set the local description
+	if err := peer.Connection.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %v", err)
+	}
+	
+	// Send the offer to the client owning this peer
+	offerBytes, err := json.Marshal(offer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal offer: %v", err)
+	}
+	
+	offerSignal := &SignalMessage{
+		Type:      "offer",
+		FromPeer:  peer.ID,
+		ToPeer:    peer.ID,
+		SessionID: signal.SessionID,
+		Data:      offerBytes,
+	}
+	
+	pm.sink.OnOutgoingSignal(offerSignal)
+	
 	return nil
 }
 
@@ -304,6 +547,23 @@ func (pm *PeerManager) handleICECandidate(signal *SignalMessage) error {
 	return nil
 }
 
+// newICECandidateSignal wraps a locally gathered ICE candidate in a signaling
+// message addressed to the client owning the peer
+func newICECandidateSignal(peerID, sessionID string, candidate *webrtc.ICECandidate) (*SignalMessage, error) {
+	candidateJSON, err := json.Marshal(candidate.ToJSON())
+	if err != nil {
+		return nil, err
+	}
+	
+	return &SignalMessage{
+		Type:      "ice-candidate",
+		FromPeer:  peerID,
+		ToPeer:    peerID,
+		SessionID: sessionID,
+		Data:      candidateJSON,
+	}, nil
+}
+
 // setupPeerConnectionHandlers sets up event handlers for a peer connection
 func (pm *PeerManager) setupPeerConnectionHandlers(peer *Peer) {
 	// Handle ICE connection state changes
@@ -312,11 +572,11 @@ func (pm *PeerManager) setupPeerConnectionHandlers(peer *Peer) {
 		
 		switch state {
 		case webrtc.ICEConnectionStateConnected:
-			peer.Connected = true
-			pm.room.OnPeerConnected(peer.ID)
+			peer.setConnected(true)
+			pm.sink.OnPeerConnected(peer.ID)
 		case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
-			peer.Connected = false
-			pm.room.OnPeerDisconnected(peer.ID)
+			peer.setConnected(false)
+			pm.sink.OnPeerDisconnected(peer.ID)
 		}
 	})
 	
@@ -326,23 +586,15 @@ func (pm *PeerManager) setupPeerConnectionHandlers(peer *Peer) {
 			return
 		}
 		
-		// Convert the candidate to JSON
-		candidateJSON, err := json.Marshal(candidate.ToJSON())
+		// Create a signaling message addressed to the client owning this peer
+		signal, err := newICECandidateSignal(peer.ID, pm.sessionID, candidate)
 		if err != nil {
 			log.Printf("Failed to marshal ICE candidate: %v", err)
 			return
 		}
 		
-		// Create a signaling message
-		signal := &SignalMessage{
-			Type:      "ice-candidate",
-			FromPeer:  peer.ID,
-			SessionID: pm.room.ID,
-			Data:      candidateJSON,
-		}
-		
-		// Send the ICE candidate to all other peers in the room
-		pm.room.SendSignal(signal)
+		// Send the ICE candidate back to the remote side
+		pm.sink.OnOutgoingSignal(signal)
 	})
 	
 	// Handle new tracks
@@ -350,17 +602,17 @@ func (pm *PeerManager) setupPeerConnectionHandlers(peer *Peer) {
 		log.Printf("Received track %s from peer %s", track.ID(), peer.ID)
 		
 		// Store the track
-		peer.RemoteTracks[track.ID()] = track
+		peer.addRemoteTrack(track)
 		
-		// Forward the track to other peers
-		pm.room.OnNewTrack(peer.ID, track)
+		// Let the session decide what to do with the media
+		pm.sink.OnNewTrack(peer.ID, track)
 	})
 	
 	// Handle data channel creation
 	peer.Connection.OnDataChannel(func(dataChannel *webrtc.DataChannel) {
 		log.Printf("New data channel %s created for peer %s", dataChannel.Label(), peer.ID)
 		
-		peer.DataChannel = dataChannel
+		peer.setDataChannel(dataChannel)
 		
 		// Set up data channel handlers
 		dataChannel.OnOpen(func() {
@@ -369,18 +621,27 @@ func (pm *PeerManager) setupPeerConnectionHandlers(peer *Peer) {
 		
 		dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
 			// Process data channel message
-			pm.room.OnDataChannelMessage(peer.ID, msg.Data)
+			pm.sink.OnDataChannelMessage(peer.ID, msg.Data)
 		})
 	})
 }
 
-// AddTrack adds a media track to a peer
+// AddTrack adds a media track to a peer. Adding a track the peer is already
+// sent does nothing.
 func (pm *PeerManager) AddTrack(peerID string, track *webrtc.TrackLocalStaticRTP) error {
 	peer, err := pm.GetPeer(peerID)
 	if err != nil {
 		return err
 	}
 	
+	peer.tracksMutex.Lock()
+	defer peer.tracksMutex.Unlock()
+	
+	key := trackKey(track)
+	if _, sending := peer.LocalTracks[key]; sending {
+		return nil
+	}
+	
 	// Add the track to the peer connection
 	sender, err := peer.Connection.AddTrack(track)
 	if err != nil {
@@ -388,27 +649,89 @@ func (pm *PeerManager) AddTrack(peerID string, track *webrtc.TrackLocalStaticRTP
 	}
 	
 	// Store the track
-	peer.LocalTracks[track.ID()] = track
+	peer.LocalTracks[key] = track
 	
-	// Handle RTP feedback
+	// Drain RTCP feedback so interceptors (NACK, reports) keep working.
+	// Keyframes are requested from the publisher by the room's forwarder.
 	go func() {
+		rtcpBuf := make([]byte, 1500)
 		for {
-			// Read RTCP packets
-			rtcpPackets, err := sender.ReadRTCP()
-			if err != nil {
+			if _, _, err := sender.Read(rtcpBuf); err != nil {
 				return
 			}
-			
-			// Process RTCP packets if needed
-			for _, packet := range rtcpPackets {
-				log.Printf("Received RTCP packet of type %T from peer %s", packet, peerID)
-			}
 		}
 	}()
 	
 	return nil
 }
 
+// RemoveTrack stops sending a media track to a peer
+func (pm *PeerManager) RemoveTrack(peerID string, track *webrtc.TrackLocalStaticRTP) error {
+	peer, err := pm.GetPeer(peerID)
+	if err != nil {
+		return err
+	}
+	
+	peer.tracksMutex.Lock()
+	defer peer.tracksMutex.Unlock()
+	
+	// Find the sender carrying the track
+	for _, sender := range peer.Connection.GetSenders() {
+		if sender.Track() != track {
+			continue
+		}
+		
+		if err := peer.Connection.RemoveTrack(sender); err != nil {
+			return fmt.Errorf("failed to remove track: %v", err)
+		}
+	}
+	
+	delete(peer.LocalTracks, trackKey(track))
+	
+	return nil
+}
+
+// addSourceTrack registers a track published by a peer for forwarding
+func (pm *PeerManager) addSourceTrack(track *webrtc.TrackLocalStaticRTP) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	
+	key := trackKey(track)
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		pm.videoTracks[key] = track
+	} else {
+		pm.audioTracks[key] = track
+	}
+}
+
+// removeSourceTrack unregisters a forwarded track
+func (pm *PeerManager) removeSourceTrack(track *webrtc.TrackLocalStaticRTP) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	
+	key := trackKey(track)
+	delete(pm.videoTracks, key)
+	delete(pm.audioTracks, key)
+}
+
+// GetSourceTracks returns all forwarded tracks not published by the given peer.
+// Forwarded tracks use the publishing peer's ID as their stream ID.
+func (pm *PeerManager) GetSourceTracks(excludePeerID string) []*webrtc.TrackLocalStaticRTP {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	
+	tracks := make([]*webrtc.TrackLocalStaticRTP, 0, len(pm.videoTracks)+len(pm.audioTracks))
+	for _, sources := range []map[string]*webrtc.TrackLocalStaticRTP{pm.videoTracks, pm.audioTracks} {
+		for _, track := range sources {
+			if track.StreamID() != excludePeerID {
+				tracks = append(tracks, track)
+			}
+		}
+	}
+	
+	return tracks
+}
+
 // CreateDataChannel creates a data channel for a peer
 func (pm *PeerManager) CreateDataChannel(peerID, label string) (*webrtc.DataChannel, error) {
 	peer, err := pm.GetPeer(peerID)
@@ -423,7 +746,7 @@ func (pm *PeerManager) CreateDataChannel(peerID, label string) (*webrtc.DataChan
 	}
 	
 	// Store the data channel
-	peer.DataChannel = dataChannel
+	peer.setDataChannel(dataChannel)
 	
 	// Set up data channel handlers
 	dataChannel.OnOpen(func() {
@@ -432,7 +755,7 @@ func (pm *PeerManager) CreateDataChannel(peerID, label string) (*webrtc.DataChan
 	
 	dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
 		// Process data channel message
-		pm.room.OnDataChannelMessage(peerID, msg.Data)
+		pm.sink.OnDataChannelMessage(peerID, msg.Data)
 	})
 	
 	return dataChannel, nil
@@ -446,12 +769,13 @@ func (pm *PeerManager) SendToPeer(peerID string, message []byte) error {
 	}
 	
 	// Check if data channel exists and is open
-	if peer.DataChannel == nil {
+	dataChannel := peer.dataChannel()
+	if dataChannel == nil {
 		return fmt.Errorf("peer %s has no data channel", peerID)
 	}
 	
 	// Send the message
-	if err := peer.DataChannel.Send(message); err != nil {
+	if err := dataChannel.Send(message); err != nil {
 		return fmt.Errorf("failed to send message: %v", err)
 	}
 	
@@ -464,8 +788,26 @@ func (pm *PeerManager) BroadcastToPeers(message []byte) {
 	defer pm.mutex.RUnlock()
 	
 	for _, peer := range pm.peers {
-		if peer.DataChannel != nil {
-			_ = peer.DataChannel.Send(message)
+		if dataChannel := peer.dataChannel(); dataChannel != nil {
+			_ = dataChannel.Send(message)
+		}
+	}
+}
+
+// requestKeyFrames periodically sends a PLI to the publisher of a video track
+func requestKeyFrames(publisher *Peer, track *webrtc.TrackRemote, done chan struct{}) {
+	ticker := time.NewTicker(keyFrameInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			pli := []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}
+			if err := publisher.Connection.WriteRTCP(pli); err != nil {
+				return
+			}
 		}
 	}
 }
\ No newline at end of file
@@ -2,12 +2,16 @@ package webrtc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/pion/webrtc/v3"
+	
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
 )
 
 // RoomConfig contains configuration for a WebRTC room
@@ -18,6 +22,35 @@ type RoomConfig struct {
 	EnableRecording bool          `json:"enable_recording"`
 	IsPrivate       bool          `json:"is_private"`
 	AccessCode      string        `json:"access_code,omitempty"`
+	EnableLobby     bool          `json:"enable_lobby"`
+	Schedule        Schedule      `json:"schedule"`
+}
+
+// Validate reports the first setting a room cannot be created with
+func (c RoomConfig) Validate() error {
+	switch {
+	case c.MaxParticipants < 0:
+		return errors.New("max_participants cannot be negative")
+	case c.Lifetime < 0:
+		return errors.New("lifetime cannot be negative")
+	case c.AccessCode != "" && !c.IsPrivate:
+		return errors.New("access_code needs is_private")
+	case c.Lifetime > 0 && !c.Schedule.EndsAt.IsZero():
+		return errors.New("lifetime and schedule ends_at cannot both be set")
+	}
+	
+	return c.Schedule.Validate()
+}
+
+// ErrPeerPending is returned by AddPeer when the joiner was parked in the lobby
+var ErrPeerPending = errors.New("peer is waiting in the lobby")
+
+// PendingPeer is a joiner waiting in the lobby to be admitted
+type PendingPeer struct {
+	ID          string    `json:"peer_id"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	RequestedAt time.Time `json:"requested_at"`
 }
 
 // Room represents a WebRTC meeting room
@@ -33,6 +66,17 @@ type Room struct {
 	// Peer management
 	PeerManager *PeerManager
 	
+	// Joiners waiting in the lobby, in arrival order
+	Pending []*PendingPeer
+	
+	// Breakout rooms: the parent of a breakout, or the open breakouts of a
+	// parent with each user's assignment (user ID to breakout ID)
+	Parent         *Room
+	Breakouts      []*Room
+	Assignments    map[string]string
+	BreakoutsEndAt time.Time
+	breakoutTimer  *time.Timer
+	
 	// Signal channel for WebRTC signaling
 	SignalChannel chan *SignalMessage
 	
@@ -48,15 +92,21 @@ type Room struct {
 	OnPeerLeaveCallback     func(peerID string)
 	OnPeerConnectedCallback func(peerID string)
 	OnMessageCallback       func(message []byte)
+	OnSignalCallback        func(signal *SignalMessage)
+	OnSignalErrorCallback   func(signal *SignalMessage, err error)
+	OnBreakoutsEndCallback  func()
+	
+	// Permission check for peer actions; everything is allowed when unset
+	AuthorizeCallback func(peerID string, capability chat.Capability) bool
 }
 
 // RoomEvent represents an event in a room
 type RoomEvent struct {
-	Type      string                 `json:"type"`
-	Room      *RoomInfo              `json:"room"`
-	Peer      *PeerInfo              `json:"peer,omitempty"`
-	Timestamp time.Time              `json:"timestamp"`
-	Data      map[string]interface{} `json:"data,omitempty"`
+	Type      string      `json:"type"`
+	Room      *RoomInfo   `json:"room"`
+	Peer      *PeerInfo   `json:"peer,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
 }
 
 // RoomInfo contains information about a room
@@ -73,17 +123,20 @@ func NewRoom(id, name string, config RoomConfig) *Room {
 		Name:          name,
 		CreatedAt:     time.Now(),
 		Config:        config,
-		SignalChannel: make(chan *SignalMessage, 100),
+		SignalChannel: make(chan *SignalMessage, settings.SignalBufferSize),
 		IsActive:      true,
 	}
 	
-	// Set expiration time if lifetime is set
-	if config.Lifetime > 0 {
+	// Scheduled rooms expire at their end, others after their lifetime if set
+	switch {
+	case !config.Schedule.EndsAt.IsZero():
+		room.ExpiresAt = config.Schedule.EndsAt
+	case config.Lifetime > 0:
 		room.ExpiresAt = room.CreatedAt.Add(config.Lifetime)
 	}
 	
 	// Create the peer manager
-	room.PeerManager = NewPeerManager(room)
+	room.PeerManager = NewPeerManager(id, room)
 	
 	// Start the signaling loop
 	go room.signalLoop()
@@ -96,6 +149,11 @@ func (r *Room) signalLoop() {
 	for signal := range r.SignalChannel {
 		if err := r.processSignal(signal); err != nil {
 			log.Printf("Error processing signal: %v", err)
+			
+			// Let the transport report the failure to the sender
+			if r.OnSignalErrorCallback != nil {
+				r.OnSignalErrorCallback(signal, err)
+			}
 		}
 	}
 }
@@ -103,7 +161,10 @@ func (r *Room) signalLoop() {
 // processSignal processes a WebRTC signaling message
 func (r *Room) processSignal(signal *SignalMessage) error {
 	// Check if room is active
-	if !r.IsActive {
+	r.mutex.RLock()
+	active := r.IsActive
+	r.mutex.RUnlock()
+	if !active {
 		return fmt.Errorf("room is no longer active")
 	}
 	
@@ -111,7 +172,8 @@ func (r *Room) processSignal(signal *SignalMessage) error {
 	return r.PeerManager.ProcessSignal(signal)
 }
 
-// AddPeer adds a new peer to the room
+// AddPeer adds a new peer to the room. When the lobby is enabled the joiner
+// is parked in the pending list instead and ErrPeerPending is returned.
 func (r *Room) AddPeer(id, userID, username string) (*Peer, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -121,6 +183,111 @@ func (r *Room) AddPeer(id, userID, username string) (*Peer, error) {
 		return nil, fmt.Errorf("room is no longer active")
 	}
 	
+	// Park the joiner until a moderator admits it
+	if r.Config.EnableLobby {
+		r.park(id, userID, username)
+		return nil, ErrPeerPending
+	}
+	
+	return r.addPeer(id, userID, username)
+}
+
+// ParkPeer puts a joiner in the lobby whether or not the room has one, as
+// for joiners arriving before a scheduled room opens
+func (r *Room) ParkPeer(id, userID, username string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	// Check if room is active
+	if !r.IsActive {
+		return fmt.Errorf("room is no longer active")
+	}
+	
+	r.park(id, userID, username)
+	return nil
+}
+
+// park adds a joiner to the pending list once. The caller holds the lock.
+func (r *Room) park(id, userID, username string) {
+	if r.pendingIndex(id) >= 0 {
+		return
+	}
+	
+	r.Pending = append(r.Pending, &PendingPeer{
+		ID:          id,
+		UserID:      userID,
+		Username:    username,
+		RequestedAt: time.Now(),
+	})
+}
+
+// AdmitPeer lets a joiner waiting in the lobby into the room. The joiner
+// stays pending if the room is full.
+func (r *Room) AdmitPeer(id string) (*Peer, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	// Check if room is active
+	if !r.IsActive {
+		return nil, fmt.Errorf("room is no longer active")
+	}
+	
+	index := r.pendingIndex(id)
+	if index < 0 {
+		return nil, fmt.Errorf("peer %s is not waiting in the lobby", id)
+	}
+	
+	pending := r.Pending[index]
+	peer, err := r.addPeer(pending.ID, pending.UserID, pending.Username)
+	if err != nil {
+		return nil, err
+	}
+	
+	r.Pending = append(r.Pending[:index], r.Pending[index+1:]...)
+	
+	return peer, nil
+}
+
+// DenyPeer removes a joiner from the lobby without admitting it
+func (r *Room) DenyPeer(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	index := r.pendingIndex(id)
+	if index < 0 {
+		return fmt.Errorf("peer %s is not waiting in the lobby", id)
+	}
+	
+	r.Pending = append(r.Pending[:index], r.Pending[index+1:]...)
+	
+	return nil
+}
+
+// GetPendingPeers returns the joiners waiting in the lobby, in arrival order
+func (r *Room) GetPendingPeers() []PendingPeer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	pending := make([]PendingPeer, 0, len(r.Pending))
+	for _, p := range r.Pending {
+		pending = append(pending, *p)
+	}
+	return pending
+}
+
+// pendingIndex returns the lobby position of a joiner, counting from 0, or
+// -1 when it is not waiting. The caller must hold the lock.
+func (r *Room) pendingIndex(id string) int {
+	for i, p := range r.Pending {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// addPeer creates a peer and announces it. The caller must hold the lock.
+func (r *Room) addPeer(id, userID, username string) (*Peer, error) {
 	// Check if room is full
 	peerCount := len(r.PeerManager.GetPeers())
 	if r.Config.MaxParticipants > 0 && peerCount >= r.Config.MaxParticipants {
@@ -192,8 +359,14 @@ func (r *Room) Close() {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	
+	// Closing twice would close the signal channel twice
+	if !r.IsActive {
+		return
+	}
+	
 	// Set room as inactive
 	r.IsActive = false
+	r.Pending = nil
 	
 	// Get all peers
 	peers := r.PeerManager.GetPeers()
@@ -217,8 +390,17 @@ func (r *Room) Close() {
 	r.broadcastEvent(event)
 }
 
-// SendSignal sends a WebRTC signaling message
+// SendSignal queues an incoming WebRTC signaling message for processing
 func (r *Room) SendSignal(signal *SignalMessage) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	// The signal channel is closed once the room is closed
+	if !r.IsActive {
+		log.Printf("Dropping %s signal for closed room %s", signal.Type, r.ID)
+		return
+	}
+	
 	// Send the signal
 	select {
 	case r.SignalChannel <- signal:
@@ -229,6 +411,17 @@ func (r *Room) SendSignal(signal *SignalMessage) {
 	}
 }
 
+// OnOutgoingSignal hands a signaling message produced by the server-side peer
+// connection (answers, offers, ICE candidates) to the signaling transport
+func (r *Room) OnOutgoingSignal(signal *SignalMessage) {
+	if r.OnSignalCallback == nil {
+		log.Printf("No signal callback set for room %s, dropping %s signal", r.ID, signal.Type)
+		return
+	}
+	
+	r.OnSignalCallback(signal)
+}
+
 // OnPeerConnected is called when a peer connects
 func (r *Room) OnPeerConnected(peerID string) {
 	// Call the peer connected callback if set
@@ -243,6 +436,9 @@ func (r *Room) OnPeerConnected(peerID string) {
 		return
 	}
 	
+	// Subscribe the peer to everything already being published in the room
+	r.subscribeToSources(peer)
+	
 	// Create a connected event
 	event := &RoomEvent{
 		Type:      "peer_connected",
@@ -276,11 +472,6 @@ func (r *Room) OnPeerDisconnected(peerID string) {
 	r.broadcastEvent(event)
 }
 
-// OnPeerLeave is called when a peer leaves
-func (r *Room) OnPeerLeave(peerID string) {
-	// Nothing additional to do here since RemovePeer handles this
-}
-
 // OnNewTrack is called when a peer adds a new track
 func (r *Room) OnNewTrack(peerID string, track *webrtc.TrackRemote) {
 	// Get the peer
@@ -290,27 +481,147 @@ func (r *Room) OnNewTrack(peerID string, track *webrtc.TrackRemote) {
 		return
 	}
 	
+	// Only forward media the peer's role is allowed to publish
+	capability := chat.CapPublishAudio
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		capability = chat.CapPublishVideo
+	}
+	if !r.authorize(peerID, capability) {
+		log.Printf("Ignoring %s track from peer %s: not allowed to publish", track.Kind().String(), peerID)
+		return
+	}
+	
+	// Create a local track to fan the publisher's media out to everyone else.
+	// The publisher's peer ID is used as the stream ID so clients can group tracks.
+	localTrack, err := webrtc.NewTrackLocalStaticRTP(track.Codec().RTPCodecCapability, track.ID(), peerID)
+	if err != nil {
+		log.Printf("Failed to create local track for %s from peer %s: %v", track.ID(), peerID, err)
+		return
+	}
+	r.PeerManager.addSourceTrack(localTrack)
+	
+	// Start pumping RTP from the publisher into the local track
+	done := make(chan struct{})
+	go r.forwardTrack(sourcePeer, track, localTrack, done)
+	
+	// Ask the publisher for keyframes so subscribers can start decoding quickly
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		go requestKeyFrames(sourcePeer, track, done)
+	}
+	
+	// Add the track to every other connected peer and renegotiate
+	for _, peer := range r.PeerManager.GetPeers() {
+		if peer.ID == peerID || !peer.IsConnected() {
+			continue
+		}
+		
+		if err := r.PeerManager.AddTrack(peer.ID, localTrack); err != nil {
+			log.Printf("Failed to forward track %s to peer %s: %v", track.ID(), peer.ID, err)
+			continue
+		}
+		
+		r.renegotiate(peer.ID)
+	}
+	
 	// Create an event for the new track
 	event := &RoomEvent{
 		Type:      "new_track",
 		Room:      &RoomInfo{ID: r.ID, Name: r.Name, CreatedAt: r.CreatedAt},
 		Peer:      &PeerInfo{ID: peerID, UserID: sourcePeer.UserID, Username: sourcePeer.Username},
 		Timestamp: time.Now(),
-		Data: map[string]interface{}{
-			"track_id":   track.ID(),
-			"track_kind": track.Kind().String(),
+		Data: NewTrackData{
+			TrackID:   track.ID(),
+			TrackKind: track.Kind().String(),
+			StreamID:  peerID,
 		},
 	}
 	
 	// Broadcast the event
 	r.broadcastEvent(event)
 	
-	// Forward the track to other peers
-	// This would typically involve reading RTP packets from the track
-	// and writing them to a local track that other peers can subscribe to
-	// For brevity, this implementation is simplified
+	log.Printf("Forwarding track %s of kind %s from peer %s", track.ID(), track.Kind().String(), peerID)
+}
+
+// forwardTrack copies RTP packets from a publisher's remote track into the
+// local track shared with subscribers until the publisher goes away. Packets
+// are dropped while the publisher's media of that kind is disabled.
+func (r *Room) forwardTrack(publisher *Peer, remote *webrtc.TrackRemote, local *webrtc.TrackLocalStaticRTP, done chan struct{}) {
+	defer func() {
+		close(done)
+		r.stopForwarding(publisher.ID, local)
+	}()
+	
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := remote.Read(buf)
+		if err != nil {
+			return
+		}
+		
+		if !publisher.forwards(remote) {
+			continue
+		}
+		
+		// ErrClosedPipe only means nobody is subscribed yet
+		if _, err := local.Write(buf[:n]); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			log.Printf("Failed to forward RTP for track %s from peer %s: %v", local.ID(), publisher.ID, err)
+			return
+		}
+	}
+}
+
+// stopForwarding removes a finished track from all subscribers
+func (r *Room) stopForwarding(peerID string, local *webrtc.TrackLocalStaticRTP) {
+	r.PeerManager.removeSourceTrack(local)
+	
+	for _, peer := range r.PeerManager.GetPeers() {
+		if peer.ID == peerID {
+			continue
+		}
+		
+		if !peer.sends(local) {
+			continue
+		}
+		
+		if err := r.PeerManager.RemoveTrack(peer.ID, local); err != nil {
+			log.Printf("Failed to remove track %s from peer %s: %v", local.ID(), peer.ID, err)
+			continue
+		}
+		
+		r.renegotiate(peer.ID)
+	}
+	
+	log.Printf("Stopped forwarding track %s from peer %s", local.ID(), peerID)
+}
+
+// subscribeToSources adds all tracks published by other peers to a peer
+func (r *Room) subscribeToSources(peer *Peer) {
+	added := false
+	for _, track := range r.PeerManager.GetSourceTracks(peer.ID) {
+		if peer.sends(track) {
+			continue
+		}
+		
+		if err := r.PeerManager.AddTrack(peer.ID, track); err != nil {
+			log.Printf("Failed to forward track %s to peer %s: %v", track.ID(), peer.ID, err)
+			continue
+		}
+		added = true
+	}
 	
-	log.Printf("New track %s of kind %s from peer %s", track.ID(), track.Kind().String(), peerID)
+	if added {
+		r.renegotiate(peer.ID)
+	}
+}
+
+// renegotiate queues a server-side offer for a peer on the signal loop
+func (r *Room) renegotiate(peerID string) {
+	r.SendSignal(&SignalMessage{
+		Type:      "renegotiate",
+		FromPeer:  peerID,
+		ToPeer:    peerID,
+		SessionID: r.ID,
+	})
 }
 
 // OnDataChannelMessage is called when a message is received on a data channel
@@ -328,7 +639,7 @@ func (r *Room) OnDataChannelMessage(peerID string, data []byte) {
 	}
 	
 	// Try to parse the message as JSON
-	var message map[string]interface{}
+	var message DataChannelMessage
 	if err := json.Unmarshal(data, &message); err != nil {
 		// Not JSON, treat as raw data
 		log.Printf("Received raw data from peer %s: %d bytes", peerID, len(data))
@@ -336,16 +647,21 @@ func (r *Room) OnDataChannelMessage(peerID string, data []byte) {
 	}
 	
 	// Check message type
-	if msgType, ok := message["type"].(string); ok {
+	if msgType := message.Type; msgType != "" {
 		switch msgType {
 		case "chat":
+			if !r.authorize(peerID, chat.CapSendChat) || !r.GetConfig().EnableChat {
+				log.Printf("Dropping chat message from peer %s: chat not allowed", peerID)
+				return
+			}
+			
 			// Handle chat message
 			chatEvent := &RoomEvent{
 				Type:      "chat_message",
 				Room:      &RoomInfo{ID: r.ID, Name: r.Name, CreatedAt: r.CreatedAt},
 				Peer:      &PeerInfo{ID: peerID, UserID: peer.UserID, Username: peer.Username},
 				Timestamp: time.Now(),
-				Data:      message,
+				Data:      ChatMessageData{Message: message.Message},
 			}
 			r.broadcastEvent(chatEvent)
 		case "status":
@@ -355,7 +671,7 @@ func (r *Room) OnDataChannelMessage(peerID string, data []byte) {
 				Room:      &RoomInfo{ID: r.ID, Name: r.Name, CreatedAt: r.CreatedAt},
 				Peer:      &PeerInfo{ID: peerID, UserID: peer.UserID, Username: peer.Username},
 				Timestamp: time.Now(),
-				Data:      message,
+				Data:      PeerStatusData{Status: message.Status},
 			}
 			r.broadcastEvent(statusEvent)
 		default:
@@ -365,6 +681,18 @@ func (r *Room) OnDataChannelMessage(peerID string, data []byte) {
 	}
 }
 
+// Announce broadcasts a custom event to all peers over their data channels
+func (r *Room) Announce(eventType string, data interface{}) {
+	event := &RoomEvent{
+		Type:      eventType,
+		Room:      &RoomInfo{ID: r.ID, Name: r.Name, CreatedAt: r.CreatedAt},
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+	
+	r.broadcastEvent(event)
+}
+
 // broadcastEvent broadcasts an event to all peers
 func (r *Room) broadcastEvent(event *RoomEvent) {
 	// Convert event to JSON
@@ -378,6 +706,42 @@ func (r *Room) broadcastEvent(event *RoomEvent) {
 	r.PeerManager.BroadcastToPeers(eventBytes)
 }
 
+// SetPeerMedia turns forwarding of one kind of a peer's media on or off
+func (r *Room) SetPeerMedia(peerID string, kind MediaKind, enabled bool) error {
+	peer, err := r.PeerManager.GetPeer(peerID)
+	if err != nil {
+		return err
+	}
+	
+	peer.SetMediaEnabled(kind, enabled)
+	
+	return nil
+}
+
+// authorize reports whether a peer may use a capability
+func (r *Room) authorize(peerID string, capability chat.Capability) bool {
+	if r.AuthorizeCallback == nil {
+		return true
+	}
+	return r.AuthorizeCallback(peerID, capability)
+}
+
+// GetConfig returns a copy of the room configuration
+func (r *Room) GetConfig() RoomConfig {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return r.Config
+}
+
+// UpdateConfig changes the room configuration under the room lock
+func (r *Room) UpdateConfig(update func(config *RoomConfig)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	
+	update(&r.Config)
+}
+
 // GetPeers returns all peers in the room
 func (r *Room) GetPeers() []*Peer {
 	return r.PeerManager.GetPeers()
@@ -391,8 +755,11 @@ func (r *Room) GetPeerCount() int {
 
 // IsExpired checks if the room has expired
 func (r *Room) IsExpired() bool {
-	// Room never expires if lifetime is 0
-	if r.Config.Lifetime == 0 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	// Room never expires without a lifetime or scheduled end
+	if r.ExpiresAt.IsZero() {
 		return false
 	}
 	
@@ -400,6 +767,15 @@ func (r *Room) IsExpired() bool {
 	return time.Now().After(r.ExpiresAt)
 }
 
+// GetExpiresAt returns when the room expires, or the zero time when it has
+// no lifetime or scheduled end
+func (r *Room) GetExpiresAt() time.Time {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	
+	return r.ExpiresAt
+}
+
 // SetOnPeerJoinCallback sets the callback for peer join events
 func (r *Room) SetOnPeerJoinCallback(callback func(peerID string)) {
 	r.OnPeerJoinCallback = callback
@@ -418,4 +794,19 @@ func (r *Room) SetOnPeerConnectedCallback(callback func(peerID string)) {
 // SetOnMessageCallback sets the callback for message events
 func (r *Room) SetOnMessageCallback(callback func(message []byte)) {
 	r.OnMessageCallback = callback
-}
\ No newline at end of file
+}
+
+// SetOnSignalCallback sets the callback for outgoing signaling messages
+func (r *Room) SetOnSignalCallback(callback func(signal *SignalMessage)) {
+	r.OnSignalCallback = callback
+}
+
+// SetOnSignalErrorCallback sets the callback for signals that failed to process
+func (r *Room) SetOnSignalErrorCallback(callback func(signal *SignalMessage, err error)) {
+	r.OnSignalErrorCallback = callback
+}
+
+// SetAuthorizeCallback sets the permission check for peer actions
+func (r *Room) SetAuthorizeCallback(callback func(peerID string, capability chat.Capability) bool) {
+	r.AuthorizeCallback = callback
+}
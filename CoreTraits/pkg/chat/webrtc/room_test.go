@@ -0,0 +1,209 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// testClient is a browser stand-in: a peer connection whose signals go to
+// and come from the server-side peer with the same ID
+type testClient struct {
+	t       *testing.T
+	id      string
+	pc      *webrtc.PeerConnection
+	send    func(*SignalMessage)
+	signals chan *SignalMessage
+}
+
+// newTestClient creates a client that sends its signals with send
+func newTestClient(t *testing.T, id string, send func(*SignalMessage)) *testClient {
+	t.Helper()
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	client := &testClient{t: t, id: id, pc: pc, send: send, signals: make(chan *SignalMessage, 100)}
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			client.signal("ice-candidate", candidate.ToJSON())
+		}
+	})
+
+	// Handle the server's signals in order, off the server's goroutines
+	go func() {
+		for signal := range client.signals {
+			client.handle(signal)
+		}
+	}()
+	t.Cleanup(func() { close(client.signals) })
+
+	return client
+}
+
+// signal sends a signal from the client to its server-side peer
+func (c *testClient) signal(signalType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.t.Error(err)
+		return
+	}
+	c.send(&SignalMessage{Type: signalType, FromPeer: c.id, ToPeer: c.id, Data: payload})
+}
+
+// offer starts negotiation from the client
+func (c *testClient) offer() {
+	offer, err := c.pc.CreateOffer(nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.pc.SetLocalDescription(offer); err != nil {
+		c.t.Fatal(err)
+	}
+	c.signal("offer", offer)
+}
+
+// handle applies a signal from the server
+func (c *testClient) handle(signal *SignalMessage) {
+	switch signal.Type {
+	case "offer", "answer":
+		var description webrtc.SessionDescription
+		if err := json.Unmarshal(signal.Data, &description); err != nil {
+			c.t.Error(err)
+			return
+		}
+		if err := c.pc.SetRemoteDescription(description); err != nil {
+			c.t.Errorf("client %s: %v", c.id, err)
+			return
+		}
+		if signal.Type == "answer" {
+			return
+		}
+
+		answer, err := c.pc.CreateAnswer(nil)
+		if err != nil {
+			c.t.Error(err)
+			return
+		}
+		if err := c.pc.SetLocalDescription(answer); err != nil {
+			c.t.Error(err)
+			return
+		}
+		c.signal("answer", answer)
+	case "ice-candidate":
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(signal.Data, &candidate); err == nil {
+			c.pc.AddICECandidate(candidate)
+		}
+	}
+}
+
+// publishAudio adds an Opus track to the client and writes packets to it
+// until the test ends
+func (c *testClient) publishAudio() {
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", c.id)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.pc.AddTrack(track); err != nil {
+		c.t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	c.t.Cleanup(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for seq := uint16(0); ; seq++ {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				track.WriteRTP(&rtp.Packet{
+					Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960},
+					Payload: []byte{0xfc, 0xff, 0xfe},
+				})
+			}
+		}
+	}()
+}
+
+// waitFor fails the test unless the channel delivers within the timeout
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+func TestRoomForwardsPublishedTrack(t *testing.T) {
+	room := NewRoom("room", "Room", RoomConfig{})
+	t.Cleanup(room.Close)
+
+	clients := make(map[string]*testClient)
+	room.SetOnSignalCallback(func(signal *SignalMessage) {
+		clients[signal.ToPeer].signals <- signal
+	})
+
+	connected := make(chan string, 2)
+	room.OnPeerConnectedCallback = func(peerID string) { connected <- peerID }
+
+	for _, id := range []string{"publisher", "subscriber"} {
+		if _, err := room.AddPeer(id, id+"-user", id); err != nil {
+			t.Fatal(err)
+		}
+		clients[id] = newTestClient(t, id, room.SendSignal)
+	}
+
+	// The subscriber connects first with only a data channel
+	subscriber := clients["subscriber"]
+	received := make(chan *webrtc.TrackRemote, 1)
+	subscriber.pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		received <- track
+	})
+	if _, err := subscriber.pc.CreateDataChannel("events", nil); err != nil {
+		t.Fatal(err)
+	}
+	subscriber.offer()
+	if id := waitFor(t, connected, "the subscriber to connect"); id != "subscriber" {
+		t.Fatalf("connected %s, want subscriber", id)
+	}
+
+	publisher := clients["publisher"]
+	publisher.publishAudio()
+	publisher.offer()
+
+	track := waitFor(t, received, "the forwarded track")
+	if track.StreamID() != "publisher" || track.Kind() != webrtc.RTPCodecTypeAudio {
+		t.Errorf("forwarded track = %s/%s %s, want publisher/audio", track.StreamID(), track.ID(), track.Kind())
+	}
+
+	packets := make(chan *rtp.Packet, 1)
+	go func() {
+		if packet, _, err := track.ReadRTP(); err == nil {
+			packets <- packet
+		}
+	}()
+	if packet := waitFor(t, packets, "a forwarded packet"); len(packet.Payload) != 3 {
+		t.Errorf("forwarded payload = %x, want the published one", packet.Payload)
+	}
+
+	peer, err := room.PeerManager.GetPeer("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer.IsConnected() {
+		t.Error("publisher is not marked connected")
+	}
+}
@@ -0,0 +1,58 @@
+package webrtc
+
+import (
+	"errors"
+	"time"
+)
+
+// Policies for joiners who arrive before a scheduled session opens
+const (
+	EarlyJoinReject = "reject"
+	EarlyJoinLobby  = "lobby"
+)
+
+// Schedule is when a scheduled room or stream runs. It opens for joins
+// JoinWindow before StartsAt and, when EndsAt is set, is closed then.
+// EarlyJoin says whether joiners arriving before it opens are turned away
+// or wait in a lobby; they are turned away unless it is EarlyJoinLobby.
+// Sessions without a start time are not scheduled.
+type Schedule struct {
+	StartsAt   time.Time     `json:"starts_at"`
+	EndsAt     time.Time     `json:"ends_at"`
+	JoinWindow time.Duration `json:"join_window"`
+	EarlyJoin  string        `json:"early_join"`
+}
+
+// IsScheduled reports whether the schedule has a start time
+func (s Schedule) IsScheduled() bool {
+	return !s.StartsAt.IsZero()
+}
+
+// OpensAt returns when joins open, or the zero time when not scheduled
+func (s Schedule) OpensAt() time.Time {
+	if !s.IsScheduled() {
+		return time.Time{}
+	}
+	return s.StartsAt.Add(-s.JoinWindow)
+}
+
+// IsEarly reports whether joins are not open yet at the given time
+func (s Schedule) IsEarly(now time.Time) bool {
+	return s.IsScheduled() && now.Before(s.OpensAt())
+}
+
+// Validate reports the first setting a session cannot be scheduled with
+func (s Schedule) Validate() error {
+	switch {
+	case !s.IsScheduled() && (!s.EndsAt.IsZero() || s.JoinWindow != 0 || s.EarlyJoin != ""):
+		return errors.New("schedule needs starts_at")
+	case !s.EndsAt.IsZero() && !s.EndsAt.After(s.StartsAt):
+		return errors.New("schedule ends_at must be after starts_at")
+	case s.JoinWindow < 0:
+		return errors.New("schedule join_window cannot be negative")
+	case s.EarlyJoin != "" && s.EarlyJoin != EarlyJoinReject && s.EarlyJoin != EarlyJoinLobby:
+		return errors.New("schedule early_join must be reject or lobby")
+	}
+	
+	return nil
+}
@@ -2,8 +2,11 @@ package webrtc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +23,7 @@ type StreamConfig struct {
 	AccessCode      string        `json:"access_code,omitempty"`
 	VideoCodec      string        `json:"video_codec"`
 	AudioCodec      string        `json:"audio_codec"`
+	Schedule        Schedule      `json:"schedule"`
 }
 
 // Stream represents a WebRTC broadcast stream
@@ -56,10 +60,15 @@ type Stream struct {
 	// Stats
 	Stats StreamStats
 	
+	// Bytes ingested since the current bandwidth window started
+	bandwidthBytes       int64
+	bandwidthWindowStart time.Time
+	
 	// Callbacks
 	OnViewerJoinCallback  func(viewerID string)
 	OnViewerLeaveCallback func(viewerID string)
 	OnChatMessageCallback func(viewerID, message string)
+	OnSignalCallback      func(signal *SignalMessage)
 }
 
 // StreamStats tracks stream statistics
@@ -72,13 +81,22 @@ type StreamStats struct {
 	TotalBytesStreamed int64     `json:"total_bytes_streamed"`
 }
 
+const (
+	// Window over which StreamStats.CurrentBandwidth is measured
+	bandwidthWindow = time.Second
+
+	// Codecs used when the stream config does not name one
+	defaultVideoCodec = "VP8"
+	defaultAudioCodec = "opus"
+)
+
 // StreamEvent represents an event in a stream
 type StreamEvent struct {
-	Type      string                 `json:"type"`
-	Stream    *StreamInfo            `json:"stream"`
-	Viewer    *PeerInfo              `json:"viewer,omitempty"`
-	Timestamp time.Time              `json:"timestamp"`
-	Data      map[string]interface{} `json:"data,omitempty"`
+	Type      string      `json:"type"`
+	Stream    *StreamInfo `json:"stream"`
+	Viewer    *PeerInfo   `json:"viewer,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
 }
 
 // StreamInfo contains information about a stream
@@ -100,7 +118,7 @@ func NewStream(id, userID, username, title string, config StreamConfig) *Stream
 		CreatedAt:     time.Now(),
 		Config:        config,
 		Viewers:       make(map[string]*Peer),
-		SignalChannel: make(chan *SignalMessage, 100),
+		SignalChannel: make(chan *SignalMessage, settings.SignalBufferSize),
 		IsActive:      true,
 		Stats: StreamStats{
 			PeakViewers:       0,
@@ -112,13 +130,24 @@ func NewStream(id, userID, username, title string, config StreamConfig) *Stream
 		},
 	}
 	
-	// Set expiration time if lifetime is set
-	if config.Lifetime > 0 {
+	// Scheduled streams expire at their end, others after their lifetime if set
+	switch {
+	case !config.Schedule.EndsAt.IsZero():
+		stream.ExpiresAt = config.Schedule.EndsAt
+	case config.Lifetime > 0:
 		stream.ExpiresAt = stream.CreatedAt.Add(config.Lifetime)
 	}
 	
+	// Fall back to codecs every browser can publish
+	if stream.Config.VideoCodec == "" {
+		stream.Config.VideoCodec = defaultVideoCodec
+	}
+	if stream.Config.AudioCodec == "" {
+		stream.Config.AudioCodec = defaultAudioCodec
+	}
+	
 	// Create the peer manager
-	stream.PeerManager = NewPeerManager(nil) // Stream doesn't use the room interface
+	stream.PeerManager = NewPeerManager(id, stream)
 	
 	// Start the signaling loop
 	go stream.signalLoop()
@@ -137,16 +166,24 @@ func (s *Stream) signalLoop() {
 
 // processSignal processes a WebRTC signaling message
 func (s *Stream) processSignal(signal *SignalMessage) error {
+	s.mutex.RLock()
+	active := s.IsActive
+	broadcaster := s.Broadcaster
+	s.mutex.RUnlock()
+	
 	// Check if stream is active
-	if !s.IsActive {
+	if !active {
 		return fmt.Errorf("stream is no longer active")
 	}
 	
 	// Handle the signal based on its type
 	switch signal.Type {
 	case "offer":
-		// Only the broadcaster should send offers
-		if signal.FromPeer == s.Broadcaster.ID {
+		if broadcaster != nil && signal.FromPeer == broadcaster.ID {
+			if signal.ToPeer == "" || signal.ToPeer == broadcaster.ID {
+				// Broadcaster publishing its media to the server
+				return s.handleBroadcasterOffer(broadcaster, signal)
+			}
 			// Forward the offer to the specified viewer
 			return s.forwardOfferToViewer(signal)
 		} else {
@@ -164,11 +201,17 @@ func (s *Stream) processSignal(signal *SignalMessage) error {
 	}
 }
 
-// SetBroadcaster sets the broadcaster peer
+// SetBroadcaster sets the broadcaster peer. A broadcaster that reconnects
+// after RemoveBroadcaster feeds the same tracks, so viewers keep playing.
 func (s *Stream) SetBroadcaster(peerID, userID, username string) (*Peer, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	
+	// Check if stream is active
+	if !s.IsActive {
+		return nil, fmt.Errorf("stream is no longer active")
+	}
+	
 	// Check if broadcaster already set
 	if s.Broadcaster != nil {
 		return nil, fmt.Errorf("broadcaster already set")
@@ -181,27 +224,29 @@ func (s *Stream) SetBroadcaster(peerID, userID, username string) (*Peer, error)
 	}
 	
 	// Set up media tracks
-	videoTrack, err := webrtc.NewTrackLocalStaticRTP(
-		webrtc.RTPCodecCapability{MimeType: "video/" + s.Config.VideoCodec},
-		"video", "video",
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create video track: %v", err)
-	}
-	
-	audioTrack, err := webrtc.NewTrackLocalStaticRTP(
-		webrtc.RTPCodecCapability{MimeType: "audio/" + s.Config.AudioCodec},
-		"audio", "audio",
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create audio track: %v", err)
+	if s.VideoTrack == nil {
+		videoTrack, err := webrtc.NewTrackLocalStaticRTP(
+			webrtc.RTPCodecCapability{MimeType: "video/" + s.Config.VideoCodec},
+			"video", "video",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create video track: %v", err)
+		}
+		
+		audioTrack, err := webrtc.NewTrackLocalStaticRTP(
+			webrtc.RTPCodecCapability{MimeType: "audio/" + s.Config.AudioCodec},
+			"audio", "audio",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audio track: %v", err)
+		}
+		
+		// Store the tracks
+		s.VideoTrack = videoTrack
+		s.AudioTrack = audioTrack
 	}
-	
-	// Store the tracks
-	s.VideoTrack = videoTrack
-	s.AudioTrack = audioTrack
-	peer.LocalTracks["video"] = videoTrack
-	peer.LocalTracks["audio"] = audioTrack
+	peer.LocalTracks[trackKey(s.VideoTrack)] = s.VideoTrack
+	peer.LocalTracks[trackKey(s.AudioTrack)] = s.AudioTrack
 	
 	// Set as broadcaster
 	s.Broadcaster = peer
@@ -219,6 +264,22 @@ func (s *Stream) SetBroadcaster(peerID, userID, username string) (*Peer, error)
 	return peer, nil
 }
 
+// RemoveBroadcaster closes the broadcaster's peer connection so another
+// can be set. The stream's tracks stay attached to its viewers.
+func (s *Stream) RemoveBroadcaster() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	if s.Broadcaster == nil {
+		return
+	}
+	
+	if err := s.PeerManager.RemovePeer(s.Broadcaster.ID); err != nil {
+		log.Printf("Error closing broadcaster connection: %v", err)
+	}
+	s.Broadcaster = nil
+}
+
 // AddViewer adds a new viewer to the stream
 func (s *Stream) AddViewer(viewerID, userID, username string) (*Peer, error) {
 	s.mutex.Lock()
@@ -279,8 +340,8 @@ func (s *Stream) RemoveViewer(viewerID string) error {
 		return fmt.Errorf("viewer %s not found", viewerID)
 	}
 	
-	// Close the peer connection
-	if err := viewer.Connection.Close(); err != nil {
+	// Close the peer connection and stop sending it events
+	if err := s.PeerManager.RemovePeer(viewerID); err != nil {
 		log.Printf("Error closing viewer connection: %v", err)
 	}
 	
@@ -311,6 +372,11 @@ func (s *Stream) Close() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	
+	// Closing twice would close the signal channel twice
+	if !s.IsActive {
+		return
+	}
+	
 	// Set stream as inactive
 	s.IsActive = false
 	
@@ -335,11 +401,11 @@ func (s *Stream) Close() {
 		Type:      "stream_end",
 		Stream:    &StreamInfo{ID: s.ID, UserID: s.UserID, Username: s.Username, Title: s.Title, CreatedAt: s.CreatedAt},
 		Timestamp: time.Now(),
-		Data: map[string]interface{}{
-			"duration":        s.Stats.StreamDuration,
-			"peak_viewers":    s.Stats.PeakViewers,
-			"total_viewers":   s.Stats.TotalViewers,
-			"bytes_streamed": s.Stats.TotalBytesStreamed,
+		Data: StreamEndData{
+			Duration:      s.Stats.StreamDuration,
+			PeakViewers:   s.Stats.PeakViewers,
+			TotalViewers:  s.Stats.TotalViewers,
+			BytesStreamed: s.Stats.TotalBytesStreamed,
 		},
 	}
 	
@@ -347,8 +413,17 @@ func (s *Stream) Close() {
 	s.broadcastEvent(event)
 }
 
-// SendSignal sends a WebRTC signaling message
+// SendSignal queues an incoming WebRTC signaling message for processing
 func (s *Stream) SendSignal(signal *SignalMessage) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	
+	// The signal channel is closed once the stream is closed
+	if !s.IsActive {
+		log.Printf("Dropping %s signal for closed stream %s", signal.Type, s.ID)
+		return
+	}
+	
 	// Send the signal
 	select {
 	case s.SignalChannel <- signal:
@@ -359,6 +434,199 @@ func (s *Stream) SendSignal(signal *SignalMessage) {
 	}
 }
 
+// OnOutgoingSignal hands a signaling message produced by a server-side peer
+// connection (answers, ICE candidates) to the signaling transport
+func (s *Stream) OnOutgoingSignal(signal *SignalMessage) {
+	if s.OnSignalCallback == nil {
+		log.Printf("No signal callback set for stream %s, dropping %s signal", s.ID, signal.Type)
+		return
+	}
+	
+	s.OnSignalCallback(signal)
+}
+
+// OnPeerConnected is called when the broadcaster or a viewer connects
+func (s *Stream) OnPeerConnected(peerID string) {
+	s.broadcastPeerEvent("peer_connected", peerID)
+}
+
+// OnPeerDisconnected is called when the broadcaster or a viewer disconnects
+func (s *Stream) OnPeerDisconnected(peerID string) {
+	s.broadcastPeerEvent("peer_disconnected", peerID)
+}
+
+// OnNewTrack is called when a stream peer starts sending media.
+// Only the broadcaster's tracks are ingested; viewers are receive-only.
+func (s *Stream) OnNewTrack(peerID string, track *webrtc.TrackRemote) {
+	s.mutex.RLock()
+	broadcaster := s.Broadcaster
+	s.mutex.RUnlock()
+	
+	if broadcaster == nil || broadcaster.ID != peerID {
+		log.Printf("Ignoring %s track %s from viewer %s on stream %s", track.Kind(), track.ID(), peerID, s.ID)
+		return
+	}
+	
+	s.ingestTrack(broadcaster, track)
+}
+
+// OnDataChannelMessage is called when a stream peer sends a data channel message
+func (s *Stream) OnDataChannelMessage(peerID string, data []byte) {
+	var message DataChannelMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		log.Printf("Received raw data from peer %s: %d bytes", peerID, len(data))
+		return
+	}
+	
+	switch message.Type {
+	case "chat":
+		s.ProcessChatMessage(peerID, message.Message)
+	default:
+		log.Printf("Received unknown message type from peer %s: %s", peerID, message.Type)
+	}
+}
+
+// broadcastPeerEvent broadcasts a connection state event for a stream peer
+func (s *Stream) broadcastPeerEvent(eventType, peerID string) {
+	peer, err := s.PeerManager.GetPeer(peerID)
+	if err != nil {
+		log.Printf("Error getting peer %s: %v", peerID, err)
+		return
+	}
+	
+	event := &StreamEvent{
+		Type:      eventType,
+		Stream:    &StreamInfo{ID: s.ID, UserID: s.UserID, Username: s.Username, Title: s.Title, CreatedAt: s.CreatedAt},
+		Viewer:    &PeerInfo{ID: peerID, UserID: peer.UserID, Username: peer.Username},
+		Timestamp: time.Now(),
+	}
+	
+	s.broadcastEvent(event)
+}
+
+// handleBroadcasterOffer answers the broadcaster's publishing offer
+func (s *Stream) handleBroadcasterOffer(broadcaster *Peer, signal *SignalMessage) error {
+	// Parse the SDP offer
+	var offer webrtc.SessionDescription
+	if err := json.Unmarshal(signal.Data, &offer); err != nil {
+		return fmt.Errorf("failed to parse offer: %v", err)
+	}
+	
+	// Set the remote description on the broadcaster connection
+	if err := broadcaster.Connection.SetRemoteDescription(offer); err != nil {
+		return fmt.Errorf("failed to set remote description: %v", err)
+	}
+	
+	// Create an answer
+	answer, err := broadcaster.Connection.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create answer: %v", err)
+	}
+	
+	// Set the local description
+	if err := broadcaster.Connection.SetLocalDescription(answer); err != nil {
+		return fmt.Errorf("failed to set local description: %v", err)
+	}
+	
+	// Marshal the answer
+	answerBytes, err := json.Marshal(answer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal answer: %v", err)
+	}
+	
+	// Send the answer back to the broadcaster
+	s.OnOutgoingSignal(&SignalMessage{
+		Type:      "answer",
+		FromPeer:  broadcaster.ID,
+		ToPeer:    broadcaster.ID,
+		SessionID: signal.SessionID,
+		Data:      answerBytes,
+	})
+	
+	return nil
+}
+
+// ingestTrack copies RTP from one of the broadcaster's tracks into the
+// matching stream track, which fans it out to every attached viewer. Tracks
+// in a codec other than the stream's are not ingested.
+func (s *Stream) ingestTrack(broadcaster *Peer, track *webrtc.TrackRemote) {
+	s.mutex.RLock()
+	localTrack := s.AudioTrack
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		localTrack = s.VideoTrack
+	}
+	s.mutex.RUnlock()
+	
+	if localTrack == nil {
+		log.Printf("No stream track for %s track %s on stream %s", track.Kind(), track.ID(), s.ID)
+		return
+	}
+	
+	// Viewers negotiate against the configured codec, so a different one will not play
+	if !strings.EqualFold(track.Codec().MimeType, localTrack.Codec().MimeType) {
+		log.Printf("Rejecting %s track %s on stream %s: broadcaster codec %s does not match stream codec %s",
+			track.Kind(), track.ID(), s.ID, track.Codec().MimeType, localTrack.Codec().MimeType)
+		return
+	}
+	
+	log.Printf("Ingesting %s track %s for stream %s", track.Kind(), track.ID(), s.ID)
+	
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		
+		// Nothing is flowing any more
+		s.mutex.Lock()
+		s.Stats.CurrentBandwidth = 0
+		s.bandwidthBytes = 0
+		s.bandwidthWindowStart = time.Time{}
+		s.mutex.Unlock()
+	}()
+	
+	// Ask the broadcaster for keyframes so viewers can start decoding quickly
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		go requestKeyFrames(broadcaster, track, done)
+	}
+	
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := track.Read(buf)
+		if err != nil {
+			log.Printf("Stopped ingesting track %s for stream %s: %v", track.ID(), s.ID, err)
+			return
+		}
+		
+		// ErrClosedPipe only means no viewer is attached yet
+		if _, err := localTrack.Write(buf[:n]); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			log.Printf("Failed to write RTP to stream %s: %v", s.ID, err)
+			return
+		}
+		
+		s.recordBytes(n)
+	}
+}
+
+// recordBytes updates the streamed byte count and current bandwidth
+func (s *Stream) recordBytes(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	now := time.Now()
+	if s.bandwidthWindowStart.IsZero() {
+		s.bandwidthWindowStart = now
+	}
+	
+	s.Stats.TotalBytesStreamed += int64(n)
+	s.bandwidthBytes += int64(n)
+	
+	// Roll the bandwidth window once it has elapsed
+	if elapsed := now.Sub(s.bandwidthWindowStart); elapsed >= bandwidthWindow {
+		s.Stats.CurrentBandwidth = int(float64(s.bandwidthBytes*8) / 1000 / elapsed.Seconds())
+		s.bandwidthBytes = 0
+		s.bandwidthWindowStart = now
+	}
+}
+
 // forwardOfferToViewer forwards an offer to a specific viewer
 func (s *Stream) forwardOfferToViewer(signal *SignalMessage) error {
 	// Check if viewer exists
@@ -407,7 +675,7 @@ func (s *Stream) forwardOfferToViewer(signal *SignalMessage) error {
 	}
 	
 	// Send the answer
-	s.SendSignal(answerSignal)
+	s.OnOutgoingSignal(answerSignal)
 	
 	return nil
 }
@@ -473,7 +741,7 @@ func (s *Stream) handleViewerOffer(signal *SignalMessage) error {
 	}
 	
 	// Send the answer
-	s.SendSignal(answerSignal)
+	s.OnOutgoingSignal(answerSignal)
 	
 	return nil
 }
@@ -509,7 +777,7 @@ func (s *Stream) forwardICECandidate(signal *SignalMessage) error {
 	var targetPeer *Peer
 	
 	s.mutex.RLock()
-	if signal.ToPeer == s.Broadcaster.ID {
+	if s.Broadcaster != nil && signal.ToPeer == s.Broadcaster.ID {
 		// Candidate for broadcaster
 		targetPeer = s.Broadcaster
 	} else {
@@ -559,16 +827,28 @@ func (s *Stream) ProcessChatMessage(viewerID string, message string) {
 		Stream:    &StreamInfo{ID: s.ID, UserID: s.UserID, Username: s.Username, Title: s.Title, CreatedAt: s.CreatedAt},
 		Viewer:    &PeerInfo{ID: viewerID, UserID: viewer.UserID, Username: viewer.Username},
 		Timestamp: time.Now(),
-		Data: map[string]interface{}{
-			"message": message,
-		},
+		Data:      ChatMessageData{Message: message},
 	}
 	
 	// Broadcast the event
 	s.broadcastEvent(event)
 }
 
-// broadcastEvent broadcasts an event to all connected peers
+// Announce broadcasts a custom event to the broadcaster and all viewers over their data channels
+func (s *Stream) Announce(eventType string, data interface{}) {
+	event := &StreamEvent{
+		Type:      eventType,
+		Stream:    &StreamInfo{ID: s.ID, UserID: s.UserID, Username: s.Username, Title: s.Title, CreatedAt: s.CreatedAt},
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+	
+	s.broadcastEvent(event)
+}
+
+// broadcastEvent broadcasts an event to the broadcaster and all viewers.
+// It goes through the peer manager, so it may be called with the stream
+// lock held.
 func (s *Stream) broadcastEvent(event *StreamEvent) {
 	// Convert event to JSON
 	eventBytes, err := json.Marshal(event)
@@ -577,20 +857,8 @@ func (s *Stream) broadcastEvent(event *StreamEvent) {
 		return
 	}
 	
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	
-	// Send to broadcaster if available
-	if s.Broadcaster != nil && s.Broadcaster.DataChannel != nil {
-		_ = s.Broadcaster.DataChannel.Send(eventBytes)
-	}
-	
-	// Send to all viewers
-	for _, viewer := range s.Viewers {
-		if viewer.DataChannel != nil {
-			_ = viewer.DataChannel.Send(eventBytes)
-		}
-	}
+	// Broadcast to all peers
+	s.PeerManager.BroadcastToPeers(eventBytes)
 }
 
 // GetStats returns the current stream statistics
@@ -627,8 +895,8 @@ func (s *Stream) GetViewerCount() int {
 
 // IsExpired checks if the stream has expired
 func (s *Stream) IsExpired() bool {
-	// Stream never expires if lifetime is 0
-	if s.Config.Lifetime == 0 {
+	// Stream never expires without a lifetime or scheduled end
+	if s.ExpiresAt.IsZero() {
 		return false
 	}
 	
@@ -649,4 +917,9 @@ func (s *Stream) SetOnViewerLeaveCallback(callback func(viewerID string)) {
 // SetOnChatMessageCallback sets the callback for chat message events
 func (s *Stream) SetOnChatMessageCallback(callback func(viewerID, message string)) {
 	s.OnChatMessageCallback = callback
+}
+
+// SetOnSignalCallback sets the callback for outgoing signaling messages
+func (s *Stream) SetOnSignalCallback(callback func(signal *SignalMessage)) {
+	s.OnSignalCallback = callback
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestStreamIngestsBroadcasterTrack(t *testing.T) {
+	stream := NewStream("stream", "streamer", "streamer", "Lecture", StreamConfig{})
+	t.Cleanup(stream.Close)
+
+	clients := make(map[string]*testClient)
+	stream.SetOnSignalCallback(func(signal *SignalMessage) {
+		clients[signal.ToPeer].signals <- signal
+	})
+
+	if _, err := stream.SetBroadcaster("broadcaster", "streamer", "streamer"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.AddViewer("viewer", "student", "student"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"broadcaster", "viewer"} {
+		clients[id] = newTestClient(t, id, stream.SendSignal)
+	}
+
+	broadcaster := clients["broadcaster"]
+	broadcaster.publishAudio()
+	broadcaster.offer()
+
+	// Viewers only receive, so they offer receive-only transceivers
+	viewer := clients["viewer"]
+	received := make(chan *webrtc.TrackRemote, 1)
+	viewer.pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		received <- track
+	})
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := viewer.pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viewer.offer()
+
+	track := waitFor(t, received, "the stream track")
+	if track.Kind() != webrtc.RTPCodecTypeAudio {
+		t.Errorf("viewer received a %s track, want audio", track.Kind())
+	}
+
+	packets := make(chan *rtp.Packet, 1)
+	go func() {
+		if packet, _, err := track.ReadRTP(); err == nil {
+			packets <- packet
+		}
+	}()
+	if packet := waitFor(t, packets, "a stream packet"); len(packet.Payload) != 3 {
+		t.Errorf("viewer payload = %x, want the broadcaster's", packet.Payload)
+	}
+
+	// The bandwidth is only worked out once a full window has passed
+	deadline := time.Now().Add(3 * bandwidthWindow)
+	for stream.GetStats().CurrentBandwidth == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	stats := stream.GetStats()
+	if stats.TotalBytesStreamed == 0 {
+		t.Error("TotalBytesStreamed = 0, want the ingested bytes counted")
+	}
+	if stats.CurrentBandwidth == 0 {
+		t.Error("CurrentBandwidth = 0, want it measured from the ingested bytes")
+	}
+}
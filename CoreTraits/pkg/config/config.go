@@ -0,0 +1,648 @@
+// Package config holds the typed server configuration. Values are resolved in
+// order: built-in defaults, then a YAML or JSON file, then environment
+// variables, and are validated before the server starts.
+//
+// Environment overrides:
+//
+//	PORT                        listen port (":" + PORT)
+//	ARIES_ADDR                  listen address, overrides PORT
+//	ARIES_TLS_CERT              TLS certificate file
+//	ARIES_TLS_KEY               TLS private key file
+//	ARIES_REDIRECT_ADDR         plain HTTP address redirecting to TLS
+//	ARIES_REDIRECT_HOST         host the HTTP redirect sends clients to (e.g. example.com)
+//	ARIES_PROXY_HEADER          header carrying the client IP from a reverse proxy (e.g. X-Real-IP)
+//	ARIES_TRUSTED_PROXIES       comma-separated proxy IPs or CIDRs allowed to set ARIES_PROXY_HEADER
+//	ARIES_SHUTDOWN_TIMEOUT      time allowed to drain sessions on shutdown (e.g. 30s)
+//	ARIES_RECONNECT_DELAY       reconnect hint sent to clients on shutdown (e.g. 5s)
+//	ARIES_ICE_SERVERS           comma-separated STUN/TURN URLs
+//	ARIES_TURN_USERNAME         username for every TURN URL in ARIES_ICE_SERVERS
+//	ARIES_TURN_CREDENTIAL       credential for every TURN URL in ARIES_ICE_SERVERS
+//	ARIES_SIGNAL_BUFFER_SIZE    queued signals per room or stream
+//	ARIES_CHAT_MAX_MESSAGE_SIZE maximum websocket frame in bytes
+//	ARIES_CHAT_WRITE_WAIT       websocket write deadline (e.g. 10s)
+//	ARIES_CHAT_PONG_WAIT        websocket pong deadline (e.g. 60s)
+//	ARIES_CHAT_MAX_HISTORY      chat messages replayed to new clients
+//	ARIES_CHAT_SEND_BUFFER_SIZE queued outbound frames per client
+//	ARIES_CHAT_RESUME_GRACE     how long a dropped peer may reconnect as itself (0 disables)
+//	ARIES_STREAM_MAX_VIEWERS    default viewer limit for new streams
+//	ARIES_ADMIN_TOKEN           bearer token for admin endpoints
+//	ARIES_AUTH_PROVIDER         how websocket tokens are checked: jwt or sanctum
+//	ARIES_JWT_ALGORITHM         signing algorithm for websocket tokens (HS256, RS256, ...)
+//	ARIES_JWT_SECRET            shared secret for HS* tokens
+//	ARIES_JWT_PUBLIC_KEY_FILE   PEM RSA public key for RS* tokens
+//	ARIES_JWT_ISSUER            required "iss" claim
+//	ARIES_JWT_AUDIENCE          required "aud" claim
+//	ARIES_SANCTUM_ENDPOINT      Laravel URL returning the token's user (e.g. https://host/api/user)
+//	ARIES_SANCTUM_TIMEOUT       timeout for each introspection request (e.g. 5s)
+//	ARIES_SANCTUM_CACHE_TTL     how long accepted tokens are cached (0 disables caching)
+//	ARIES_INVITE_SECRET         key signing invite tokens to private sessions (random if unset)
+//	ARIES_INVITE_TTL            how long invite tokens stay valid (e.g. 24h)
+//	ARIES_ACCESS_MAX_ATTEMPTS   failed access codes allowed per IP before lockout
+//	ARIES_ACCESS_MAX_SESSION_ATTEMPTS failed access codes allowed per room or stream before IPs that keep failing are locked out
+//	ARIES_ACCESS_ATTEMPT_WINDOW how long failed access codes count towards a lockout (e.g. 10m)
+//	ARIES_ACCESS_LOCKOUT        how long a locked IP or session is refused (e.g. 15m)
+//	ARIES_JANITOR_INTERVAL      how often expired and idle sessions are swept (e.g. 30s)
+//	ARIES_ROOM_EXPIRY_WARNING   warning given before a room's lifetime runs out (0 disables)
+//	ARIES_ROOM_IDLE_TIMEOUT     how long an empty room is kept open (0 keeps it)
+//	ARIES_STREAM_RETENTION      how long an ended stream stays reachable (e.g. 5m)
+//	ARIES_SESSION_START_REMINDER reminder given before a scheduled session starts (0 disables)
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Placeholder shown instead of secret values
+const redacted = "[REDACTED]"
+
+// Config is the complete server configuration
+type Config struct {
+	Server  ServerConfig  `json:"server" yaml:"server"`
+	WebRTC  WebRTCConfig  `json:"webrtc" yaml:"webrtc"`
+	Chat    ChatConfig    `json:"chat" yaml:"chat"`
+	Stream  StreamConfig  `json:"stream" yaml:"stream"`
+	Admin   AdminConfig   `json:"admin" yaml:"admin"`
+	Auth    AuthConfig    `json:"auth" yaml:"auth"`
+	Access  AccessConfig  `json:"access" yaml:"access"`
+	Janitor JanitorConfig `json:"janitor" yaml:"janitor"`
+}
+
+// ServerConfig contains listener settings
+type ServerConfig struct {
+	Addr             string   `json:"addr" yaml:"addr"`
+	CertFile         string   `json:"cert_file" yaml:"cert_file"`
+	KeyFile          string   `json:"key_file" yaml:"key_file"`
+	RedirectAddr     string   `json:"redirect_addr" yaml:"redirect_addr"`
+	RedirectHost     string   `json:"redirect_host" yaml:"redirect_host"`
+	ProxyHeader      string   `json:"proxy_header" yaml:"proxy_header"`
+	TrustedProxies   []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+	HandshakeTimeout Duration `json:"handshake_timeout" yaml:"handshake_timeout"`
+	ShutdownTimeout  Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	ReconnectDelay   Duration `json:"reconnect_delay" yaml:"reconnect_delay"`
+}
+
+// WebRTCConfig contains peer connection settings
+type WebRTCConfig struct {
+	ICEServers       []ICEServer `json:"ice_servers" yaml:"ice_servers"`
+	SignalBufferSize int         `json:"signal_buffer_size" yaml:"signal_buffer_size"`
+}
+
+// ICEServer is a STUN or TURN server offered to peer connections
+type ICEServer struct {
+	URLs       []string `json:"urls" yaml:"urls"`
+	Username   string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Credential string   `json:"credential,omitempty" yaml:"credential,omitempty"`
+}
+
+// ChatConfig contains websocket and hub settings
+type ChatConfig struct {
+	MaxMessageSize int64    `json:"max_message_size" yaml:"max_message_size"`
+	WriteWait      Duration `json:"write_wait" yaml:"write_wait"`
+	PongWait       Duration `json:"pong_wait" yaml:"pong_wait"`
+	MaxHistory     int      `json:"max_history" yaml:"max_history"`
+	SendBufferSize int      `json:"send_buffer_size" yaml:"send_buffer_size"`
+
+	// How long a peer whose connection dropped is held for it to resume
+	ResumeGrace Duration `json:"resume_grace" yaml:"resume_grace"`
+}
+
+// StreamConfig contains defaults for new streams
+type StreamConfig struct {
+	MaxViewers int `json:"max_viewers" yaml:"max_viewers"`
+}
+
+// AdminConfig contains settings for admin endpoints
+type AdminConfig struct {
+	Token string `json:"token" yaml:"token"`
+}
+
+// AuthConfig contains settings for authenticating websocket clients
+type AuthConfig struct {
+	Provider string        `json:"provider" yaml:"provider"`
+	JWT      JWTConfig     `json:"jwt" yaml:"jwt"`
+	Sanctum  SanctumConfig `json:"sanctum" yaml:"sanctum"`
+}
+
+// JWTConfig contains the key and expected claims for bearer tokens
+type JWTConfig struct {
+	Algorithm     string   `json:"algorithm" yaml:"algorithm"`
+	Secret        string   `json:"secret" yaml:"secret"`
+	PublicKeyFile string   `json:"public_key_file" yaml:"public_key_file"`
+	Issuer        string   `json:"issuer" yaml:"issuer"`
+	Audience      string   `json:"audience" yaml:"audience"`
+	Leeway        Duration `json:"leeway" yaml:"leeway"`
+}
+
+// SanctumConfig points at the Laravel app that issues Sanctum tokens
+type SanctumConfig struct {
+	Endpoint string   `json:"endpoint" yaml:"endpoint"`
+	Timeout  Duration `json:"timeout" yaml:"timeout"`
+	CacheTTL Duration `json:"cache_ttl" yaml:"cache_ttl"`
+}
+
+// AccessConfig contains settings for joining private rooms and streams
+type AccessConfig struct {
+	InviteSecret       string   `json:"invite_secret" yaml:"invite_secret"`
+	InviteTTL          Duration `json:"invite_ttl" yaml:"invite_ttl"`
+	MaxAttempts        int      `json:"max_attempts" yaml:"max_attempts"`
+	MaxSessionAttempts int      `json:"max_session_attempts" yaml:"max_session_attempts"`
+	AttemptWindow      Duration `json:"attempt_window" yaml:"attempt_window"`
+	Lockout            Duration `json:"lockout" yaml:"lockout"`
+}
+
+// JanitorConfig contains settings for closing expired and abandoned sessions
+type JanitorConfig struct {
+	Interval        Duration `json:"interval" yaml:"interval"`
+	ExpiryWarning   Duration `json:"expiry_warning" yaml:"expiry_warning"`
+	IdleTimeout     Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	StreamRetention Duration `json:"stream_retention" yaml:"stream_retention"`
+	StartReminder   Duration `json:"start_reminder" yaml:"start_reminder"`
+}
+
+// IsHMAC reports whether the algorithm uses a shared secret
+func (j JWTConfig) IsHMAC() bool {
+	return strings.HasPrefix(j.Algorithm, "HS")
+}
+
+// Duration is a time.Duration written as a string such as "60s" in config files
+type Duration time.Duration
+
+// Std returns the duration as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"60s\": %v", err)
+	}
+
+	return d.parse(value)
+}
+
+// MarshalYAML encodes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML decodes a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+// parse sets the duration from a string such as "60s"
+func (d *Duration) parse(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", value, err)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:             ":3000",
+			HandshakeTimeout: Duration(10 * time.Second),
+			ShutdownTimeout:  Duration(30 * time.Second),
+			ReconnectDelay:   Duration(5 * time.Second),
+		},
+		WebRTC: WebRTCConfig{
+			ICEServers: []ICEServer{
+				{URLs: []string{"stun:stun.l.google.com:19302"}},
+			},
+			SignalBufferSize: 100,
+		},
+		Chat: ChatConfig{
+			MaxMessageSize: 512 * 1024, // 512KB
+			WriteWait:      Duration(10 * time.Second),
+			PongWait:       Duration(60 * time.Second),
+			MaxHistory:     100,
+			SendBufferSize: 256,
+			ResumeGrace:    Duration(30 * time.Second),
+		},
+		Stream: StreamConfig{
+			MaxViewers: 100,
+		},
+		Auth: AuthConfig{
+			Provider: "jwt",
+			JWT: JWTConfig{
+				Algorithm: "HS256",
+				Leeway:    Duration(30 * time.Second),
+			},
+			Sanctum: SanctumConfig{
+				Timeout:  Duration(5 * time.Second),
+				CacheTTL: Duration(time.Minute),
+			},
+		},
+		Access: AccessConfig{
+			InviteTTL:          Duration(24 * time.Hour),
+			MaxAttempts:        5,
+			MaxSessionAttempts: 20,
+			AttemptWindow:      Duration(10 * time.Minute),
+			Lockout:            Duration(15 * time.Minute),
+		},
+		Janitor: JanitorConfig{
+			Interval:        Duration(30 * time.Second),
+			ExpiryWarning:   Duration(5 * time.Minute),
+			IdleTimeout:     Duration(10 * time.Minute),
+			StreamRetention: Duration(5 * time.Minute),
+			StartReminder:   Duration(5 * time.Minute),
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the optional file at path and
+// the environment, and validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile overlays a YAML or JSON file onto the configuration
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .json)", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overlays environment variables onto the configuration
+func (c *Config) applyEnv() error {
+	var errs []error
+
+	if port := os.Getenv("PORT"); port != "" {
+		c.Server.Addr = ":" + port
+	}
+	envString("ARIES_ADDR", &c.Server.Addr)
+	envString("ARIES_TLS_CERT", &c.Server.CertFile)
+	envString("ARIES_TLS_KEY", &c.Server.KeyFile)
+	envString("ARIES_REDIRECT_ADDR", &c.Server.RedirectAddr)
+	envString("ARIES_REDIRECT_HOST", &c.Server.RedirectHost)
+	envString("ARIES_PROXY_HEADER", &c.Server.ProxyHeader)
+	if proxies := os.Getenv("ARIES_TRUSTED_PROXIES"); proxies != "" {
+		c.Server.TrustedProxies = nil
+		for _, proxy := range strings.Split(proxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				c.Server.TrustedProxies = append(c.Server.TrustedProxies, proxy)
+			}
+		}
+	}
+
+	if urls := os.Getenv("ARIES_ICE_SERVERS"); urls != "" {
+		c.WebRTC.ICEServers = nil
+		for _, url := range strings.Split(urls, ",") {
+			url = strings.TrimSpace(url)
+			if url == "" {
+				continue
+			}
+
+			server := ICEServer{URLs: []string{url}}
+			if strings.HasPrefix(url, "turn") {
+				server.Username = os.Getenv("ARIES_TURN_USERNAME")
+				server.Credential = os.Getenv("ARIES_TURN_CREDENTIAL")
+			}
+			c.WebRTC.ICEServers = append(c.WebRTC.ICEServers, server)
+		}
+	}
+
+	errs = append(errs,
+		envDuration("ARIES_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout),
+		envDuration("ARIES_RECONNECT_DELAY", &c.Server.ReconnectDelay),
+		envInt("ARIES_SIGNAL_BUFFER_SIZE", &c.WebRTC.SignalBufferSize),
+		envInt64("ARIES_CHAT_MAX_MESSAGE_SIZE", &c.Chat.MaxMessageSize),
+		envDuration("ARIES_CHAT_WRITE_WAIT", &c.Chat.WriteWait),
+		envDuration("ARIES_CHAT_PONG_WAIT", &c.Chat.PongWait),
+		envInt("ARIES_CHAT_MAX_HISTORY", &c.Chat.MaxHistory),
+		envInt("ARIES_CHAT_SEND_BUFFER_SIZE", &c.Chat.SendBufferSize),
+		envDuration("ARIES_CHAT_RESUME_GRACE", &c.Chat.ResumeGrace),
+		envInt("ARIES_STREAM_MAX_VIEWERS", &c.Stream.MaxViewers),
+	)
+
+	envString("ARIES_ADMIN_TOKEN", &c.Admin.Token)
+	envString("ARIES_AUTH_PROVIDER", &c.Auth.Provider)
+	envString("ARIES_JWT_ALGORITHM", &c.Auth.JWT.Algorithm)
+	envString("ARIES_JWT_SECRET", &c.Auth.JWT.Secret)
+	envString("ARIES_JWT_PUBLIC_KEY_FILE", &c.Auth.JWT.PublicKeyFile)
+	envString("ARIES_JWT_ISSUER", &c.Auth.JWT.Issuer)
+	envString("ARIES_JWT_AUDIENCE", &c.Auth.JWT.Audience)
+	envString("ARIES_SANCTUM_ENDPOINT", &c.Auth.Sanctum.Endpoint)
+	errs = append(errs,
+		envDuration("ARIES_SANCTUM_TIMEOUT", &c.Auth.Sanctum.Timeout),
+		envDuration("ARIES_SANCTUM_CACHE_TTL", &c.Auth.Sanctum.CacheTTL),
+	)
+
+	envString("ARIES_INVITE_SECRET", &c.Access.InviteSecret)
+	errs = append(errs,
+		envDuration("ARIES_INVITE_TTL", &c.Access.InviteTTL),
+		envInt("ARIES_ACCESS_MAX_ATTEMPTS", &c.Access.MaxAttempts),
+		envInt("ARIES_ACCESS_MAX_SESSION_ATTEMPTS", &c.Access.MaxSessionAttempts),
+		envDuration("ARIES_ACCESS_ATTEMPT_WINDOW", &c.Access.AttemptWindow),
+		envDuration("ARIES_ACCESS_LOCKOUT", &c.Access.Lockout),
+		envDuration("ARIES_JANITOR_INTERVAL", &c.Janitor.Interval),
+		envDuration("ARIES_ROOM_EXPIRY_WARNING", &c.Janitor.ExpiryWarning),
+		envDuration("ARIES_ROOM_IDLE_TIMEOUT", &c.Janitor.IdleTimeout),
+		envDuration("ARIES_STREAM_RETENTION", &c.Janitor.StreamRetention),
+		envDuration("ARIES_SESSION_START_REMINDER", &c.Janitor.StartReminder),
+	)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if (c.Server.CertFile == "") != (c.Server.KeyFile == "") {
+		errs = append(errs, errors.New("server.cert_file and server.key_file must be set together"))
+	}
+	if c.Server.RedirectAddr != "" && c.Server.CertFile == "" {
+		errs = append(errs, errors.New("server.redirect_addr requires TLS to be configured"))
+	}
+	// Redirecting to the requested Host would send clients wherever an attacker points them
+	if c.Server.RedirectAddr != "" && c.Server.RedirectHost == "" {
+		errs = append(errs, errors.New("server.redirect_addr requires server.redirect_host"))
+	}
+	// Any client could set the header if every peer were trusted
+	if c.Server.ProxyHeader != "" && len(c.Server.TrustedProxies) == 0 {
+		errs = append(errs, errors.New("server.proxy_header requires server.trusted_proxies"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("server.trusted_proxies entry %q must be an IP or CIDR", proxy))
+			}
+		}
+	}
+	if c.Server.HandshakeTimeout <= 0 {
+		errs = append(errs, errors.New("server.handshake_timeout must be positive"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	if c.Server.ReconnectDelay < 0 {
+		errs = append(errs, errors.New("server.reconnect_delay cannot be negative"))
+	}
+
+	for i, server := range c.WebRTC.ICEServers {
+		if len(server.URLs) == 0 {
+			errs = append(errs, fmt.Errorf("webrtc.ice_servers[%d] has no urls", i))
+		}
+		for _, url := range server.URLs {
+			if !strings.HasPrefix(url, "stun:") && !strings.HasPrefix(url, "turn:") && !strings.HasPrefix(url, "turns:") {
+				errs = append(errs, fmt.Errorf("webrtc.ice_servers[%d] url %q must start with stun:, turn: or turns:", i, url))
+			}
+		}
+	}
+	if c.WebRTC.SignalBufferSize <= 0 {
+		errs = append(errs, errors.New("webrtc.signal_buffer_size must be positive"))
+	}
+
+	if c.Chat.MaxMessageSize <= 0 {
+		errs = append(errs, errors.New("chat.max_message_size must be positive"))
+	}
+	if c.Chat.WriteWait <= 0 {
+		errs = append(errs, errors.New("chat.write_wait must be positive"))
+	}
+	if c.Chat.PongWait <= c.Chat.WriteWait {
+		errs = append(errs, errors.New("chat.pong_wait must be longer than chat.write_wait"))
+	}
+	if c.Chat.MaxHistory < 0 {
+		errs = append(errs, errors.New("chat.max_history cannot be negative"))
+	}
+	if c.Chat.SendBufferSize <= 0 {
+		errs = append(errs, errors.New("chat.send_buffer_size must be positive"))
+	}
+	if c.Chat.ResumeGrace < 0 {
+		errs = append(errs, errors.New("chat.resume_grace cannot be negative"))
+	}
+
+	if c.Stream.MaxViewers < 0 {
+		errs = append(errs, errors.New("stream.max_viewers cannot be negative"))
+	}
+
+	switch c.Auth.Provider {
+	case "jwt":
+		errs = append(errs, c.Auth.JWT.validate()...)
+	case "sanctum":
+		errs = append(errs, c.Auth.Sanctum.validate()...)
+	default:
+		errs = append(errs, fmt.Errorf("auth.provider %q must be jwt or sanctum", c.Auth.Provider))
+	}
+
+	if c.Access.InviteTTL <= 0 {
+		errs = append(errs, errors.New("access.invite_ttl must be positive"))
+	}
+	if c.Access.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("access.max_attempts must be positive"))
+	}
+	if c.Access.MaxSessionAttempts <= 0 {
+		errs = append(errs, errors.New("access.max_session_attempts must be positive"))
+	}
+	if c.Access.AttemptWindow <= 0 {
+		errs = append(errs, errors.New("access.attempt_window must be positive"))
+	}
+	if c.Access.Lockout <= 0 {
+		errs = append(errs, errors.New("access.lockout must be positive"))
+	}
+
+	if c.Janitor.Interval <= 0 {
+		errs = append(errs, errors.New("janitor.interval must be positive"))
+	}
+	if c.Janitor.ExpiryWarning < 0 {
+		errs = append(errs, errors.New("janitor.expiry_warning cannot be negative"))
+	}
+	if c.Janitor.IdleTimeout < 0 {
+		errs = append(errs, errors.New("janitor.idle_timeout cannot be negative"))
+	}
+	if c.Janitor.StreamRetention < 0 {
+		errs = append(errs, errors.New("janitor.stream_retention cannot be negative"))
+	}
+	if c.Janitor.StartReminder < 0 {
+		errs = append(errs, errors.New("janitor.start_reminder cannot be negative"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	return nil
+}
+
+// validate checks the JWT settings
+func (j JWTConfig) validate() []error {
+	var errs []error
+
+	switch j.Algorithm {
+	case "HS256", "HS384", "HS512":
+		if j.Secret == "" {
+			errs = append(errs, fmt.Errorf("auth.jwt.secret is required for %s", j.Algorithm))
+		}
+	case "RS256", "RS384", "RS512":
+		if j.PublicKeyFile == "" {
+			errs = append(errs, fmt.Errorf("auth.jwt.public_key_file is required for %s", j.Algorithm))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.jwt.algorithm %q must be one of HS256, HS384, HS512, RS256, RS384 or RS512", j.Algorithm))
+	}
+	if j.Leeway < 0 {
+		errs = append(errs, errors.New("auth.jwt.leeway cannot be negative"))
+	}
+
+	return errs
+}
+
+// validate checks the Sanctum settings
+func (s SanctumConfig) validate() []error {
+	var errs []error
+
+	if endpoint, err := url.Parse(s.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		errs = append(errs, fmt.Errorf("auth.sanctum.endpoint %q must be an http or https URL", s.Endpoint))
+	}
+	if s.Timeout <= 0 {
+		errs = append(errs, errors.New("auth.sanctum.timeout must be positive"))
+	}
+	if s.CacheTTL < 0 {
+		errs = append(errs, errors.New("auth.sanctum.cache_ttl cannot be negative"))
+	}
+
+	return errs
+}
+
+// PingPeriod returns how often websocket pings are sent (must be less than PongWait)
+func (c ChatConfig) PingPeriod() time.Duration {
+	return (c.PongWait.Std() * 9) / 10
+}
+
+// Redacted returns a copy of the configuration with secrets masked
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	copied.WebRTC.ICEServers = make([]ICEServer, len(c.WebRTC.ICEServers))
+	for i, server := range c.WebRTC.ICEServers {
+		server.URLs = append([]string(nil), server.URLs...)
+		server.Credential = redact(server.Credential)
+		copied.WebRTC.ICEServers[i] = server
+	}
+
+	copied.Admin.Token = redact(c.Admin.Token)
+	copied.Auth.JWT.Secret = redact(c.Auth.JWT.Secret)
+	copied.Access.InviteSecret = redact(c.Access.InviteSecret)
+
+	return &copied
+}
+
+// redact masks a secret, leaving empty values empty so unset secrets are visible
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// envString overrides a string setting from the environment
+func envString(name string, target *string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+// envInt overrides an int setting from the environment
+func envInt(name string, target *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not an integer", name, value)
+	}
+
+	*target = parsed
+	return nil
+}
+
+// envInt64 overrides an int64 setting from the environment
+func envInt64(name string, target *int64) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not an integer", name, value)
+	}
+
+	*target = parsed
+	return nil
+}
+
+// envDuration overrides a duration setting from the environment
+func envDuration(name string, target *Duration) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	if err := target.parse(value); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	return nil
+}
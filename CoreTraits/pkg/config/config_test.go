@@ -0,0 +1,254 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid returns the defaults with the one setting they leave unset
+func valid() *Config {
+	cfg := Default()
+	cfg.Auth.JWT.Secret = "secret"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"missing addr", func(c *Config) { c.Server.Addr = "" }, "server.addr is required"},
+		{"cert without key", func(c *Config) { c.Server.CertFile = "cert.pem" }, "must be set together"},
+		{"redirect without tls", func(c *Config) { c.Server.RedirectAddr = ":80" }, "requires TLS"},
+		{"redirect without host", func(c *Config) {
+			c.Server.CertFile, c.Server.KeyFile = "cert.pem", "key.pem"
+			c.Server.RedirectAddr = ":80"
+		}, "server.redirect_host"},
+		{"ice url scheme", func(c *Config) { c.WebRTC.ICEServers[0].URLs = []string{"http://stun"} }, "must start with stun:"},
+		{"ice server without urls", func(c *Config) { c.WebRTC.ICEServers[0].URLs = nil }, "has no urls"},
+		{"proxy header without trusted proxies", func(c *Config) { c.Server.ProxyHeader = "X-Real-IP" }, "server.trusted_proxies"},
+		{"bad trusted proxy", func(c *Config) {
+			c.Server.ProxyHeader = "X-Real-IP"
+			c.Server.TrustedProxies = []string{"proxy.internal"}
+		}, "must be an IP or CIDR"},
+		{"trusted proxies", func(c *Config) {
+			c.Server.ProxyHeader = "X-Real-IP"
+			c.Server.TrustedProxies = []string{"10.0.0.1", "172.16.0.0/12"}
+		}, ""},
+		{"pong shorter than write", func(c *Config) { c.Chat.PongWait = c.Chat.WriteWait }, "chat.pong_wait"},
+		{"negative resume grace", func(c *Config) { c.Chat.ResumeGrace = -1 }, "chat.resume_grace"},
+		{"unknown provider", func(c *Config) { c.Auth.Provider = "ldap" }, "auth.provider"},
+		{"hmac without secret", func(c *Config) { c.Auth.JWT.Secret = "" }, "auth.jwt.secret is required"},
+		{"rsa without key", func(c *Config) { c.Auth.JWT.Algorithm = "RS256" }, "auth.jwt.public_key_file"},
+		{"unknown algorithm", func(c *Config) { c.Auth.JWT.Algorithm = "none" }, "auth.jwt.algorithm"},
+		{"sanctum without endpoint", func(c *Config) { c.Auth.Provider = "sanctum" }, "auth.sanctum.endpoint"},
+		{"sanctum endpoint", func(c *Config) {
+			c.Auth.Provider = "sanctum"
+			c.Auth.Sanctum.Endpoint = "https://example.com/api/user"
+		}, ""},
+		{"zero max attempts", func(c *Config) { c.Access.MaxAttempts = 0 }, "access.max_attempts"},
+		{"zero lockout", func(c *Config) { c.Access.Lockout = 0 }, "access.lockout"},
+		{"zero janitor interval", func(c *Config) { c.Janitor.Interval = 0 }, "janitor.interval"},
+		{"negative start reminder", func(c *Config) { c.Janitor.StartReminder = -1 }, "janitor.start_reminder"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := valid()
+	cfg.Server.Addr = ""
+	cfg.Chat.MaxHistory = -1
+	cfg.Access.InviteTTL = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, want := range []string{"server.addr", "chat.max_history", "access.invite_ttl"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, missing %q", err, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("PORT", "8080")
+	t.Setenv("ARIES_CHAT_WRITE_WAIT", "3s")
+	t.Setenv("ARIES_CHAT_MAX_HISTORY", "7")
+	t.Setenv("ARIES_CHAT_MAX_MESSAGE_SIZE", "1024")
+	t.Setenv("ARIES_ICE_SERVERS", "stun:a.example.com, turn:b.example.com,")
+	t.Setenv("ARIES_TURN_USERNAME", "user")
+	t.Setenv("ARIES_TURN_CREDENTIAL", "pass")
+	t.Setenv("ARIES_ADMIN_TOKEN", "admin")
+	t.Setenv("ARIES_TRUSTED_PROXIES", "10.0.0.1, 10.0.0.2")
+	t.Setenv("ARIES_ACCESS_ATTEMPT_WINDOW", "2m")
+
+	cfg := Default()
+	if err := cfg.applyEnv(); err != nil {
+		t.Fatalf("applyEnv() = %v", err)
+	}
+
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("Server.Addr = %q, want :8080", cfg.Server.Addr)
+	}
+	if cfg.Chat.WriteWait.Std() != 3*time.Second {
+		t.Errorf("Chat.WriteWait = %v, want 3s", cfg.Chat.WriteWait.Std())
+	}
+	if cfg.Chat.MaxHistory != 7 || cfg.Chat.MaxMessageSize != 1024 {
+		t.Errorf("Chat = %+v, want max_history 7 and max_message_size 1024", cfg.Chat)
+	}
+	if cfg.Admin.Token != "admin" {
+		t.Errorf("Admin.Token = %q, want admin", cfg.Admin.Token)
+	}
+	if cfg.Access.AttemptWindow.Std() != 2*time.Minute {
+		t.Errorf("Access.AttemptWindow = %v, want 2m", cfg.Access.AttemptWindow.Std())
+	}
+
+	if proxies := cfg.Server.TrustedProxies; len(proxies) != 2 || proxies[1] != "10.0.0.2" {
+		t.Errorf("Server.TrustedProxies = %q, want both proxies", proxies)
+	}
+
+	servers := cfg.WebRTC.ICEServers
+	if len(servers) != 2 {
+		t.Fatalf("ICEServers = %+v, want 2 servers", servers)
+	}
+	if servers[0].Username != "" || servers[0].Credential != "" {
+		t.Errorf("STUN server got TURN credentials: %+v", servers[0])
+	}
+	if servers[1].Username != "user" || servers[1].Credential != "pass" {
+		t.Errorf("TURN server = %+v, want user/pass", servers[1])
+	}
+}
+
+func TestApplyEnvAddrOverridesPort(t *testing.T) {
+	t.Setenv("PORT", "8080")
+	t.Setenv("ARIES_ADDR", "127.0.0.1:9000")
+
+	cfg := Default()
+	if err := cfg.applyEnv(); err != nil {
+		t.Fatalf("applyEnv() = %v", err)
+	}
+	if cfg.Server.Addr != "127.0.0.1:9000" {
+		t.Errorf("Server.Addr = %q, want 127.0.0.1:9000", cfg.Server.Addr)
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	t.Setenv("ARIES_CHAT_MAX_HISTORY", "many")
+	t.Setenv("ARIES_CHAT_PONG_WAIT", "soon")
+
+	err := Default().applyEnv()
+	if err == nil {
+		t.Fatal("applyEnv() = nil, want errors")
+	}
+	for _, want := range []string{"ARIES_CHAT_MAX_HISTORY", "ARIES_CHAT_PONG_WAIT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("applyEnv() = %v, missing %q", err, want)
+		}
+	}
+}
+
+func TestLoadFileThenEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aries.yaml")
+	data := "server:\n  addr: \":4000\"\nchat:\n  pong_wait: 90s\nauth:\n  jwt:\n    secret: file-secret\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ARIES_ADDR", ":5000")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if cfg.Server.Addr != ":5000" {
+		t.Errorf("Server.Addr = %q, want the environment's :5000", cfg.Server.Addr)
+	}
+	if cfg.Chat.PongWait.Std() != 90*time.Second {
+		t.Errorf("Chat.PongWait = %v, want the file's 90s", cfg.Chat.PongWait.Std())
+	}
+	if cfg.Chat.WriteWait.Std() != 10*time.Second {
+		t.Errorf("Chat.WriteWait = %v, want the default 10s", cfg.Chat.WriteWait.Std())
+	}
+}
+
+func TestLoadRejectsUnknownExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aries.toml")
+	if err := os.WriteFile(path, []byte(""), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "unsupported config file type") {
+		t.Fatalf("Load() = %v, want unsupported file type", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := valid()
+	cfg.Admin.Token = "admin"
+	cfg.Access.InviteSecret = "invite"
+	cfg.WebRTC.ICEServers = []ICEServer{{URLs: []string{"turn:example.com"}, Username: "user", Credential: "pass"}}
+
+	redactedCfg := cfg.Redacted()
+
+	if redactedCfg.Admin.Token != redacted || redactedCfg.Auth.JWT.Secret != redacted || redactedCfg.Access.InviteSecret != redacted {
+		t.Errorf("secrets not redacted: admin %q, jwt %q, invite %q",
+			redactedCfg.Admin.Token, redactedCfg.Auth.JWT.Secret, redactedCfg.Access.InviteSecret)
+	}
+	if server := redactedCfg.WebRTC.ICEServers[0]; server.Credential != redacted || server.Username != "user" {
+		t.Errorf("ICE server = %+v, want credential redacted and username kept", server)
+	}
+
+	// The original is left alone
+	if cfg.Admin.Token != "admin" || cfg.WebRTC.ICEServers[0].Credential != "pass" {
+		t.Errorf("Redacted() changed the original configuration")
+	}
+	redactedCfg.WebRTC.ICEServers[0].URLs[0] = "turn:other.example.com"
+	if cfg.WebRTC.ICEServers[0].URLs[0] != "turn:example.com" {
+		t.Errorf("Redacted() shares ICE server URLs with the original")
+	}
+}
+
+func TestRedactedLeavesUnsetSecretsEmpty(t *testing.T) {
+	cfg := Default()
+
+	if got := cfg.Redacted(); got.Admin.Token != "" || got.Auth.JWT.Secret != "" {
+		t.Errorf("unset secrets = %q, %q, want empty", got.Admin.Token, got.Auth.JWT.Secret)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	var d Duration
+	if err := d.UnmarshalJSON([]byte(`"90s"`)); err != nil || d.Std() != 90*time.Second {
+		t.Fatalf("UnmarshalJSON(90s) = %v, %v", d.Std(), err)
+	}
+	if err := d.UnmarshalJSON([]byte(`90`)); err == nil {
+		t.Error("UnmarshalJSON(90) = nil, want error for a bare number")
+	}
+
+	data, err := Duration(time.Minute).MarshalJSON()
+	if err != nil || string(data) != `"1m0s"` {
+		t.Errorf("MarshalJSON(1m) = %s, %v", data, err)
+	}
+}
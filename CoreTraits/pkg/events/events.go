@@ -0,0 +1,104 @@
+// Package events describes the events the server sends to clients. Each
+// package that sends events lists them as Specs, and the catalogue of specs
+// is published as JSON Schema so clients can generate decoders.
+package events
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Frame is an event sent to the clients of a room or stream over websocket
+type Frame struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// Encode marshals an event frame
+func Encode(event string, data interface{}) ([]byte, error) {
+	return json.Marshal(Frame{Event: event, Data: data})
+}
+
+// Channels events are sent over, other than room and stream websockets
+const (
+	ChannelChat       = "chat"
+	ChannelRoomData   = "room_data"
+	ChannelStreamData = "stream_data"
+)
+
+// Spec describes one event. Example is a frame of the event with every
+// interface field set to a value of its payload type, from which the schema
+// is generated. Key names the frame field holding the event name, and
+// Channel is where the event is sent, empty for room and stream websockets.
+type Spec struct {
+	Channel     string
+	Name        string
+	Description string
+	Key         string
+	Example     interface{}
+}
+
+// Event describes an event sent in a Frame with the given payload type
+func Event(name, description string, data interface{}) Spec {
+	return Spec{
+		Name:        name,
+		Description: description,
+		Key:         "event",
+		Example:     Frame{Event: name, Data: data},
+	}
+}
+
+// Catalogue is a set of event specs from every package that sends events
+type Catalogue struct {
+	specs map[string]Spec
+	names []string
+}
+
+// NewCatalogue creates a catalogue of the given specs. Specs with the same
+// ID replace earlier ones.
+func NewCatalogue(specs ...[]Spec) *Catalogue {
+	c := &Catalogue{specs: make(map[string]Spec)}
+
+	for _, group := range specs {
+		for _, spec := range group {
+			id := spec.ID()
+			if _, exists := c.specs[id]; !exists {
+				c.names = append(c.names, id)
+			}
+			c.specs[id] = spec
+		}
+	}
+
+	sort.Strings(c.names)
+	return c
+}
+
+// ID identifies a spec within a catalogue. Events on room and stream
+// websockets are named as sent, others are prefixed with their channel, as
+// in "room_data.peer_join".
+func (s Spec) ID() string {
+	if s.Channel == "" {
+		return s.Name
+	}
+	return s.Channel + "." + s.Name
+}
+
+// Names returns the IDs of the cataloged events in order
+func (c *Catalogue) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Get returns the spec with the given ID
+func (c *Catalogue) Get(id string) (Spec, bool) {
+	spec, exists := c.specs[id]
+	return spec, exists
+}
+
+// Schemas returns the JSON Schema of every cataloged event by ID
+func (c *Catalogue) Schemas() map[string]Schema {
+	schemas := make(map[string]Schema, len(c.specs))
+	for id, spec := range c.specs {
+		schemas[id] = spec.Schema()
+	}
+	return schemas
+}
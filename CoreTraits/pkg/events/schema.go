@@ -0,0 +1,179 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft of JSON Schema the generated schemas follow
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document
+type Schema map[string]interface{}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Schema generates the JSON Schema of the event's frame, pinning the event
+// name field to the event
+func (s Spec) Schema() Schema {
+	schema := valueSchema(reflect.ValueOf(s.Example), map[reflect.Type]bool{})
+	schema["$schema"] = schemaDraft
+	schema["title"] = s.Name
+	if s.Description != "" {
+		schema["description"] = s.Description
+	}
+
+	if properties, ok := schema["properties"].(Schema); ok {
+		properties[s.Key] = Schema{"const": s.Name}
+	}
+
+	return schema
+}
+
+// valueSchema describes how v is encoded by encoding/json. Interfaces are
+// described by the value they hold, nil ones and nil pointers by their type.
+// Types already being described are left open to stop recursion.
+func valueSchema(v reflect.Value, seen map[reflect.Type]bool) Schema {
+	if !v.IsValid() {
+		return Schema{}
+	}
+
+	t := v.Type()
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t.Kind() != reflect.Interface && t.Kind() != reflect.Ptr && t.Implements(marshalerType):
+		return marshalerSchema(v)
+	}
+
+	switch t.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			if t.Kind() == reflect.Interface {
+				return Schema{}
+			}
+			return valueSchema(reflect.Zero(t.Elem()), seen)
+		}
+		return valueSchema(v.Elem(), seen)
+
+	case reflect.Struct:
+		if seen[t] {
+			return Schema{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		properties := Schema{}
+		required := []string{}
+		addFields(v, properties, &required, seen)
+
+		schema := Schema{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+
+	case reflect.Slice, reflect.Array:
+		// Byte slices are encoded as base64 strings
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+
+		item := reflect.Zero(t.Elem())
+		if v.Len() > 0 {
+			item = v.Index(0)
+		}
+		return Schema{"type": "array", "items": valueSchema(item, seen)}
+
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": valueSchema(reflect.Zero(t.Elem()), seen)}
+
+	case reflect.String:
+		return Schema{"type": "string"}
+
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	}
+
+	return Schema{}
+}
+
+// addFields adds the JSON fields of a struct to properties, flattening
+// embedded structs the way encoding/json does. Fields without omitempty are
+// required.
+func addFields(v reflect.Value, properties Schema, required *[]string, seen map[reflect.Type]bool) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					embedded = reflect.Zero(embedded.Type().Elem())
+				} else {
+					embedded = embedded.Elem()
+				}
+			}
+			if embedded.Kind() == reflect.Struct {
+				addFields(embedded, properties, required, seen)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = valueSchema(v.Field(i), seen)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// marshalerSchema describes a type with its own JSON encoding by the kind of
+// JSON its zero value encodes to
+func marshalerSchema(v reflect.Value) Schema {
+	encoded, err := json.Marshal(reflect.Zero(v.Type()).Interface())
+	if err != nil || len(encoded) == 0 {
+		return Schema{}
+	}
+
+	switch encoded[0] {
+	case '"':
+		return Schema{"type": "string"}
+	case '{':
+		return Schema{"type": "object"}
+	case '[':
+		return Schema{"type": "array"}
+	case 't', 'f':
+		return Schema{"type": "boolean"}
+	case 'n':
+		return Schema{}
+	}
+
+	return Schema{"type": "number"}
+}
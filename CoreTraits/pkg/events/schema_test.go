@@ -0,0 +1,145 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	Shared string `json:"shared"`
+}
+
+type node struct {
+	Next *node `json:"next,omitempty"`
+}
+
+type level int
+
+func (level) MarshalJSON() ([]byte, error) { return []byte(`"low"`), nil }
+
+type payload struct {
+	embedded
+	Name     string            `json:"name"`
+	Count    int               `json:"count"`
+	Ratio    float64           `json:"ratio,omitempty"`
+	On       bool              `json:"on"`
+	At       time.Time         `json:"at"`
+	Raw      []byte            `json:"raw"`
+	Tags     []string          `json:"tags"`
+	Counts   map[string]int    `json:"counts"`
+	Optional *string           `json:"optional,omitempty"`
+	Level    level             `json:"level"`
+	Tree     node              `json:"tree"`
+	Extra    interface{}       `json:"extra"`
+	Labels   map[string]string `json:"-"`
+	Untagged string
+	hidden   string
+}
+
+func TestSchema(t *testing.T) {
+	schema := Event("thing_happened", "Something happened", payload{}).Schema()
+
+	if schema["$schema"] != schemaDraft || schema["title"] != "thing_happened" || schema["description"] != "Something happened" {
+		t.Errorf("header = %v, %v, %v", schema["$schema"], schema["title"], schema["description"])
+	}
+
+	frame := schema["properties"].(Schema)
+	if got := frame["event"]; !reflect.DeepEqual(got, Schema{"const": "thing_happened"}) {
+		t.Errorf("event = %v, want the name pinned", got)
+	}
+
+	data := frame["data"].(Schema)
+	properties := data["properties"].(Schema)
+
+	tests := []struct {
+		field string
+		want  Schema
+	}{
+		{"shared", Schema{"type": "string"}},
+		{"name", Schema{"type": "string"}},
+		{"count", Schema{"type": "integer"}},
+		{"ratio", Schema{"type": "number"}},
+		{"on", Schema{"type": "boolean"}},
+		{"at", Schema{"type": "string", "format": "date-time"}},
+		{"raw", Schema{"type": "string", "contentEncoding": "base64"}},
+		{"tags", Schema{"type": "array", "items": Schema{"type": "string"}}},
+		{"counts", Schema{"type": "object", "additionalProperties": Schema{"type": "integer"}}},
+		{"optional", Schema{"type": "string"}},
+		{"level", Schema{"type": "string"}},
+		{"tree", Schema{"type": "object", "properties": Schema{"next": Schema{"type": "object"}}}},
+		{"extra", Schema{}},
+		{"Untagged", Schema{"type": "string"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := properties[tt.field]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("properties[%q] = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+
+	for _, field := range []string{"Labels", "-", "hidden", "embedded"} {
+		if _, ok := properties[field]; ok {
+			t.Errorf("properties has %q, want it left out", field)
+		}
+	}
+
+	required := data["required"].([]string)
+	for _, field := range required {
+		if field == "ratio" || field == "optional" {
+			t.Errorf("required has omitempty field %q", field)
+		}
+	}
+	if len(required) != len(tests)-2 {
+		t.Errorf("required = %v, want every field without omitempty", required)
+	}
+}
+
+func TestSchemaDescribesInterfaceByValue(t *testing.T) {
+	spec := Spec{
+		Channel: ChannelRoomData,
+		Name:    "peer_join",
+		Key:     "type",
+		Example: struct {
+			Type string      `json:"type"`
+			Data interface{} `json:"data"`
+		}{Data: embedded{}},
+	}
+
+	properties := spec.Schema()["properties"].(Schema)
+	if got := properties["type"]; !reflect.DeepEqual(got, Schema{"const": "peer_join"}) {
+		t.Errorf("type = %v, want the name pinned under the spec's key", got)
+	}
+	if got := properties["data"].(Schema)["properties"]; !reflect.DeepEqual(got, Schema{"shared": Schema{"type": "string"}}) {
+		t.Errorf("data properties = %v, want the held value's fields", got)
+	}
+}
+
+func TestSchemaIsJSON(t *testing.T) {
+	if _, err := json.Marshal(Event("thing_happened", "", payload{}).Schema()); err != nil {
+		t.Fatalf("Marshal(Schema()) = %v", err)
+	}
+}
+
+func TestCatalogue(t *testing.T) {
+	catalogue := NewCatalogue(
+		[]Spec{Event("b", "first", nil), {Channel: ChannelChat, Name: "a"}},
+		[]Spec{Event("b", "second", nil)},
+	)
+
+	if got := catalogue.Names(); !reflect.DeepEqual(got, []string{"b", "chat.a"}) {
+		t.Errorf("Names() = %v, want [b chat.a]", got)
+	}
+	if spec, _ := catalogue.Get("b"); spec.Description != "second" {
+		t.Errorf("Get(b) = %q, want the later spec", spec.Description)
+	}
+	if _, ok := catalogue.Get("a"); ok {
+		t.Error("Get(a) found a chat event without its channel prefix")
+	}
+	if got := len(catalogue.Schemas()); got != 2 {
+		t.Errorf("Schemas() has %d entries, want 2", got)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	pionwebrtc "github.com/pion/webrtc/v3"
+
+	"github.com/subomi/AriesAPI/CoreTraits/handlers"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/auth"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/chat/webrtc"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
+)
+
+// loadConfig resolves the configuration from the -config file (or
+// ARIES_CONFIG), the environment and any explicitly set command line flags
+func loadConfig() (*config.Config, error) {
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("ARIES_CONFIG")
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags given on the command line win over the file and environment
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Server.Addr = *addr
+		case "cert":
+			cfg.Server.CertFile = *cert
+		case "key":
+			cfg.Server.KeyFile = *key
+		case "redirect":
+			cfg.Server.RedirectAddr = *redirectAddr
+		case "redirect-host":
+			cfg.Server.RedirectHost = *redirectHost
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// appConfig returns the Fiber settings. Behind a reverse proxy, client IPs
+// are read from the proxy header, but only on requests from trusted proxies.
+func appConfig(cfg *config.Config) fiber.Config {
+	return fiber.Config{
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableTrustedProxyCheck: cfg.Server.ProxyHeader != "",
+		TrustedProxies:          cfg.Server.TrustedProxies,
+		EnableIPValidation:      true,
+	}
+}
+
+// applyConfig threads the configuration into every package that uses it
+func applyConfig(cfg *config.Config) error {
+	chat.Configure(chat.Settings{
+		WriteWait:      cfg.Chat.WriteWait.Std(),
+		PongWait:       cfg.Chat.PongWait.Std(),
+		MaxMessageSize: cfg.Chat.MaxMessageSize,
+		SendBufferSize: cfg.Chat.SendBufferSize,
+		MaxHistory:     cfg.Chat.MaxHistory,
+	})
+
+	iceServers := make([]pionwebrtc.ICEServer, 0, len(cfg.WebRTC.ICEServers))
+	for _, server := range cfg.WebRTC.ICEServers {
+		iceServers = append(iceServers, pionwebrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	webrtc.Configure(webrtc.Settings{
+		ICEServers:       iceServers,
+		SignalBufferSize: cfg.WebRTC.SignalBufferSize,
+	})
+
+	handlers.Configure(cfg)
+
+	authenticator, err := auth.New(cfg.Auth)
+	if err != nil {
+		return err
+	}
+	handlers.SetAuthenticator(authenticator)
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -12,6 +15,7 @@ import (
 	"github.com/gofiber/websocket/v2"
 	
 	"github.com/subomi/AriesAPI/CoreTraits/handlers"
+	"github.com/subomi/AriesAPI/CoreTraits/pkg/config"
 )
 
 type Response struct {
@@ -19,15 +23,28 @@ type Response struct {
 }
 
 var (
-	addr = flag.String("addr", ":"+os.Getenv("PORT"), "Server Address")
-	cert = flag.String("cert", "", "")
-	key  = flag.String("key", "", "")
+	configPath = flag.String("config", "", "Path to a YAML or JSON config file (defaults to $ARIES_CONFIG)")
+
+	addr = flag.String("addr", "", "Server Address (overrides config and $PORT)")
+	cert = flag.String("cert", "", "TLS certificate file (enables HTTPS/WSS together with -key)")
+	key  = flag.String("key", "", "TLS private key file (enables HTTPS/WSS together with -cert)")
+
+	redirectAddr = flag.String("redirect", "", "Plain HTTP address that redirects to the TLS listener (e.g. :80)")
+	redirectHost = flag.String("redirect-host", "", "Host the HTTP redirect sends clients to (required with -redirect)")
 )
 
 func main() {
 	flag.Parse()
 
-	app := fiber.New()
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := applyConfig(cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	app := fiber.New(appConfig(cfg))
 	app.Use(cors.New())
 	app.Use(logger.New())
 
@@ -36,33 +53,103 @@ func main() {
 	app.Get("/health", handlers.Health)
 	app.Get("/stats", handlers.Stats)
 	app.Get("/docs", handlers.Documentation)
+	app.Get("/config", handlers.ConfigView)
+	app.Get("/events", handlers.EventSchemas)
+	app.Get("/events/:name", handlers.EventSchema)
 	
 	// Room endpoints
 	app.Get("/rooms", handlers.GetActiveRooms)
-	app.Get("/room/create", handlers.RoomCreate)
-	app.Get("/room/:uuid", handlers.Room)
-	app.Get("/room/:uuid/websocket", websocket.New(handlers.RoomWebsocket, websocket.Config{
-		HandshakeTimeout: 10 * time.Second,
+	app.Post("/rooms", handlers.RequireToken, handlers.CreateRoom)
+	app.Get("/rooms/:uuid", handlers.RequireToken, handlers.RequireRoomAccess, handlers.GetRoom)
+	app.Patch("/rooms/:uuid", handlers.RequireToken, handlers.UpdateRoom)
+	app.Delete("/rooms/:uuid", handlers.RequireToken, handlers.DeleteRoom)
+	app.Get("/room/:uuid", handlers.RequireToken, handlers.RequireRoomAccess, handlers.GetRoom)
+	app.Get("/room/:uuid/websocket", handlers.RequireToken, handlers.RequireRoomAccess, websocket.New(handlers.RoomWebsocket, websocket.Config{
+		HandshakeTimeout: cfg.Server.HandshakeTimeout.Std(),
 	}))
+	app.Post("/room/:uuid/peers/:peer/:action", handlers.RequireToken, handlers.ModeratePeer)
 	app.Get("/room/:uuid/chat", handlers.RoomChat)
-	app.Get("/room/:uuid/chat/websocket", websocket.New(handlers.RoomWebsocket))
-	app.Get("/room/:uuid/viewer/websocket", websocket.New(handlers.RoomViewerWebsocket))
+	app.Get("/room/:uuid/chat/websocket", handlers.RequireToken, handlers.RequireRoomAccess, websocket.New(handlers.RoomWebsocket))
+	app.Get("/room/:uuid/viewer/websocket", handlers.RequireToken, handlers.RequireRoomAccess, websocket.New(handlers.RoomViewerWebsocket))
 	
 	// Streaming endpoints
 	app.Get("/streams", handlers.GetActiveStreams)
-	app.Get("/stream/create", handlers.CreateStream)
-	app.Get("/stream/:ssuid", handlers.Stream)
-	app.Get("/stream/:ssuid/websocket", websocket.New(handlers.StreamWebsocket))
-	app.Get("/stream/:ssuid/chat/websocket", websocket.New(handlers.StreamChatWebsocket))
-	app.Get("/stream/:ssuid/viewer/websocket", websocket.New(handlers.StreamViewerWebsocket))
+	app.Post("/streams", handlers.RequireToken, handlers.CreateStream)
+	app.Get("/streams/:ssuid", handlers.GetStream)
+	app.Patch("/streams/:ssuid", handlers.RequireToken, handlers.UpdateStreamSettings)
+	app.Post("/streams/:ssuid/start", handlers.RequireToken, handlers.StartStream)
+	app.Post("/streams/:ssuid/pause", handlers.RequireToken, handlers.PauseStream)
+	app.Post("/streams/:ssuid/end", handlers.RequireToken, handlers.EndStream)
+	app.Get("/stream/:ssuid", handlers.GetStream)
+	app.Get("/stream/:ssuid/websocket", handlers.RequireToken, handlers.RequireStreamOwner, websocket.New(handlers.StreamWebsocket))
+	app.Get("/stream/:ssuid/chat/websocket", handlers.RequireToken, handlers.RequireStreamAccess, websocket.New(handlers.StreamChatWebsocket))
+	app.Get("/stream/:ssuid/viewer/websocket", handlers.RequireToken, handlers.RequireStreamAccess, websocket.New(handlers.StreamViewerWebsocket))
 	
 	// Catch-all for 404s
 	app.Use(handlers.NotFound)
 
-	// Start the Fiber app using the specified address
-	if err := app.Listen(*addr); err != nil {
-		panic(err)
+	// Close expired and abandoned sessions in the background
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	go handlers.RunJanitor(janitorCtx)
+
+	// Serve until the listener fails or a shutdown signal arrives
+	listeners, stopListeners := context.WithCancel(context.Background())
+	defer stopListeners()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(listeners, app, cfg)
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			panic(err)
+		}
+		return
+	case sig := <-stop:
+		log.Printf("Received %s, draining sessions", sig)
+	}
+
+	// Drain rooms and streams, then stop the HTTP server
+	stopJanitor()
+	stopListeners()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
+	defer cancel()
+
+	if err := handlers.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown incomplete: %v", err)
+	}
+
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		log.Printf("Failed to stop HTTP server: %v", err)
 	}
 
-	fmt.Println("Go server started on", *addr)
-}
\ No newline at end of file
+	fmt.Println("Go server stopped")
+}
+
+// serve runs the Fiber app on the configured listener until it is shut down.
+// The certificate watcher and the HTTP redirect stop once ctx is done.
+func serve(ctx context.Context, app *fiber.App, cfg *config.Config) error {
+	// Serve TLS when both a certificate and a key are supplied
+	if cfg.Server.CertFile != "" {
+		if cfg.Server.RedirectAddr != "" {
+			go func() {
+				if err := listenRedirect(ctx, cfg.Server.RedirectAddr, cfg.Server.Addr, cfg.Server.RedirectHost); err != nil {
+					log.Printf("HTTP redirect listener stopped: %v", err)
+				}
+			}()
+		}
+
+		fmt.Println("Go server starting with TLS on", cfg.Server.Addr)
+		return listenTLS(ctx, app, cfg.Server.Addr, cfg.Server.CertFile, cfg.Server.KeyFile)
+	}
+
+	// Start the Fiber app using the specified address
+	fmt.Println("Go server starting on", cfg.Server.Addr)
+	return app.Listen(cfg.Server.Addr)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// How often the certificate files are checked for changes
+const certReloadInterval = 30 * time.Second
+
+// certReloader serves a TLS key pair and reloads it when the files change on
+// disk, so certificates can be rotated without restarting or dropping calls
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	// Modification times of the currently loaded files
+	certModTime time.Time
+	keyModTime  time.Time
+
+	cert  *tls.Certificate
+	mutex sync.RWMutex
+}
+
+// newCertReloader loads the key pair and returns a reloader for it
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// reload reads the key pair from disk and swaps it in
+func (cr *certReloader) reload() error {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat certificate: %v", err)
+	}
+
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat key: %v", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %v", err)
+	}
+
+	cr.mutex.Lock()
+	cr.cert = &cert
+	cr.certModTime = certInfo.ModTime()
+	cr.keyModTime = keyInfo.ModTime()
+	cr.mutex.Unlock()
+
+	return nil
+}
+
+// changed reports whether either file was modified since the last load
+func (cr *certReloader) changed() bool {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return false
+	}
+
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return false
+	}
+
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	return !certInfo.ModTime().Equal(cr.certModTime) || !keyInfo.ModTime().Equal(cr.keyModTime)
+}
+
+// watch polls the files and reloads the key pair when they change, until
+// ctx is done. A failed reload (e.g. only one of the two files written yet)
+// keeps the previous certificate and is retried on the next tick.
+func (cr *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !cr.changed() {
+			continue
+		}
+
+		if err := cr.reload(); err != nil {
+			log.Printf("Failed to reload TLS certificate: %v", err)
+			continue
+		}
+
+		log.Printf("Reloaded TLS certificate from %s", cr.certFile)
+	}
+}
+
+// GetCertificate returns the current certificate for tls.Config
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	return cr.cert, nil
+}
+
+// listenTLS serves the app over HTTPS/WSS using a hot-reloading certificate.
+// The certificate stops being watched once ctx is done.
+func listenTLS(ctx context.Context, app *fiber.App, addr, certFile, keyFile string) error {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	go reloader.watch(ctx, certReloadInterval)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	return app.Listener(tls.NewListener(ln, tlsConfig))
+}
+
+// listenRedirect serves a plain HTTP listener that redirects every request
+// to the TLS listener on tlsAddr at host, until ctx is done. The requested
+// Host is never used, so the redirect cannot be pointed at another site.
+func listenRedirect(ctx context.Context, addr, tlsAddr, host string) error {
+	_, tlsPort, err := net.SplitHostPort(tlsAddr)
+	if err != nil {
+		return fmt.Errorf("invalid TLS address %q: %v", tlsAddr, err)
+	}
+
+	// Omit the default HTTPS port from the target
+	target := strings.Trim(host, "[]")
+	if tlsPort != "" && tlsPort != "443" {
+		target = net.JoinHostPort(target, tlsPort)
+	} else if strings.Contains(target, ":") {
+		target = "[" + target + "]"
+	}
+
+	redirect := fiber.New(fiber.Config{DisableStartupMessage: true})
+	redirect.Use(func(c *fiber.Ctx) error {
+		return c.Redirect("https://"+target+c.OriginalURL(), fiber.StatusMovedPermanently)
+	})
+
+	go func() {
+		<-ctx.Done()
+		redirect.Shutdown()
+	}()
+
+	return redirect.Listen(addr)
+}